@@ -0,0 +1,121 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// RunnerTokenType is the kind of GitHub Actions runner token to mint
+// +kubebuilder:validation:Enum=registration;remove
+type RunnerTokenType string
+
+const (
+	RunnerTokenTypeRegistration RunnerTokenType = "registration"
+	RunnerTokenTypeRemove       RunnerTokenType = "remove"
+)
+
+// ActionsRunnerRegistrationTokenSpec defines the desired state of ActionsRunnerRegistrationToken
+type ActionsRunnerRegistrationTokenSpec struct {
+	// The GitHub App's ID
+	AppID string `json:"appId"`
+
+	// The Installation ID
+	InstallationID string `json:"installationId"`
+
+	// Reference to the private key used for authentication
+	PrivateKeyRef *PrivateKeyRef `json:"privateKeyRef,omitempty"`
+
+	// Private keys in order of preference, used instead of privateKeyRef to roll keys without downtime.
+	// A key GitHub rejects is skipped in favor of the next one.
+	PrivateKeyRefs []PrivateKeyRef `json:"privateKeyRefs,omitempty"`
+
+	// Signer used instead of a private key Secret
+	Signer *Signer `json:"signer,omitempty"`
+
+	// Enterprise slug to register runners with. Exactly one of enterprise, organization and repository must be set.
+	Enterprise string `json:"enterprise,omitempty"`
+
+	// Organization to register runners with
+	Organization string `json:"organization,omitempty"`
+
+	// Repository to register runners with, in the "owner/name" form
+	Repository string `json:"repository,omitempty"`
+
+	// Whether to mint a runner registration token or a runner removal token
+	// +kubebuilder:default=registration
+	Type RunnerTokenType `json:"type,omitempty"`
+
+	// How long before the token's expiration it is refreshed. Defaults to 10m.
+	RefreshBefore *metav1.Duration `json:"refreshBefore,omitempty"`
+
+	// Optional template for customizing the generated resource
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Template *runtime.RawExtension `json:"template,omitempty"`
+}
+
+// ActionsRunnerRegistrationTokenStatus defines the observed state of ActionsRunnerRegistrationToken
+type ActionsRunnerRegistrationTokenStatus struct {
+	// List of current condition states
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Reference to the secret containing the token
+	SecretRef SecretRef `json:"secretRef,omitempty"`
+
+	// Expiration time of the token
+	ExpiresAt metav1.Time `json:"expiresAt,omitempty"`
+
+	// SHA256 fingerprint of the private key that signed the JWT for the current token
+	KeyFingerprint string `json:"keyFingerprint,omitempty"`
+
+	// SHA256 fingerprints of the private keys GitHub rejected during the last rotation
+	RejectedKeyFingerprints []string `json:"rejectedKeyFingerprints,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Type",type="string",JSONPath=".spec.type"
+// +kubebuilder:printcolumn:name="Enterprise",type="string",JSONPath=".spec.enterprise",priority=1
+// +kubebuilder:printcolumn:name="Organization",type="string",JSONPath=".spec.organization"
+// +kubebuilder:printcolumn:name="Repository",type="string",JSONPath=".spec.repository"
+// +kubebuilder:printcolumn:name="Secret Name",type="string",JSONPath=".status.secretRef.name"
+// +kubebuilder:printcolumn:name="Token Expires At",type="date",JSONPath=".status.expiresAt"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ActionsRunnerRegistrationToken is the Schema for the actionsrunnerregistrationtokens API
+type ActionsRunnerRegistrationToken struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ActionsRunnerRegistrationTokenSpec   `json:"spec,omitempty"`
+	Status ActionsRunnerRegistrationTokenStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ActionsRunnerRegistrationTokenList contains a list of ActionsRunnerRegistrationToken
+type ActionsRunnerRegistrationTokenList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ActionsRunnerRegistrationToken `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ActionsRunnerRegistrationToken{}, &ActionsRunnerRegistrationTokenList{})
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// AppJWTSpec defines the desired state of AppJWT
+type AppJWTSpec struct {
+	// The GitHub App's ID
+	AppID string `json:"appId"`
+
+	// Reference to the private key used for signing
+	PrivateKeyRef *PrivateKeyRef `json:"privateKeyRef,omitempty"`
+
+	// Private keys in order of preference, used instead of privateKeyRef to roll keys without downtime.
+	// The JWT is signed with the first key that can be read, as GitHub does not verify it here.
+	PrivateKeyRefs []PrivateKeyRef `json:"privateKeyRefs,omitempty"`
+
+	// Signer used instead of a private key Secret
+	Signer *Signer `json:"signer,omitempty"`
+
+	// Optional template for customizing the generated resource
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Template *runtime.RawExtension `json:"template,omitempty"`
+}
+
+// AppJWTStatus defines the observed state of AppJWT
+type AppJWTStatus struct {
+	// List of current condition states
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Reference to the secret containing the JWT
+	SecretRef SecretRef `json:"secretRef,omitempty"`
+
+	// Expiration time of the JWT
+	ExpiresAt metav1.Time `json:"expiresAt,omitempty"`
+
+	// Issue time of the JWT, backdated to allow for clock drift
+	IssuedAt metav1.Time `json:"issuedAt,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="App ID",type="string",JSONPath=".spec.appId"
+// +kubebuilder:printcolumn:name="Secret Name",type="string",JSONPath=".status.secretRef.name"
+// +kubebuilder:printcolumn:name="JWT Expires At",type="date",JSONPath=".status.expiresAt"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// AppJWT is the Schema for the appjwts API
+type AppJWT struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AppJWTSpec   `json:"spec,omitempty"`
+	Status AppJWTStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// AppJWTList contains a list of AppJWT
+type AppJWTList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AppJWT `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AppJWT{}, &AppJWTList{})
+}
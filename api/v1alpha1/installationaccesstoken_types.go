@@ -21,6 +21,26 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+const (
+	// RefreshRequestedAtAnnotation requests an immediate token rotation whenever its value changes
+	RefreshRequestedAtAnnotation = "tokenaut.appthrust.io/refresh-requested-at"
+
+	// PrivateKeySecretType is the type of Secrets holding GitHub App private keys
+	PrivateKeySecretType = "tokenaut.appthrust.io/private-key"
+
+	// AllowedNamespacesAnnotation lists, separated by commas, the namespaces whose resources may use a
+	// private key Secret when the manager only reads Secrets of PrivateKeySecretType
+	AllowedNamespacesAnnotation = "tokenaut.appthrust.io/allowed-namespaces"
+
+	// VaultKubernetesAuthAnnotation set to "true" allows the manager to log in to Vault as the ServiceAccount for
+	// the Vault KV sinks of InstallationAccessTokens in its namespace
+	VaultKubernetesAuthAnnotation = "tokenaut.appthrust.io/vault-kubernetes-auth"
+
+	// ShardLabel assigns an InstallationAccessToken, ActionsRunnerRegistrationToken or AppJWT to the managers
+	// started with --shard of the same value. Resources without it are reconciled by managers without --shard.
+	ShardLabel = "tokenaut.appthrust.io/shard"
+)
+
 // InstallationAccessTokenSpec defines the desired state of InstallationAccessToken
 type InstallationAccessTokenSpec struct {
 	// The GitHub App's ID
@@ -36,8 +56,21 @@ type InstallationAccessTokenSpec struct {
 	// Reference to the private key used for authentication
 	PrivateKeyRef *PrivateKeyRef `json:"privateKeyRef,omitempty"`
 
+	// Private keys in order of preference, used instead of privateKeyRef to roll keys without downtime.
+	// A key GitHub rejects is skipped in favor of the next one.
+	PrivateKeyRefs []PrivateKeyRef `json:"privateKeyRefs,omitempty"`
+
+	// Signer used instead of a private key Secret
+	Signer *Signer `json:"signer,omitempty"`
+
 	// Optional scope for the token
 	Scope *Scope `json:"scope,omitempty"`
+
+	// Suspend stops the controller from minting tokens and touching the Secret. The existing Secret is kept.
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Sink to write the rendered Secret's data to instead of a Secret in this cluster
+	Sink *Sink `json:"sink,omitempty"`
 }
 
 type PrivateKeyRef struct {
@@ -51,6 +84,102 @@ type PrivateKeyRef struct {
 	Key string `json:"key,omitempty"`
 }
 
+// Signer selects a signer that keeps the private key outside Kubernetes Secrets. Exactly one field must be set.
+type Signer struct {
+	// Sign with a PEM encoded private key file from the manager's key directory
+	File *FileSigner `json:"file,omitempty"`
+
+	// Sign with a HashiCorp Vault Transit key
+	VaultTransit *VaultTransitSigner `json:"vaultTransit,omitempty"`
+
+	// Sign with a private key held in the manager's PKCS#11 token, such as an HSM
+	PKCS11 *PKCS11Signer `json:"pkcs11,omitempty"`
+}
+
+type FileSigner struct {
+	// Name of the file in the manager's key directory
+	Name string `json:"name"`
+}
+
+type VaultTransitSigner struct {
+	// Name of the Transit key
+	Key string `json:"key"`
+
+	// Mount path of the Transit secrets engine, "transit" by default
+	Mount string `json:"mount,omitempty"`
+}
+
+type PKCS11Signer struct {
+	// Label of the private key object in the token
+	KeyLabel string `json:"keyLabel"`
+}
+
+// Sink selects where the rendered Secret's data is written. Exactly one field must be set.
+type Sink struct {
+	// Write to a secret of the HashiCorp Vault KV version 2 secrets engine
+	VaultKV *VaultKVSink `json:"vaultKV,omitempty"`
+
+	// Write the Secret to another Kubernetes cluster
+	RemoteCluster *RemoteClusterSink `json:"remoteCluster,omitempty"`
+}
+
+type RemoteClusterSink struct {
+	// Secret of the InstallationAccessToken's namespace holding the kubeconfig of the remote cluster,
+	// such as the "<cluster>-kubeconfig" Secret maintained by Cluster API
+	KubeconfigSecretRef KubeconfigSecretRef `json:"kubeconfigSecretRef"`
+
+	// Namespace of the remote cluster to write the Secret to, the rendered Secret's namespace by default
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type KubeconfigSecretRef struct {
+	// Name of the Secret
+	Name string `json:"name"`
+
+	// Key in the Secret holding the kubeconfig, "value" by default as used by Cluster API
+	Key string `json:"key,omitempty"`
+}
+
+type VaultKVSink struct {
+	// Mount path of the KV version 2 secrets engine, "secret" by default
+	Mount string `json:"mount,omitempty"`
+
+	// Path of the secret within the mount
+	Path string `json:"path"`
+
+	// How to authenticate to Vault
+	Auth VaultAuth `json:"auth"`
+}
+
+// VaultAuth selects how to authenticate to Vault. Exactly one field must be set.
+type VaultAuth struct {
+	// Log in with the Kubernetes auth method as a ServiceAccount of the InstallationAccessToken's namespace
+	Kubernetes *VaultKubernetesAuth `json:"kubernetes,omitempty"`
+
+	// Use the Vault token stored in a Secret of the InstallationAccessToken's namespace
+	TokenSecretRef *VaultTokenSecretRef `json:"tokenSecretRef,omitempty"`
+}
+
+type VaultKubernetesAuth struct {
+	// Mount path of the Kubernetes auth method, "kubernetes" by default
+	Mount string `json:"mount,omitempty"`
+
+	// Vault role to log in as
+	Role string `json:"role"`
+
+	// ServiceAccount whose token is presented to Vault, "default" by default. It must be annotated with
+	// tokenaut.appthrust.io/vault-kubernetes-auth: "true".
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+}
+
+type VaultTokenSecretRef struct {
+	// Name of the Secret
+	Name string `json:"name"`
+
+	// Key in the Secret holding the token, "token" by default
+	Key string `json:"key,omitempty"`
+}
+
 type Scope struct {
 	// List of repository names that the token should have access to
 	Repositories []string `json:"repositories,omitempty"`
@@ -64,14 +193,64 @@ type Scope struct {
 
 // InstallationAccessTokenStatus defines the observed state of InstallationAccessToken
 type InstallationAccessTokenStatus struct {
+	// Generation of the spec the status was last reconciled against
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
 	// List of current condition states
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 
 	// Reference to the secret containing the token
 	SecretRef SecretRef `json:"secretRef,omitempty"`
 
+	// Reference to the Vault KV secret containing the token, when written to Vault
+	VaultKVRef *VaultKVRef `json:"vaultKVRef,omitempty"`
+
+	// Reference to the secret containing the token in a remote cluster, when written to one
+	RemoteSecretRef *RemoteSecretRef `json:"remoteSecretRef,omitempty"`
+
 	// Token-specific information
 	Token TokenInfo `json:"token,omitempty"`
+
+	// Whether the current token is within its validity window, i.e. issued and not yet expired
+	// +optional
+	TokenValid bool `json:"tokenValid"`
+
+	// Value of the refresh-requested-at annotation that was last handled by a successful rotation
+	LastRefreshRequest string `json:"lastRefreshRequest,omitempty"`
+
+	// Time the current token was minted
+	LastRefreshTime *metav1.Time `json:"lastRefreshTime,omitempty"`
+
+	// Time the token is due to be refreshed next
+	NextRefreshTime *metav1.Time `json:"nextRefreshTime,omitempty"`
+
+	// SHA256 fingerprint of the private key that signed the JWT for the current token
+	KeyFingerprint string `json:"keyFingerprint,omitempty"`
+
+	// SHA256 fingerprints of the private keys GitHub rejected during the last rotation
+	RejectedKeyFingerprints []string `json:"rejectedKeyFingerprints,omitempty"`
+}
+
+type RemoteSecretRef struct {
+	// Kubeconfig Secret of the remote cluster
+	KubeconfigSecretRef KubeconfigSecretRef `json:"kubeconfigSecretRef"`
+
+	// Name of the secret in the remote cluster
+	Name string `json:"name"`
+
+	// Namespace of the secret in the remote cluster
+	Namespace string `json:"namespace"`
+}
+
+type VaultKVRef struct {
+	// Mount path of the KV version 2 secrets engine
+	Mount string `json:"mount"`
+
+	// Path of the secret within the mount
+	Path string `json:"path"`
+
+	// How the secret was authenticated to Vault when written, so that it can still be deleted after the spec changed
+	Auth *VaultAuth `json:"auth,omitempty"`
 }
 
 type SecretRef struct {
@@ -101,6 +280,7 @@ type TokenInfo struct {
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:storageversion
 // +kubebuilder:printcolumn:name="App ID",type="string",JSONPath=".spec.appId"
 // +kubebuilder:printcolumn:name="Installation ID",type="string",JSONPath=".spec.installationId"
 // +kubebuilder:printcolumn:name="Private Key Name",type="string",JSONPath=".spec.privateKeyRef.name"
@@ -108,6 +288,7 @@ type TokenInfo struct {
 // +kubebuilder:printcolumn:name="Secret Name",type="string",JSONPath=".status.secretRef.name"
 // +kubebuilder:printcolumn:name="Secret Namespace",type="string",JSONPath=".status.secretRef.namespace"
 // +kubebuilder:printcolumn:name="Token Expires At",type="date",JSONPath=".status.token.expiresAt"
+// +kubebuilder:printcolumn:name="Token Valid",type="boolean",JSONPath=".status.tokenValid"
 // +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
 // +kubebuilder:printcolumn:name="Token",type="string",JSONPath=".status.conditions[?(@.type=='Token')].status"
 // +kubebuilder:printcolumn:name="Secret",type="string",JSONPath=".status.conditions[?(@.type=='Secret')].status"
@@ -0,0 +1,74 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TokenBindingSpec defines which ServiceAccounts may obtain a token from the broker, and for which app, installation and scope
+type TokenBindingSpec struct {
+	// Names of the ServiceAccounts in the TokenBinding's namespace that are allowed to request a token
+	// +kubebuilder:validation:MinItems=1
+	ServiceAccounts []string `json:"serviceAccounts"`
+
+	// The GitHub App's ID
+	AppID string `json:"appId"`
+
+	// The Installation ID
+	InstallationID string `json:"installationId"`
+
+	// Reference to the private key used for authentication
+	PrivateKeyRef *PrivateKeyRef `json:"privateKeyRef,omitempty"`
+
+	// Private keys in order of preference, used instead of privateKeyRef to roll keys without downtime.
+	// A key GitHub rejects is skipped in favor of the next one.
+	PrivateKeyRefs []PrivateKeyRef `json:"privateKeyRefs,omitempty"`
+
+	// Signer used instead of a private key Secret
+	Signer *Signer `json:"signer,omitempty"`
+
+	// Optional scope for the token
+	Scope *Scope `json:"scope,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="App ID",type="string",JSONPath=".spec.appId"
+// +kubebuilder:printcolumn:name="Installation ID",type="string",JSONPath=".spec.installationId"
+// +kubebuilder:printcolumn:name="Service Accounts",type="string",JSONPath=".spec.serviceAccounts"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// TokenBinding is the Schema for the tokenbindings API
+type TokenBinding struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec TokenBindingSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// TokenBindingList contains a list of TokenBinding
+type TokenBindingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TokenBinding `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TokenBinding{}, &TokenBindingList{})
+}
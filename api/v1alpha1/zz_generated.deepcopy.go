@@ -25,6 +25,268 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ActionsRunnerRegistrationToken) DeepCopyInto(out *ActionsRunnerRegistrationToken) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ActionsRunnerRegistrationToken.
+func (in *ActionsRunnerRegistrationToken) DeepCopy() *ActionsRunnerRegistrationToken {
+	if in == nil {
+		return nil
+	}
+	out := new(ActionsRunnerRegistrationToken)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ActionsRunnerRegistrationToken) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ActionsRunnerRegistrationTokenList) DeepCopyInto(out *ActionsRunnerRegistrationTokenList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ActionsRunnerRegistrationToken, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ActionsRunnerRegistrationTokenList.
+func (in *ActionsRunnerRegistrationTokenList) DeepCopy() *ActionsRunnerRegistrationTokenList {
+	if in == nil {
+		return nil
+	}
+	out := new(ActionsRunnerRegistrationTokenList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ActionsRunnerRegistrationTokenList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ActionsRunnerRegistrationTokenSpec) DeepCopyInto(out *ActionsRunnerRegistrationTokenSpec) {
+	*out = *in
+	if in.PrivateKeyRef != nil {
+		in, out := &in.PrivateKeyRef, &out.PrivateKeyRef
+		*out = new(PrivateKeyRef)
+		**out = **in
+	}
+	if in.PrivateKeyRefs != nil {
+		in, out := &in.PrivateKeyRefs, &out.PrivateKeyRefs
+		*out = make([]PrivateKeyRef, len(*in))
+		copy(*out, *in)
+	}
+	if in.Signer != nil {
+		in, out := &in.Signer, &out.Signer
+		*out = new(Signer)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RefreshBefore != nil {
+		in, out := &in.RefreshBefore, &out.RefreshBefore
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Template != nil {
+		in, out := &in.Template, &out.Template
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ActionsRunnerRegistrationTokenSpec.
+func (in *ActionsRunnerRegistrationTokenSpec) DeepCopy() *ActionsRunnerRegistrationTokenSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ActionsRunnerRegistrationTokenSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ActionsRunnerRegistrationTokenStatus) DeepCopyInto(out *ActionsRunnerRegistrationTokenStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	out.SecretRef = in.SecretRef
+	in.ExpiresAt.DeepCopyInto(&out.ExpiresAt)
+	if in.RejectedKeyFingerprints != nil {
+		in, out := &in.RejectedKeyFingerprints, &out.RejectedKeyFingerprints
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ActionsRunnerRegistrationTokenStatus.
+func (in *ActionsRunnerRegistrationTokenStatus) DeepCopy() *ActionsRunnerRegistrationTokenStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ActionsRunnerRegistrationTokenStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppJWT) DeepCopyInto(out *AppJWT) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppJWT.
+func (in *AppJWT) DeepCopy() *AppJWT {
+	if in == nil {
+		return nil
+	}
+	out := new(AppJWT)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AppJWT) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppJWTList) DeepCopyInto(out *AppJWTList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]AppJWT, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppJWTList.
+func (in *AppJWTList) DeepCopy() *AppJWTList {
+	if in == nil {
+		return nil
+	}
+	out := new(AppJWTList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AppJWTList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppJWTSpec) DeepCopyInto(out *AppJWTSpec) {
+	*out = *in
+	if in.PrivateKeyRef != nil {
+		in, out := &in.PrivateKeyRef, &out.PrivateKeyRef
+		*out = new(PrivateKeyRef)
+		**out = **in
+	}
+	if in.PrivateKeyRefs != nil {
+		in, out := &in.PrivateKeyRefs, &out.PrivateKeyRefs
+		*out = make([]PrivateKeyRef, len(*in))
+		copy(*out, *in)
+	}
+	if in.Signer != nil {
+		in, out := &in.Signer, &out.Signer
+		*out = new(Signer)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Template != nil {
+		in, out := &in.Template, &out.Template
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppJWTSpec.
+func (in *AppJWTSpec) DeepCopy() *AppJWTSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AppJWTSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppJWTStatus) DeepCopyInto(out *AppJWTStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	out.SecretRef = in.SecretRef
+	in.ExpiresAt.DeepCopyInto(&out.ExpiresAt)
+	in.IssuedAt.DeepCopyInto(&out.IssuedAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppJWTStatus.
+func (in *AppJWTStatus) DeepCopy() *AppJWTStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AppJWTStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FileSigner) DeepCopyInto(out *FileSigner) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FileSigner.
+func (in *FileSigner) DeepCopy() *FileSigner {
+	if in == nil {
+		return nil
+	}
+	out := new(FileSigner)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *InstallationAccessToken) DeepCopyInto(out *InstallationAccessToken) {
 	*out = *in
@@ -97,11 +359,26 @@ func (in *InstallationAccessTokenSpec) DeepCopyInto(out *InstallationAccessToken
 		*out = new(PrivateKeyRef)
 		**out = **in
 	}
+	if in.PrivateKeyRefs != nil {
+		in, out := &in.PrivateKeyRefs, &out.PrivateKeyRefs
+		*out = make([]PrivateKeyRef, len(*in))
+		copy(*out, *in)
+	}
+	if in.Signer != nil {
+		in, out := &in.Signer, &out.Signer
+		*out = new(Signer)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Scope != nil {
 		in, out := &in.Scope, &out.Scope
 		*out = new(Scope)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Sink != nil {
+		in, out := &in.Sink, &out.Sink
+		*out = new(Sink)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstallationAccessTokenSpec.
@@ -125,7 +402,30 @@ func (in *InstallationAccessTokenStatus) DeepCopyInto(out *InstallationAccessTok
 		}
 	}
 	out.SecretRef = in.SecretRef
+	if in.VaultKVRef != nil {
+		in, out := &in.VaultKVRef, &out.VaultKVRef
+		*out = new(VaultKVRef)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RemoteSecretRef != nil {
+		in, out := &in.RemoteSecretRef, &out.RemoteSecretRef
+		*out = new(RemoteSecretRef)
+		**out = **in
+	}
 	in.Token.DeepCopyInto(&out.Token)
+	if in.LastRefreshTime != nil {
+		in, out := &in.LastRefreshTime, &out.LastRefreshTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextRefreshTime != nil {
+		in, out := &in.NextRefreshTime, &out.NextRefreshTime
+		*out = (*in).DeepCopy()
+	}
+	if in.RejectedKeyFingerprints != nil {
+		in, out := &in.RejectedKeyFingerprints, &out.RejectedKeyFingerprints
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstallationAccessTokenStatus.
@@ -138,6 +438,36 @@ func (in *InstallationAccessTokenStatus) DeepCopy() *InstallationAccessTokenStat
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubeconfigSecretRef) DeepCopyInto(out *KubeconfigSecretRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeconfigSecretRef.
+func (in *KubeconfigSecretRef) DeepCopy() *KubeconfigSecretRef {
+	if in == nil {
+		return nil
+	}
+	out := new(KubeconfigSecretRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PKCS11Signer) DeepCopyInto(out *PKCS11Signer) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PKCS11Signer.
+func (in *PKCS11Signer) DeepCopy() *PKCS11Signer {
+	if in == nil {
+		return nil
+	}
+	out := new(PKCS11Signer)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PrivateKeyRef) DeepCopyInto(out *PrivateKeyRef) {
 	*out = *in
@@ -153,6 +483,38 @@ func (in *PrivateKeyRef) DeepCopy() *PrivateKeyRef {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RemoteClusterSink) DeepCopyInto(out *RemoteClusterSink) {
+	*out = *in
+	out.KubeconfigSecretRef = in.KubeconfigSecretRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RemoteClusterSink.
+func (in *RemoteClusterSink) DeepCopy() *RemoteClusterSink {
+	if in == nil {
+		return nil
+	}
+	out := new(RemoteClusterSink)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RemoteSecretRef) DeepCopyInto(out *RemoteSecretRef) {
+	*out = *in
+	out.KubeconfigSecretRef = in.KubeconfigSecretRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RemoteSecretRef.
+func (in *RemoteSecretRef) DeepCopy() *RemoteSecretRef {
+	if in == nil {
+		return nil
+	}
+	out := new(RemoteSecretRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Scope) DeepCopyInto(out *Scope) {
 	*out = *in
@@ -200,6 +562,159 @@ func (in *SecretRef) DeepCopy() *SecretRef {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Signer) DeepCopyInto(out *Signer) {
+	*out = *in
+	if in.File != nil {
+		in, out := &in.File, &out.File
+		*out = new(FileSigner)
+		**out = **in
+	}
+	if in.VaultTransit != nil {
+		in, out := &in.VaultTransit, &out.VaultTransit
+		*out = new(VaultTransitSigner)
+		**out = **in
+	}
+	if in.PKCS11 != nil {
+		in, out := &in.PKCS11, &out.PKCS11
+		*out = new(PKCS11Signer)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Signer.
+func (in *Signer) DeepCopy() *Signer {
+	if in == nil {
+		return nil
+	}
+	out := new(Signer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Sink) DeepCopyInto(out *Sink) {
+	*out = *in
+	if in.VaultKV != nil {
+		in, out := &in.VaultKV, &out.VaultKV
+		*out = new(VaultKVSink)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RemoteCluster != nil {
+		in, out := &in.RemoteCluster, &out.RemoteCluster
+		*out = new(RemoteClusterSink)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Sink.
+func (in *Sink) DeepCopy() *Sink {
+	if in == nil {
+		return nil
+	}
+	out := new(Sink)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenBinding) DeepCopyInto(out *TokenBinding) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenBinding.
+func (in *TokenBinding) DeepCopy() *TokenBinding {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenBinding)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TokenBinding) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenBindingList) DeepCopyInto(out *TokenBindingList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]TokenBinding, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenBindingList.
+func (in *TokenBindingList) DeepCopy() *TokenBindingList {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenBindingList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TokenBindingList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenBindingSpec) DeepCopyInto(out *TokenBindingSpec) {
+	*out = *in
+	if in.ServiceAccounts != nil {
+		in, out := &in.ServiceAccounts, &out.ServiceAccounts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PrivateKeyRef != nil {
+		in, out := &in.PrivateKeyRef, &out.PrivateKeyRef
+		*out = new(PrivateKeyRef)
+		**out = **in
+	}
+	if in.PrivateKeyRefs != nil {
+		in, out := &in.PrivateKeyRefs, &out.PrivateKeyRefs
+		*out = make([]PrivateKeyRef, len(*in))
+		copy(*out, *in)
+	}
+	if in.Signer != nil {
+		in, out := &in.Signer, &out.Signer
+		*out = new(Signer)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Scope != nil {
+		in, out := &in.Scope, &out.Scope
+		*out = new(Scope)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenBindingSpec.
+func (in *TokenBindingSpec) DeepCopy() *TokenBindingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenBindingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TokenInfo) DeepCopyInto(out *TokenInfo) {
 	*out = *in
@@ -232,3 +747,109 @@ func (in *TokenInfo) DeepCopy() *TokenInfo {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultAuth) DeepCopyInto(out *VaultAuth) {
+	*out = *in
+	if in.Kubernetes != nil {
+		in, out := &in.Kubernetes, &out.Kubernetes
+		*out = new(VaultKubernetesAuth)
+		**out = **in
+	}
+	if in.TokenSecretRef != nil {
+		in, out := &in.TokenSecretRef, &out.TokenSecretRef
+		*out = new(VaultTokenSecretRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultAuth.
+func (in *VaultAuth) DeepCopy() *VaultAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultKVRef) DeepCopyInto(out *VaultKVRef) {
+	*out = *in
+	if in.Auth != nil {
+		in, out := &in.Auth, &out.Auth
+		*out = new(VaultAuth)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultKVRef.
+func (in *VaultKVRef) DeepCopy() *VaultKVRef {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultKVRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultKVSink) DeepCopyInto(out *VaultKVSink) {
+	*out = *in
+	in.Auth.DeepCopyInto(&out.Auth)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultKVSink.
+func (in *VaultKVSink) DeepCopy() *VaultKVSink {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultKVSink)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultKubernetesAuth) DeepCopyInto(out *VaultKubernetesAuth) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultKubernetesAuth.
+func (in *VaultKubernetesAuth) DeepCopy() *VaultKubernetesAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultKubernetesAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultTokenSecretRef) DeepCopyInto(out *VaultTokenSecretRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultTokenSecretRef.
+func (in *VaultTokenSecretRef) DeepCopy() *VaultTokenSecretRef {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultTokenSecretRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultTransitSigner) DeepCopyInto(out *VaultTransitSigner) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultTransitSigner.
+func (in *VaultTransitSigner) DeepCopy() *VaultTransitSigner {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultTransitSigner)
+	in.DeepCopyInto(out)
+	return out
+}
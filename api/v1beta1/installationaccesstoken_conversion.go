@@ -0,0 +1,426 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/appthrust/tokenaut/api/v1alpha1"
+)
+
+// V1alpha1SpecAnnotation preserves the v1alpha1 spec of an InstallationAccessToken whose v1beta1 spec can't
+// express all of it, e.g. a template with fields secretTemplate has no equivalent for, so that converting it
+// back to v1alpha1 is lossless
+const V1alpha1SpecAnnotation = "tokenaut.appthrust.io/v1alpha1-spec"
+
+// ConvertTo converts this InstallationAccessToken to the hub version, v1alpha1
+func (src *InstallationAccessToken) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.InstallationAccessToken)
+
+	spec, err := specToV1alpha1(&src.Spec)
+	if err != nil {
+		return err
+	}
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	if preserved, ok := dst.Annotations[V1alpha1SpecAnnotation]; ok {
+		delete(dst.Annotations, V1alpha1SpecAnnotation)
+		if len(dst.Annotations) == 0 {
+			dst.Annotations = nil
+		}
+		// The preserved spec is only current while the v1beta1 spec it converts to wasn't changed
+		var original v1alpha1.InstallationAccessTokenSpec
+		if err := json.Unmarshal([]byte(preserved), &original); err == nil {
+			if converted := specFromV1alpha1(&original); equality.Semantic.DeepEqual(converted, src.Spec) {
+				spec = &original
+			}
+		}
+	}
+	dst.Spec = *spec
+	dst.Status = statusToV1alpha1(&src.Status)
+	return nil
+}
+
+// ConvertFrom converts from the hub version, v1alpha1, to this version
+func (dst *InstallationAccessToken) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.InstallationAccessToken)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = specFromV1alpha1(&src.Spec)
+	if back, err := specToV1alpha1(&dst.Spec); err != nil || !v1alpha1SpecsEqual(back, &src.Spec) {
+		preserved, err := json.Marshal(src.Spec)
+		if err != nil {
+			return errors.Errorf("failed to preserve the v1alpha1 spec: %v", err)
+		}
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[V1alpha1SpecAnnotation] = string(preserved)
+	}
+	dst.Status = statusFromV1alpha1(&src.Status)
+	return nil
+}
+
+// v1alpha1SpecsEqual compares two v1alpha1 specs, their templates as JSON values
+func v1alpha1SpecsEqual(a, b *v1alpha1.InstallationAccessTokenSpec) bool {
+	templateA, errA := templateValue(a.Template)
+	templateB, errB := templateValue(b.Template)
+	if errA != nil || errB != nil || !equality.Semantic.DeepEqual(templateA, templateB) {
+		return false
+	}
+	a, b = a.DeepCopy(), b.DeepCopy()
+	a.Template, b.Template = nil, nil
+	return equality.Semantic.DeepEqual(a, b)
+}
+
+func templateValue(template *runtime.RawExtension) (interface{}, error) {
+	if template == nil || len(template.Raw) == 0 {
+		return nil, nil
+	}
+	var value interface{}
+	err := json.Unmarshal(template.Raw, &value)
+	return value, err
+}
+
+func specFromV1alpha1(src *v1alpha1.InstallationAccessTokenSpec) InstallationAccessTokenSpec {
+	// IDs GitHub never issued, i.e. not numbers, are preserved in V1alpha1SpecAnnotation
+	appID, _ := strconv.ParseInt(src.AppID, 10, 64)
+	installationID, _ := strconv.ParseInt(src.InstallationID, 10, 64)
+	dst := InstallationAccessTokenSpec{
+		App: AppReference{
+			ID:            appID,
+			PrivateKeyRef: privateKeyRefFromV1alpha1(src.PrivateKeyRef),
+			Signer:        signerFromV1alpha1(src.Signer),
+		},
+		Installation: InstallationSelector{ID: installationID},
+		Scope:        scopeFromV1alpha1(src.Scope),
+		Suspend:      src.Suspend,
+	}
+	for i := range src.PrivateKeyRefs {
+		dst.App.PrivateKeyRefs = append(dst.App.PrivateKeyRefs, *privateKeyRefFromV1alpha1(&src.PrivateKeyRefs[i]))
+	}
+
+	// Templates that aren't Secrets are preserved in V1alpha1SpecAnnotation
+	var secret corev1.Secret
+	if src.Template != nil {
+		_ = json.Unmarshal(src.Template.Raw, &secret)
+	}
+	if len(secret.Labels) > 0 || len(secret.Annotations) > 0 || secret.Type != "" || len(secret.Data) > 0 || len(secret.StringData) > 0 {
+		dst.SecretTemplate = &SecretTemplate{
+			Metadata: SecretTemplateMetadata{
+				Labels:      secret.Labels,
+				Annotations: secret.Annotations,
+			},
+			Type:       secret.Type,
+			Data:       secret.Data,
+			StringData: secret.StringData,
+		}
+	}
+
+	switch {
+	case src.Sink != nil && src.Sink.VaultKV != nil:
+		dst.Targets = []Target{{VaultKV: &VaultKVTarget{
+			Mount: src.Sink.VaultKV.Mount,
+			Path:  src.Sink.VaultKV.Path,
+			Auth:  vaultAuthFromV1alpha1(src.Sink.VaultKV.Auth),
+		}}}
+	case src.Sink != nil && src.Sink.RemoteCluster != nil:
+		namespace := src.Sink.RemoteCluster.Namespace
+		if namespace == "" {
+			namespace = secret.Namespace
+		}
+		dst.Targets = []Target{{RemoteCluster: &RemoteClusterTarget{
+			KubeconfigSecretRef: KubeconfigSecretRef(src.Sink.RemoteCluster.KubeconfigSecretRef),
+			Name:                secret.Name,
+			Namespace:           namespace,
+		}}}
+	case secret.Name != "" || secret.Namespace != "":
+		dst.Targets = []Target{{Secret: &SecretTarget{Name: secret.Name, Namespace: secret.Namespace}}}
+	}
+	return dst
+}
+
+func specToV1alpha1(src *InstallationAccessTokenSpec) (*v1alpha1.InstallationAccessTokenSpec, error) {
+	dst := &v1alpha1.InstallationAccessTokenSpec{
+		AppID:          strconv.FormatInt(src.App.ID, 10),
+		InstallationID: strconv.FormatInt(src.Installation.ID, 10),
+		PrivateKeyRef:  privateKeyRefToV1alpha1(src.App.PrivateKeyRef),
+		Signer:         signerToV1alpha1(src.App.Signer),
+		Scope:          scopeToV1alpha1(src.Scope),
+		Suspend:        src.Suspend,
+	}
+	for i := range src.App.PrivateKeyRefs {
+		dst.PrivateKeyRefs = append(dst.PrivateKeyRefs, *privateKeyRefToV1alpha1(&src.App.PrivateKeyRefs[i]))
+	}
+
+	metadata := map[string]interface{}{}
+	template := map[string]interface{}{}
+	if len(src.Targets) > 1 {
+		return nil, errors.Errorf("only a single target is supported, got %d", len(src.Targets))
+	}
+	for _, target := range src.Targets {
+		switch {
+		case target.Secret != nil && target.VaultKV == nil && target.RemoteCluster == nil:
+			setIfNotEmpty(metadata, "name", target.Secret.Name)
+			setIfNotEmpty(metadata, "namespace", target.Secret.Namespace)
+		case target.VaultKV != nil && target.Secret == nil && target.RemoteCluster == nil:
+			dst.Sink = &v1alpha1.Sink{VaultKV: &v1alpha1.VaultKVSink{
+				Mount: target.VaultKV.Mount,
+				Path:  target.VaultKV.Path,
+				Auth:  vaultAuthToV1alpha1(target.VaultKV.Auth),
+			}}
+		case target.RemoteCluster != nil && target.Secret == nil && target.VaultKV == nil:
+			setIfNotEmpty(metadata, "name", target.RemoteCluster.Name)
+			dst.Sink = &v1alpha1.Sink{RemoteCluster: &v1alpha1.RemoteClusterSink{
+				KubeconfigSecretRef: v1alpha1.KubeconfigSecretRef(target.RemoteCluster.KubeconfigSecretRef),
+				Namespace:           target.RemoteCluster.Namespace,
+			}}
+		default:
+			return nil, errors.Errorf("exactly one of secret, vaultKV and remoteCluster must be set in a target")
+		}
+	}
+	if t := src.SecretTemplate; t != nil {
+		if len(t.Metadata.Labels) > 0 {
+			metadata["labels"] = t.Metadata.Labels
+		}
+		if len(t.Metadata.Annotations) > 0 {
+			metadata["annotations"] = t.Metadata.Annotations
+		}
+		setIfNotEmpty(template, "type", string(t.Type))
+		if len(t.Data) > 0 {
+			template["data"] = t.Data
+		}
+		if len(t.StringData) > 0 {
+			template["stringData"] = t.StringData
+		}
+	}
+	if len(metadata) > 0 {
+		template["metadata"] = metadata
+	}
+	if len(template) > 0 {
+		raw, err := json.Marshal(template)
+		if err != nil {
+			return nil, errors.Errorf("failed to marshal the template: %v", err)
+		}
+		dst.Template = &runtime.RawExtension{Raw: raw}
+	}
+	return dst, nil
+}
+
+func setIfNotEmpty(m map[string]interface{}, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
+
+func privateKeyRefFromV1alpha1(src *v1alpha1.PrivateKeyRef) *PrivateKeyRef {
+	if src == nil {
+		return nil
+	}
+	return &PrivateKeyRef{Name: src.Name, Namespace: src.Namespace, Key: src.Key}
+}
+
+func privateKeyRefToV1alpha1(src *PrivateKeyRef) *v1alpha1.PrivateKeyRef {
+	if src == nil {
+		return nil
+	}
+	return &v1alpha1.PrivateKeyRef{Name: src.Name, Namespace: src.Namespace, Key: src.Key}
+}
+
+func signerFromV1alpha1(src *v1alpha1.Signer) *Signer {
+	if src == nil {
+		return nil
+	}
+	dst := &Signer{}
+	if src.File != nil {
+		dst.File = &FileSigner{Name: src.File.Name}
+	}
+	if src.VaultTransit != nil {
+		dst.VaultTransit = &VaultTransitSigner{Key: src.VaultTransit.Key, Mount: src.VaultTransit.Mount}
+	}
+	if src.PKCS11 != nil {
+		dst.PKCS11 = &PKCS11Signer{KeyLabel: src.PKCS11.KeyLabel}
+	}
+	return dst
+}
+
+func signerToV1alpha1(src *Signer) *v1alpha1.Signer {
+	if src == nil {
+		return nil
+	}
+	dst := &v1alpha1.Signer{}
+	if src.File != nil {
+		dst.File = &v1alpha1.FileSigner{Name: src.File.Name}
+	}
+	if src.VaultTransit != nil {
+		dst.VaultTransit = &v1alpha1.VaultTransitSigner{Key: src.VaultTransit.Key, Mount: src.VaultTransit.Mount}
+	}
+	if src.PKCS11 != nil {
+		dst.PKCS11 = &v1alpha1.PKCS11Signer{KeyLabel: src.PKCS11.KeyLabel}
+	}
+	return dst
+}
+
+func scopeFromV1alpha1(src *v1alpha1.Scope) *Scope {
+	if src == nil {
+		return nil
+	}
+	dst := &Scope{
+		Repositories: append([]string(nil), src.Repositories...),
+		Permissions:  copyStringMap(src.Permissions),
+	}
+	for _, id := range src.RepositoryIDs {
+		dst.RepositoryIDs = append(dst.RepositoryIDs, int64(id))
+	}
+	return dst
+}
+
+func scopeToV1alpha1(src *Scope) *v1alpha1.Scope {
+	if src == nil {
+		return nil
+	}
+	dst := &v1alpha1.Scope{
+		Repositories: append([]string(nil), src.Repositories...),
+		Permissions:  copyStringMap(src.Permissions),
+	}
+	for _, id := range src.RepositoryIDs {
+		dst.RepositoryIDs = append(dst.RepositoryIDs, int(id))
+	}
+	return dst
+}
+
+func vaultAuthFromV1alpha1(src v1alpha1.VaultAuth) VaultAuth {
+	var dst VaultAuth
+	if src.Kubernetes != nil {
+		kubernetes := VaultKubernetesAuth(*src.Kubernetes)
+		dst.Kubernetes = &kubernetes
+	}
+	if src.TokenSecretRef != nil {
+		tokenSecretRef := VaultTokenSecretRef(*src.TokenSecretRef)
+		dst.TokenSecretRef = &tokenSecretRef
+	}
+	return dst
+}
+
+func vaultAuthToV1alpha1(src VaultAuth) v1alpha1.VaultAuth {
+	var dst v1alpha1.VaultAuth
+	if src.Kubernetes != nil {
+		kubernetes := v1alpha1.VaultKubernetesAuth(*src.Kubernetes)
+		dst.Kubernetes = &kubernetes
+	}
+	if src.TokenSecretRef != nil {
+		tokenSecretRef := v1alpha1.VaultTokenSecretRef(*src.TokenSecretRef)
+		dst.TokenSecretRef = &tokenSecretRef
+	}
+	return dst
+}
+
+func statusFromV1alpha1(src *v1alpha1.InstallationAccessTokenStatus) InstallationAccessTokenStatus {
+	src = src.DeepCopy()
+	dst := InstallationAccessTokenStatus{
+		ObservedGeneration: src.ObservedGeneration,
+		Conditions:         src.Conditions,
+		SecretRef:          SecretRef(src.SecretRef),
+		Token: TokenInfo{
+			ExpiresAt:           src.Token.ExpiresAt,
+			Permissions:         src.Token.Permissions,
+			RepositorySelection: src.Token.RepositorySelection,
+			Repositories:        src.Token.Repositories,
+		},
+		TokenValid:              src.TokenValid,
+		LastRefreshRequest:      src.LastRefreshRequest,
+		LastRefreshTime:         src.LastRefreshTime,
+		NextRefreshTime:         src.NextRefreshTime,
+		KeyFingerprint:          src.KeyFingerprint,
+		RejectedKeyFingerprints: src.RejectedKeyFingerprints,
+	}
+	if src.VaultKVRef != nil {
+		dst.VaultKVRef = &VaultKVRef{Mount: src.VaultKVRef.Mount, Path: src.VaultKVRef.Path}
+		if src.VaultKVRef.Auth != nil {
+			auth := vaultAuthFromV1alpha1(*src.VaultKVRef.Auth)
+			dst.VaultKVRef.Auth = &auth
+		}
+	}
+	if src.RemoteSecretRef != nil {
+		dst.RemoteSecretRef = &RemoteSecretRef{
+			KubeconfigSecretRef: KubeconfigSecretRef(src.RemoteSecretRef.KubeconfigSecretRef),
+			Name:                src.RemoteSecretRef.Name,
+			Namespace:           src.RemoteSecretRef.Namespace,
+		}
+	}
+	for _, id := range src.Token.RepositoryIDs {
+		dst.Token.RepositoryIDs = append(dst.Token.RepositoryIDs, int64(id))
+	}
+	return dst
+}
+
+func statusToV1alpha1(src *InstallationAccessTokenStatus) v1alpha1.InstallationAccessTokenStatus {
+	src = src.DeepCopy()
+	dst := v1alpha1.InstallationAccessTokenStatus{
+		ObservedGeneration: src.ObservedGeneration,
+		Conditions:         src.Conditions,
+		SecretRef:          v1alpha1.SecretRef(src.SecretRef),
+		Token: v1alpha1.TokenInfo{
+			ExpiresAt:           src.Token.ExpiresAt,
+			Permissions:         src.Token.Permissions,
+			RepositorySelection: src.Token.RepositorySelection,
+			Repositories:        src.Token.Repositories,
+		},
+		TokenValid:              src.TokenValid,
+		LastRefreshRequest:      src.LastRefreshRequest,
+		LastRefreshTime:         src.LastRefreshTime,
+		NextRefreshTime:         src.NextRefreshTime,
+		KeyFingerprint:          src.KeyFingerprint,
+		RejectedKeyFingerprints: src.RejectedKeyFingerprints,
+	}
+	if src.VaultKVRef != nil {
+		dst.VaultKVRef = &v1alpha1.VaultKVRef{Mount: src.VaultKVRef.Mount, Path: src.VaultKVRef.Path}
+		if src.VaultKVRef.Auth != nil {
+			auth := vaultAuthToV1alpha1(*src.VaultKVRef.Auth)
+			dst.VaultKVRef.Auth = &auth
+		}
+	}
+	if src.RemoteSecretRef != nil {
+		dst.RemoteSecretRef = &v1alpha1.RemoteSecretRef{
+			KubeconfigSecretRef: v1alpha1.KubeconfigSecretRef(src.RemoteSecretRef.KubeconfigSecretRef),
+			Name:                src.RemoteSecretRef.Name,
+			Namespace:           src.RemoteSecretRef.Namespace,
+		}
+	}
+	for _, id := range src.Token.RepositoryIDs {
+		dst.Token.RepositoryIDs = append(dst.Token.RepositoryIDs, int(id))
+	}
+	return dst
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,292 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/appthrust/tokenaut/api/v1alpha1"
+)
+
+func testStatus() v1alpha1.InstallationAccessTokenStatus {
+	now := metav1.NewTime(time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC))
+	next := metav1.NewTime(now.Add(50 * time.Minute))
+	return v1alpha1.InstallationAccessTokenStatus{
+		ObservedGeneration: 3,
+		Conditions: []metav1.Condition{
+			{Type: "Ready", Status: metav1.ConditionTrue, Reason: "AllReady", ObservedGeneration: 3, LastTransitionTime: now},
+		},
+		SecretRef:       v1alpha1.SecretRef{Name: "github-token", Namespace: "ci"},
+		RemoteSecretRef: &v1alpha1.RemoteSecretRef{KubeconfigSecretRef: v1alpha1.KubeconfigSecretRef{Name: "edge-kubeconfig"}, Name: "github-token", Namespace: "ci"},
+		VaultKVRef: &v1alpha1.VaultKVRef{Mount: "secret", Path: "ci/github", Auth: &v1alpha1.VaultAuth{
+			Kubernetes: &v1alpha1.VaultKubernetesAuth{Role: "tokenaut"},
+		}},
+		Token: v1alpha1.TokenInfo{
+			ExpiresAt:           metav1.NewTime(now.Add(time.Hour)),
+			Permissions:         map[string]string{"contents": "read"},
+			RepositorySelection: "selected",
+			Repositories:        []string{"app"},
+			RepositoryIDs:       []int{1296269},
+		},
+		TokenValid:              true,
+		LastRefreshRequest:      "2024-04-01T11:59:58Z",
+		LastRefreshTime:         &now,
+		NextRefreshTime:         &next,
+		KeyFingerprint:          "SHA256:key",
+		RejectedKeyFingerprints: []string{"SHA256:old"},
+	}
+}
+
+func TestConvertFromV1alpha1(t *testing.T) {
+	testCases := []struct {
+		name     string
+		spec     v1alpha1.InstallationAccessTokenSpec
+		want     InstallationAccessTokenSpec
+		preserve bool
+	}{
+		{
+			name: "Minimal",
+			spec: v1alpha1.InstallationAccessTokenSpec{AppID: "12345", InstallationID: "1234567890"},
+			want: InstallationAccessTokenSpec{App: AppReference{ID: 12345}, Installation: InstallationSelector{ID: 1234567890}},
+		},
+		{
+			name: "Secret template",
+			spec: v1alpha1.InstallationAccessTokenSpec{
+				AppID:          "12345",
+				InstallationID: "1234567890",
+				PrivateKeyRef:  &v1alpha1.PrivateKeyRef{Name: "github-app-private-key", Namespace: "tokenaut-system"},
+				Scope:          &v1alpha1.Scope{Repositories: []string{"app"}, RepositoryIDs: []int{1296269}, Permissions: map[string]string{"contents": "read"}},
+				Template: &runtime.RawExtension{Raw: []byte(`{
+					"metadata": {"name": "git-credentials", "namespace": "argocd", "labels": {"argocd.argoproj.io/secret-type": "repository"}},
+					"type": "kubernetes.io/basic-auth",
+					"data": {"url": "aHR0cHM6Ly9naXRodWIuY29t"},
+					"stringData": {"password": "{{ .Token }}"}
+				}`)},
+				Suspend: true,
+			},
+			want: InstallationAccessTokenSpec{
+				App: AppReference{
+					ID:            12345,
+					PrivateKeyRef: &PrivateKeyRef{Name: "github-app-private-key", Namespace: "tokenaut-system"},
+				},
+				Installation: InstallationSelector{ID: 1234567890},
+				Scope:        &Scope{Repositories: []string{"app"}, RepositoryIDs: []int64{1296269}, Permissions: map[string]string{"contents": "read"}},
+				SecretTemplate: &SecretTemplate{
+					Metadata:   SecretTemplateMetadata{Labels: map[string]string{"argocd.argoproj.io/secret-type": "repository"}},
+					Type:       corev1.SecretTypeBasicAuth,
+					Data:       map[string][]byte{"url": []byte("https://github.com")},
+					StringData: map[string]string{"password": "{{ .Token }}"},
+				},
+				Targets: []Target{{Secret: &SecretTarget{Name: "git-credentials", Namespace: "argocd"}}},
+				Suspend: true,
+			},
+		},
+		{
+			name: "Vault KV sink with signer and key rotation",
+			spec: v1alpha1.InstallationAccessTokenSpec{
+				AppID:          "12345",
+				InstallationID: "1234567890",
+				PrivateKeyRefs: []v1alpha1.PrivateKeyRef{{Name: "new"}, {Name: "old", Key: "pem"}},
+				Signer:         &v1alpha1.Signer{VaultTransit: &v1alpha1.VaultTransitSigner{Key: "github-app"}},
+				Sink: &v1alpha1.Sink{VaultKV: &v1alpha1.VaultKVSink{
+					Path: "ci/github",
+					Auth: v1alpha1.VaultAuth{Kubernetes: &v1alpha1.VaultKubernetesAuth{Role: "tokenaut"}},
+				}},
+			},
+			want: InstallationAccessTokenSpec{
+				App: AppReference{
+					ID:             12345,
+					PrivateKeyRefs: []PrivateKeyRef{{Name: "new"}, {Name: "old", Key: "pem"}},
+					Signer:         &Signer{VaultTransit: &VaultTransitSigner{Key: "github-app"}},
+				},
+				Installation: InstallationSelector{ID: 1234567890},
+				Targets: []Target{{VaultKV: &VaultKVTarget{
+					Path: "ci/github",
+					Auth: VaultAuth{Kubernetes: &VaultKubernetesAuth{Role: "tokenaut"}},
+				}}},
+			},
+		},
+		{
+			name: "Remote cluster sink",
+			spec: v1alpha1.InstallationAccessTokenSpec{
+				AppID:          "12345",
+				InstallationID: "1234567890",
+				Template:       &runtime.RawExtension{Raw: []byte(`{"metadata": {"name": "github-token"}}`)},
+				Sink: &v1alpha1.Sink{RemoteCluster: &v1alpha1.RemoteClusterSink{
+					KubeconfigSecretRef: v1alpha1.KubeconfigSecretRef{Name: "edge-kubeconfig"},
+					Namespace:           "flux-system",
+				}},
+			},
+			want: InstallationAccessTokenSpec{
+				App:          AppReference{ID: 12345},
+				Installation: InstallationSelector{ID: 1234567890},
+				Targets: []Target{{RemoteCluster: &RemoteClusterTarget{
+					KubeconfigSecretRef: KubeconfigSecretRef{Name: "edge-kubeconfig"},
+					Name:                "github-token",
+					Namespace:           "flux-system",
+				}}},
+			},
+		},
+		{
+			name: "Template fields without an equivalent",
+			spec: v1alpha1.InstallationAccessTokenSpec{
+				AppID:          "12345",
+				InstallationID: "1234567890",
+				Template:       &runtime.RawExtension{Raw: []byte(`{"immutable": true, "stringData": {"token": "{{ .Token }}"}}`)},
+			},
+			want: InstallationAccessTokenSpec{
+				App:            AppReference{ID: 12345},
+				Installation:   InstallationSelector{ID: 1234567890},
+				SecretTemplate: &SecretTemplate{StringData: map[string]string{"token": "{{ .Token }}"}},
+			},
+			preserve: true,
+		},
+		{
+			name:     "IDs that are not numbers",
+			spec:     v1alpha1.InstallationAccessTokenSpec{AppID: "my-app", InstallationID: "01234"},
+			want:     InstallationAccessTokenSpec{Installation: InstallationSelector{ID: 1234}},
+			preserve: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			src := &v1alpha1.InstallationAccessToken{
+				ObjectMeta: metav1.ObjectMeta{Name: "github-token", Namespace: "ci", Generation: 3},
+				Spec:       tc.spec,
+				Status:     testStatus(),
+			}
+
+			dst := &InstallationAccessToken{}
+			if err := dst.ConvertFrom(src); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !equality.Semantic.DeepEqual(dst.Spec, tc.want) {
+				t.Errorf("Unexpected spec:\n got: %+v\nwant: %+v", dst.Spec, tc.want)
+			}
+			if _, ok := dst.Annotations[V1alpha1SpecAnnotation]; ok != tc.preserve {
+				t.Errorf("Expected the v1alpha1 spec to be preserved: %v, annotations: %v", tc.preserve, dst.Annotations)
+			}
+			if dst.Status.Token.RepositoryIDs[0] != 1296269 || dst.Status.RemoteSecretRef.KubeconfigSecretRef.Name != "edge-kubeconfig" {
+				t.Errorf("Unexpected status: %+v", dst.Status)
+			}
+
+			back := &v1alpha1.InstallationAccessToken{}
+			if err := dst.ConvertTo(back); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !v1alpha1SpecsEqual(&back.Spec, &src.Spec) {
+				t.Errorf("The spec changed in a round trip:\n got: %+v\nwant: %+v", back.Spec, src.Spec)
+			}
+			if !equality.Semantic.DeepEqual(back.Status, src.Status) {
+				t.Errorf("The status changed in a round trip:\n got: %+v\nwant: %+v", back.Status, src.Status)
+			}
+			if !equality.Semantic.DeepEqual(back.ObjectMeta, src.ObjectMeta) {
+				t.Errorf("The metadata changed in a round trip:\n got: %+v\nwant: %+v", back.ObjectMeta, src.ObjectMeta)
+			}
+		})
+	}
+}
+
+func TestConvertToV1alpha1(t *testing.T) {
+	src := &InstallationAccessToken{
+		ObjectMeta: metav1.ObjectMeta{Name: "github-token", Namespace: "ci", Annotations: map[string]string{"team": "platform"}},
+		Spec: InstallationAccessTokenSpec{
+			App:          AppReference{ID: 12345, Signer: &Signer{PKCS11: &PKCS11Signer{KeyLabel: "github-app"}}},
+			Installation: InstallationSelector{ID: 1234567890},
+			Scope:        &Scope{RepositoryIDs: []int64{1296269}},
+			SecretTemplate: &SecretTemplate{
+				Metadata:   SecretTemplateMetadata{Annotations: map[string]string{"owner": "platform"}},
+				StringData: map[string]string{"GITHUB_TOKEN": "{{ .Token }}"},
+			},
+			Targets: []Target{{Secret: &SecretTarget{Namespace: "builds"}}},
+		},
+	}
+
+	dst := &v1alpha1.InstallationAccessToken{}
+	if err := src.ConvertTo(dst); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if dst.Spec.AppID != "12345" || dst.Spec.InstallationID != "1234567890" {
+		t.Errorf("Unexpected IDs %q and %q", dst.Spec.AppID, dst.Spec.InstallationID)
+	}
+	if dst.Spec.Signer == nil || dst.Spec.Signer.PKCS11.KeyLabel != "github-app" || dst.Spec.Scope.RepositoryIDs[0] != 1296269 {
+		t.Errorf("Unexpected spec %+v", dst.Spec)
+	}
+	var template map[string]interface{}
+	if err := json.Unmarshal(dst.Spec.Template.Raw, &template); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := map[string]interface{}{
+		"metadata":   map[string]interface{}{"namespace": "builds", "annotations": map[string]interface{}{"owner": "platform"}},
+		"stringData": map[string]interface{}{"GITHUB_TOKEN": "{{ .Token }}"},
+	}
+	if !equality.Semantic.DeepEqual(template, want) {
+		t.Errorf("Unexpected template %v", template)
+	}
+
+	back := &InstallationAccessToken{}
+	if err := back.ConvertFrom(dst); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !equality.Semantic.DeepEqual(back.Spec, src.Spec) || !equality.Semantic.DeepEqual(back.ObjectMeta, src.ObjectMeta) {
+		t.Errorf("The resource changed in a round trip:\n got: %+v\nwant: %+v", back, src)
+	}
+}
+
+func TestConvertToV1alpha1IgnoresStalePreservedSpec(t *testing.T) {
+	src := &v1alpha1.InstallationAccessToken{
+		ObjectMeta: metav1.ObjectMeta{Name: "github-token", Namespace: "ci"},
+		Spec: v1alpha1.InstallationAccessTokenSpec{
+			AppID:          "12345",
+			InstallationID: "1234567890",
+			Template:       &runtime.RawExtension{Raw: []byte(`{"immutable": true}`)},
+		},
+	}
+	beta := &InstallationAccessToken{}
+	if err := beta.ConvertFrom(src); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	beta.Spec.Installation.ID = 42
+	dst := &v1alpha1.InstallationAccessToken{}
+	if err := beta.ConvertTo(dst); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if dst.Spec.InstallationID != "42" || dst.Spec.Template != nil {
+		t.Errorf("Expected the preserved spec to be ignored after the v1beta1 spec changed, got %+v", dst.Spec)
+	}
+	if _, ok := dst.Annotations[V1alpha1SpecAnnotation]; ok {
+		t.Errorf("Expected the annotation to be removed, got %v", dst.Annotations)
+	}
+}
+
+func TestConvertToV1alpha1RejectsInvalidTargets(t *testing.T) {
+	testCases := map[string][]Target{
+		"Several targets": {{Secret: &SecretTarget{}}, {Secret: &SecretTarget{Name: "other"}}},
+		"Empty target":    {{}},
+		"Ambiguous target": {{
+			Secret:  &SecretTarget{},
+			VaultKV: &VaultKVTarget{Path: "ci/github"},
+		}},
+	}
+	for name, targets := range testCases {
+		t.Run(name, func(t *testing.T) {
+			src := &InstallationAccessToken{Spec: InstallationAccessTokenSpec{
+				App:          AppReference{ID: 12345},
+				Installation: InstallationSelector{ID: 1234567890},
+				Targets:      targets,
+			}}
+			err := src.ConvertTo(&v1alpha1.InstallationAccessToken{})
+			if err == nil || !strings.Contains(err.Error(), "target") {
+				t.Errorf("Expected an error about the targets, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// InstallationAccessTokenSpec defines the desired state of InstallationAccessToken
+type InstallationAccessTokenSpec struct {
+	// The GitHub App the token is minted by
+	App AppReference `json:"app"`
+
+	// The installation of the app the token is minted for
+	Installation InstallationSelector `json:"installation"`
+
+	// Repositories and permissions the token is restricted to, everything the installation may access by default
+	Scope *Scope `json:"scope,omitempty"`
+
+	// Labels, annotations, type and data of the Secret holding the token.
+	// Values of stringData are Go templates, e.g. "{{ .Token }}".
+	SecretTemplate *SecretTemplate `json:"secretTemplate,omitempty"`
+
+	// Where the Secret is written, a Secret named after the InstallationAccessToken in its namespace by default.
+	// A single target is supported for now.
+	// +kubebuilder:validation:MaxItems=1
+	Targets []Target `json:"targets,omitempty"`
+
+	// Suspend stops the controller from minting tokens and touching the Secret. The existing Secret is kept.
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// AppReference identifies a GitHub App and how to sign its JWTs
+type AppReference struct {
+	// The GitHub App's ID
+	// +kubebuilder:validation:Minimum=1
+	ID int64 `json:"id"`
+
+	// Reference to the private key used for authentication
+	PrivateKeyRef *PrivateKeyRef `json:"privateKeyRef,omitempty"`
+
+	// Private keys in order of preference, used instead of privateKeyRef to roll keys without downtime.
+	// A key GitHub rejects is skipped in favor of the next one.
+	PrivateKeyRefs []PrivateKeyRef `json:"privateKeyRefs,omitempty"`
+
+	// Signer used instead of a private key Secret
+	Signer *Signer `json:"signer,omitempty"`
+}
+
+// InstallationSelector selects an installation of the app
+type InstallationSelector struct {
+	// The installation's ID
+	// +kubebuilder:validation:Minimum=1
+	ID int64 `json:"id"`
+}
+
+type PrivateKeyRef struct {
+	// Name of the private key Secret
+	Name string `json:"name,omitempty"`
+
+	// Namespace of the private key Secret
+	Namespace string `json:"namespace,omitempty"`
+
+	// Key in the Secret holding the private key
+	Key string `json:"key,omitempty"`
+}
+
+// Signer selects a signer that keeps the private key outside Kubernetes Secrets. Exactly one field must be set.
+type Signer struct {
+	// Sign with a PEM encoded private key file from the manager's key directory
+	File *FileSigner `json:"file,omitempty"`
+
+	// Sign with a HashiCorp Vault Transit key
+	VaultTransit *VaultTransitSigner `json:"vaultTransit,omitempty"`
+
+	// Sign with a private key held in the manager's PKCS#11 token, such as an HSM
+	PKCS11 *PKCS11Signer `json:"pkcs11,omitempty"`
+}
+
+type FileSigner struct {
+	// Name of the file in the manager's key directory
+	Name string `json:"name"`
+}
+
+type VaultTransitSigner struct {
+	// Name of the Transit key
+	Key string `json:"key"`
+
+	// Mount path of the Transit secrets engine, "transit" by default
+	Mount string `json:"mount,omitempty"`
+}
+
+type PKCS11Signer struct {
+	// Label of the private key object in the token
+	KeyLabel string `json:"keyLabel"`
+}
+
+type Scope struct {
+	// Names of the repositories the token may access
+	Repositories []string `json:"repositories,omitempty"`
+
+	// IDs of the repositories the token may access
+	RepositoryIDs []int64 `json:"repositoryIds,omitempty"`
+
+	// Permissions granted to the token, e.g. contents: read
+	Permissions map[string]string `json:"permissions,omitempty"`
+}
+
+// SecretTemplate describes the Secret holding the token
+type SecretTemplate struct {
+	// Labels and annotations of the Secret
+	Metadata SecretTemplateMetadata `json:"metadata,omitempty"`
+
+	// Type of the Secret, Opaque by default
+	Type corev1.SecretType `json:"type,omitempty"`
+
+	// Data of the Secret
+	Data map[string][]byte `json:"data,omitempty"`
+
+	// String data of the Secret, rendered as Go templates. The token is written to the "token" key when empty.
+	StringData map[string]string `json:"stringData,omitempty"`
+}
+
+type SecretTemplateMetadata struct {
+	// Labels of the Secret
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations of the Secret
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Target is where the Secret is written. Exactly one field must be set.
+type Target struct {
+	// Write the Secret to this cluster
+	Secret *SecretTarget `json:"secret,omitempty"`
+
+	// Write the Secret's data to a secret of the HashiCorp Vault KV version 2 secrets engine
+	VaultKV *VaultKVTarget `json:"vaultKV,omitempty"`
+
+	// Write the Secret to another Kubernetes cluster
+	RemoteCluster *RemoteClusterTarget `json:"remoteCluster,omitempty"`
+}
+
+type SecretTarget struct {
+	// Name of the Secret, the InstallationAccessToken's name by default
+	Name string `json:"name,omitempty"`
+
+	// Namespace of the Secret, the InstallationAccessToken's namespace by default
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type VaultKVTarget struct {
+	// Mount path of the KV version 2 secrets engine, "secret" by default
+	Mount string `json:"mount,omitempty"`
+
+	// Path of the secret within the mount
+	Path string `json:"path"`
+
+	// How to authenticate to Vault
+	Auth VaultAuth `json:"auth"`
+}
+
+// VaultAuth selects how to authenticate to Vault. Exactly one field must be set.
+type VaultAuth struct {
+	// Log in with the Kubernetes auth method as a ServiceAccount of the InstallationAccessToken's namespace
+	Kubernetes *VaultKubernetesAuth `json:"kubernetes,omitempty"`
+
+	// Use the Vault token stored in a Secret of the InstallationAccessToken's namespace
+	TokenSecretRef *VaultTokenSecretRef `json:"tokenSecretRef,omitempty"`
+}
+
+type VaultKubernetesAuth struct {
+	// Mount path of the Kubernetes auth method, "kubernetes" by default
+	Mount string `json:"mount,omitempty"`
+
+	// Vault role to log in as
+	Role string `json:"role"`
+
+	// ServiceAccount whose token is presented to Vault, "default" by default. It must be annotated with
+	// tokenaut.appthrust.io/vault-kubernetes-auth: "true".
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+}
+
+type VaultTokenSecretRef struct {
+	// Name of the Secret
+	Name string `json:"name"`
+
+	// Key in the Secret holding the token, "token" by default
+	Key string `json:"key,omitempty"`
+}
+
+type RemoteClusterTarget struct {
+	// Secret of the InstallationAccessToken's namespace holding the kubeconfig of the remote cluster,
+	// such as the "<cluster>-kubeconfig" Secret maintained by Cluster API
+	KubeconfigSecretRef KubeconfigSecretRef `json:"kubeconfigSecretRef"`
+
+	// Name of the Secret in the remote cluster, the InstallationAccessToken's name by default
+	Name string `json:"name,omitempty"`
+
+	// Namespace of the Secret in the remote cluster, the InstallationAccessToken's namespace by default
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type KubeconfigSecretRef struct {
+	// Name of the Secret
+	Name string `json:"name"`
+
+	// Key in the Secret holding the kubeconfig, "value" by default as used by Cluster API
+	Key string `json:"key,omitempty"`
+}
+
+// InstallationAccessTokenStatus defines the observed state of InstallationAccessToken
+type InstallationAccessTokenStatus struct {
+	// Generation of the spec the status was last reconciled against
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// List of current condition states
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Reference to the secret containing the token
+	SecretRef SecretRef `json:"secretRef,omitempty"`
+
+	// Reference to the Vault KV secret containing the token, when written to Vault
+	VaultKVRef *VaultKVRef `json:"vaultKVRef,omitempty"`
+
+	// Reference to the secret containing the token in a remote cluster, when written to one
+	RemoteSecretRef *RemoteSecretRef `json:"remoteSecretRef,omitempty"`
+
+	// Token-specific information
+	Token TokenInfo `json:"token,omitempty"`
+
+	// Whether the current token is within its validity window, i.e. issued and not yet expired
+	// +optional
+	TokenValid bool `json:"tokenValid"`
+
+	// Value of the refresh-requested-at annotation that was last handled by a successful rotation
+	LastRefreshRequest string `json:"lastRefreshRequest,omitempty"`
+
+	// Time the current token was minted
+	LastRefreshTime *metav1.Time `json:"lastRefreshTime,omitempty"`
+
+	// Time the token is due to be refreshed next
+	NextRefreshTime *metav1.Time `json:"nextRefreshTime,omitempty"`
+
+	// SHA256 fingerprint of the private key that signed the JWT for the current token
+	KeyFingerprint string `json:"keyFingerprint,omitempty"`
+
+	// SHA256 fingerprints of the private keys GitHub rejected during the last rotation
+	RejectedKeyFingerprints []string `json:"rejectedKeyFingerprints,omitempty"`
+}
+
+type RemoteSecretRef struct {
+	// Kubeconfig Secret of the remote cluster
+	KubeconfigSecretRef KubeconfigSecretRef `json:"kubeconfigSecretRef"`
+
+	// Name of the secret in the remote cluster
+	Name string `json:"name"`
+
+	// Namespace of the secret in the remote cluster
+	Namespace string `json:"namespace"`
+}
+
+type VaultKVRef struct {
+	// Mount path of the KV version 2 secrets engine
+	Mount string `json:"mount"`
+
+	// Path of the secret within the mount
+	Path string `json:"path"`
+
+	// How the secret was authenticated to Vault when written, so that it can still be deleted after the spec changed
+	Auth *VaultAuth `json:"auth,omitempty"`
+}
+
+type SecretRef struct {
+	// Name of the secret
+	Name string `json:"name"`
+
+	// Namespace where the secret is stored
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type TokenInfo struct {
+	// Expiration time of the token
+	ExpiresAt metav1.Time `json:"expiresAt,omitempty"`
+
+	// Permissions granted to the token
+	Permissions map[string]string `json:"permissions,omitempty"`
+
+	// How repositories are selected for this token
+	RepositorySelection string `json:"repositorySelection,omitempty"`
+
+	// List of repository names that the token has access to
+	Repositories []string `json:"repositories,omitempty"`
+
+	// List of repository IDs that the token has access to
+	RepositoryIDs []int64 `json:"repositoryIds,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="App ID",type="integer",JSONPath=".spec.app.id"
+// +kubebuilder:printcolumn:name="Installation ID",type="integer",JSONPath=".spec.installation.id"
+// +kubebuilder:printcolumn:name="Secret Name",type="string",JSONPath=".status.secretRef.name"
+// +kubebuilder:printcolumn:name="Secret Namespace",type="string",JSONPath=".status.secretRef.namespace"
+// +kubebuilder:printcolumn:name="Token Expires At",type="date",JSONPath=".status.token.expiresAt"
+// +kubebuilder:printcolumn:name="Token Valid",type="boolean",JSONPath=".status.tokenValid"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// InstallationAccessToken is the Schema for the installationaccesstokens API
+type InstallationAccessToken struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   InstallationAccessTokenSpec   `json:"spec,omitempty"`
+	Status InstallationAccessTokenStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// InstallationAccessTokenList contains a list of InstallationAccessToken
+type InstallationAccessTokenList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []InstallationAccessToken `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&InstallationAccessToken{}, &InstallationAccessTokenList{})
+}
@@ -60,3 +60,119 @@ Create the name of the service account to use
 {{- default "default" .Values.serviceAccount.name }}
 {{- end }}
 {{- end }}
+
+{{/*
+Rules of the manager role for namespaced resources
+*/}}
+{{- define "chart.managerRules" -}}
+- apiGroups:
+  - tokenaut.appthrust.io
+  resources:
+  - actionsrunnerregistrationtokens
+  verbs:
+  - create
+  - delete
+  - get
+  - list
+  - patch
+  - update
+  - watch
+- apiGroups:
+  - tokenaut.appthrust.io
+  resources:
+  - actionsrunnerregistrationtokens/finalizers
+  verbs:
+  - update
+- apiGroups:
+  - tokenaut.appthrust.io
+  resources:
+  - actionsrunnerregistrationtokens/status
+  verbs:
+  - get
+  - patch
+  - update
+- apiGroups:
+  - tokenaut.appthrust.io
+  resources:
+  - appjwts
+  verbs:
+  - create
+  - delete
+  - get
+  - list
+  - patch
+  - update
+  - watch
+- apiGroups:
+  - tokenaut.appthrust.io
+  resources:
+  - appjwts/finalizers
+  verbs:
+  - update
+- apiGroups:
+  - tokenaut.appthrust.io
+  resources:
+  - appjwts/status
+  verbs:
+  - get
+  - patch
+  - update
+- apiGroups:
+  - tokenaut.appthrust.io
+  resources:
+  - installationaccesstokens
+  verbs:
+  - create
+  - delete
+  - get
+  - list
+  - patch
+  - update
+  - watch
+- apiGroups:
+  - tokenaut.appthrust.io
+  resources:
+  - installationaccesstokens/finalizers
+  verbs:
+  - update
+- apiGroups:
+  - tokenaut.appthrust.io
+  resources:
+  - installationaccesstokens/status
+  verbs:
+  - get
+  - patch
+  - update
+- apiGroups:
+  - tokenaut.appthrust.io
+  resources:
+  - tokenbindings
+  verbs:
+  - get
+  - list
+  - watch
+- apiGroups:
+    - ""
+  resources:
+    - secrets
+  verbs:
+    - create
+    - delete
+    - get
+    - list
+    - patch
+    - update
+    - watch
+- apiGroups:
+    - ""
+  resources:
+    - serviceaccounts
+  verbs:
+    - get
+- apiGroups:
+    - ""
+  resources:
+    - serviceaccounts/token
+  verbs:
+    - create
+{{- end }}
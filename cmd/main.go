@@ -17,10 +17,12 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
@@ -31,6 +33,7 @@ import (
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
@@ -38,7 +41,22 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	tokenautappthrustiov1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	tokenautappthrustiov1beta1 "github.com/appthrust/tokenaut/api/v1beta1"
+	"github.com/appthrust/tokenaut/internal/audit"
+	"github.com/appthrust/tokenaut/internal/broker"
+	"github.com/appthrust/tokenaut/internal/cachescope"
 	"github.com/appthrust/tokenaut/internal/controller"
+	"github.com/appthrust/tokenaut/internal/githubmetrics"
+	"github.com/appthrust/tokenaut/internal/privatekey"
+	"github.com/appthrust/tokenaut/internal/ratelimit"
+	"github.com/appthrust/tokenaut/internal/remotecluster"
+	"github.com/appthrust/tokenaut/internal/sharding"
+	"github.com/appthrust/tokenaut/internal/signer"
+	"github.com/appthrust/tokenaut/internal/tracing"
+	"github.com/appthrust/tokenaut/internal/vaultkv"
+	"github.com/appthrust/tokenaut/internal/version"
+	"github.com/appthrust/tokenaut/pkg/githubapi"
+	"github.com/appthrust/tokenaut/pkg/githubappjwt"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -51,6 +69,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(tokenautappthrustiov1alpha1.AddToScheme(scheme))
+	utilruntime.Must(tokenautappthrustiov1beta1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -62,6 +81,40 @@ func main() {
 	var enableHTTP2 bool
 	var tlsOpts []func(*tls.Config)
 	var tokenRefreshInterval time.Duration
+	var brokerAddr string
+	var brokerCertFile string
+	var brokerInsecure bool
+	var brokerKeyFile string
+	var brokerAudiences string
+	var suspendAll bool
+	var jwtBackdate time.Duration
+	var jwtExpiration time.Duration
+	var signerKeyDir string
+	var vaultAddr string
+	var vaultNamespace string
+	var vaultTokenFile string
+	var vaultKubernetesAudience string
+	var pkcs11Module string
+	var pkcs11TokenLabel string
+	var pkcs11PINFile string
+	var privateKeyDefaults privatekey.Defaults
+	var strictPrivateKeySecrets bool
+	var remoteClusterSinks bool
+	var githubAPIURL string
+	var githubAPITimeout time.Duration
+	var logGitHubRequests bool
+	var tracingConfig tracing.Config
+	var auditLog string
+	var auditWebhookURL string
+	var auditWebhookQueueSize int
+	var enableConversionWebhook bool
+	var maxConcurrentReconciles int
+	var githubAppQPS float64
+	var githubAppBurst int
+	var shard string
+	var watchNamespaces string
+	var watchLabelSelector string
+	var secretLabelSelector string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
@@ -73,6 +126,85 @@ func main() {
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
 	flag.DurationVar(&tokenRefreshInterval, "token-refresh-interval", 50*time.Minute, "The interval at which to refresh the GitHub token")
+	flag.BoolVar(&suspendAll, "suspend-all", false, "If set, no InstallationAccessToken is refreshed and existing Secrets are left untouched, "+
+		"e.g. during a GitHub incident. Deletions are still processed.")
+	flag.StringVar(&brokerAddr, "broker-bind-address", "0", "The address the token broker binds to. "+
+		"Use e.g. :8082 to let pods exchange ServiceAccount tokens for GitHub tokens, or leave as 0 to disable the broker.")
+	flag.StringVar(&brokerCertFile, "broker-cert-file", "", "TLS certificate file for the token broker. "+
+		"The broker refuses to serve plain HTTP on a non-loopback address unless both --broker-cert-file and --broker-key-file "+
+		"or --broker-insecure are set.")
+	flag.BoolVar(&brokerInsecure, "broker-insecure", false,
+		"If set, the token broker serves plain HTTP on a non-loopback address when no certificate is set, exposing "+
+			"ServiceAccount and GitHub tokens to the network.")
+	flag.StringVar(&brokerKeyFile, "broker-key-file", "", "TLS private key file for the token broker.")
+	flag.StringVar(&brokerAudiences, "broker-audiences", broker.DefaultAudience,
+		"Comma-separated audiences a ServiceAccount token presented to the broker must be issued for.")
+	flag.StringVar(&githubAPIURL, "github-api-url", "",
+		"Base URL of the GitHub API, e.g. https://github.example.com/api/v3 for GitHub Enterprise Server. https://api.github.com when empty.")
+	flag.DurationVar(&githubAPITimeout, "github-api-timeout", githubapi.DefaultTimeout, "Timeout of each GitHub API request.")
+	flag.BoolVar(&logGitHubRequests, "log-github-requests", false,
+		"If set, every GitHub API request is logged with its status and duration at verbosity 1 (--zap-log-level=debug).")
+	flag.StringVar(&tracingConfig.Endpoint, "otlp-endpoint", "",
+		"host:port of the OTLP gRPC receiver to export traces of reconciles and GitHub API requests to. Tracing is disabled when empty.")
+	flag.BoolVar(&tracingConfig.Insecure, "otlp-insecure", false, "If set, traces are exported to the OTLP receiver without TLS.")
+	flag.Float64Var(&tracingConfig.SampleRatio, "trace-sample-ratio", 1, "Fraction of reconciles that are traced.")
+	flag.StringVar(&auditLog, "audit-log", "",
+		"File every token minted or deleted is appended to as a line of JSON, or - for stdout. The audit log is disabled when empty.")
+	flag.StringVar(&auditWebhookURL, "audit-webhook-url", "", "URL every audit event is additionally POSTed to as JSON.")
+	flag.IntVar(&auditWebhookQueueSize, "audit-webhook-queue-size", audit.DefaultQueueSize,
+		"How many audit events wait to be POSTed to the audit webhook before further events are dropped.")
+	flag.BoolVar(&enableConversionWebhook, "enable-conversion-webhook", false,
+		"If set, the webhook server converts InstallationAccessTokens between v1alpha1 and v1beta1. "+
+			"It needs a serving certificate in the webhook server's cert dir.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"How many resources of each kind are reconciled at once.")
+	flag.Float64Var(&githubAppQPS, "github-app-qps", 0,
+		"Tokens minted per second on average for each GitHub App before its resources are requeued, "+
+			"so that one app cannot starve the others. Unlimited when 0.")
+	flag.IntVar(&githubAppBurst, "github-app-burst", 10, "Tokens minted at once for each GitHub App when --github-app-qps is set.")
+	flag.StringVar(&shard, "shard", "",
+		"Only reconcile resources labeled "+tokenautappthrustiov1alpha1.ShardLabel+" with this value, electing a leader among the "+
+			"replicas of the same shard. Without it, only resources without the label are reconciled.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma-separated namespaces whose resources are watched and reconciled. Every namespace is watched when empty.")
+	flag.StringVar(&watchLabelSelector, "watch-label-selector", "",
+		"Only watch and reconcile resources and serve TokenBindings matching this label selector, e.g. team in (a,b).")
+	flag.StringVar(&secretLabelSelector, "secret-label-selector", "",
+		"Only cache and watch Secrets matching this label selector, e.g. tokenaut.appthrust.io/watch=true. "+
+			"Other Secrets are read from the API server when needed, and changes to them don't trigger a new token. "+
+			"Every Secret is cached when empty.")
+	flag.DurationVar(&jwtBackdate, "jwt-backdate", githubappjwt.DefaultBackdate,
+		"How far in the past the 'iat' claim of GitHub App JWTs is set, to tolerate a clock running ahead of GitHub's.")
+	flag.DurationVar(&jwtExpiration, "jwt-expiration", githubappjwt.DefaultExpiration,
+		"Lifetime of GitHub App JWTs used to mint tokens, capped at GitHub's 10-minute maximum.")
+	flag.StringVar(&signerKeyDir, "signer-key-dir", "",
+		"Directory holding PEM private keys for spec.signer.file. File signers are disabled when empty.")
+	flag.StringVar(&vaultAddr, "vault-address", os.Getenv("VAULT_ADDR"),
+		"Address of the Vault server used by spec.signer.vaultTransit and spec.sink.vaultKV. Both are disabled when empty.")
+	flag.StringVar(&vaultNamespace, "vault-namespace", os.Getenv("VAULT_NAMESPACE"), "Vault Enterprise namespace of the Transit secrets engine.")
+	flag.StringVar(&vaultTokenFile, "vault-token-file", "",
+		"File holding the Vault token, re-read on every request. The VAULT_TOKEN environment variable is used when empty.")
+	flag.StringVar(&vaultKubernetesAudience, "vault-kubernetes-audience", controller.DefaultVaultAudience,
+		"Audience of the ServiceAccount tokens presented to Vault's Kubernetes auth method by spec.sink.vaultKV.")
+	flag.StringVar(&pkcs11Module, "pkcs11-module", "",
+		"Path of the PKCS#11 module used by spec.signer.pkcs11. PKCS#11 signers are disabled when empty.")
+	flag.StringVar(&pkcs11TokenLabel, "pkcs11-token-label", "", "Label of the PKCS#11 token holding the private keys.")
+	flag.StringVar(&pkcs11PINFile, "pkcs11-pin-file", "", "File holding the user PIN of the PKCS#11 token.")
+	flag.StringVar(&privateKeyDefaults.Name, "default-private-key-name", privatekey.DefaultSecretName,
+		"Name of the private key Secret used when spec.privateKeyRef.name is omitted.")
+	flag.StringVar(&privateKeyDefaults.Namespace, "default-private-key-namespace", privatekey.DefaultSecretNamespace,
+		"Namespace of the private key Secret used when spec.privateKeyRef.namespace is omitted.")
+	flag.StringVar(&privateKeyDefaults.Key, "default-private-key-key", privatekey.DefaultSecretKey,
+		"Key in the private key Secret used when spec.privateKeyRef.key is omitted.")
+	flag.BoolVar(&privateKeyDefaults.SameNamespace, "default-private-key-same-namespace", false,
+		"If set, the private key Secret is looked up in the resource's own namespace when spec.privateKeyRef.namespace is omitted.")
+	flag.BoolVar(&privateKeyDefaults.Disabled, "disable-default-private-key", false,
+		"If set, spec.privateKeyRef must name the private key Secret and its namespace explicitly.")
+	flag.BoolVar(&strictPrivateKeySecrets, "strict-private-key-secrets", false,
+		"If set, private keys are only read from Secrets of type "+tokenautappthrustiov1alpha1.PrivateKeySecretType+
+			" whose "+tokenautappthrustiov1alpha1.AllowedNamespacesAnnotation+" annotation, if any, lists the resource's namespace.")
+	flag.BoolVar(&remoteClusterSinks, "remote-cluster-sinks", false,
+		"If set, spec.sink.remoteCluster may write Secrets into the clusters of kubeconfig Secrets in the resource's namespace.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -82,6 +214,35 @@ func main() {
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 	setupLog.Info(fmt.Sprintf("Token refresh interval set to %v", tokenRefreshInterval))
 
+	if err := sharding.Validate(shard); err != nil {
+		setupLog.Error(err, "unable to shard the manager")
+		os.Exit(1)
+	}
+	if shard != "" {
+		setupLog.Info("Reconciling a shard", "shard", shard)
+	}
+	scope := cachescope.Scope{Shard: shard}
+	var err error
+	if scope.Namespaces, err = cachescope.ParseNamespaces(watchNamespaces); err != nil {
+		setupLog.Error(err, "unable to parse --watch-namespaces")
+		os.Exit(1)
+	}
+	if scope.Selector, err = cachescope.ParseSelector(watchLabelSelector); err != nil {
+		setupLog.Error(err, "unable to parse --watch-label-selector")
+		os.Exit(1)
+	}
+	if scope.SecretSelector, err = cachescope.ParseSelector(secretLabelSelector); err != nil {
+		setupLog.Error(err, "unable to parse --secret-label-selector")
+		os.Exit(1)
+	}
+	if !privateKeyDefaults.Disabled && !privateKeyDefaults.SameNamespace {
+		// The default private key Secret usually lives outside the watched namespaces
+		scope.SecretNamespaces = []string{privateKeyDefaults.Namespace}
+	}
+	if len(scope.Namespaces) > 0 {
+		setupLog.Info("Watching namespaces", "namespaces", scope.Namespaces)
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
@@ -127,11 +288,13 @@ func main() {
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
+		Cache:                  scope.CacheOptions(),
+		Client:                 scope.ClientOptions(),
 		Metrics:                metricsServerOptions,
 		WebhookServer:          webhookServer,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "3ebf2d35.tokenaut.appthrust.io",
+		LeaderElectionID:       sharding.LeaderElectionID("3ebf2d35.tokenaut.appthrust.io", shard),
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -150,16 +313,162 @@ func main() {
 		os.Exit(1)
 	}
 
+	signers := &signer.Resolver{
+		KeyDir:             signerKeyDir,
+		PrivateKeyDefaults: &privateKeyDefaults,
+		StrictPrivateKeys:  strictPrivateKeySecrets,
+	}
+	if vaultAddr != "" {
+		signers.Vault = &signer.VaultClient{
+			Address:   vaultAddr,
+			Namespace: vaultNamespace,
+			TokenFile: vaultTokenFile,
+			Token:     os.Getenv("VAULT_TOKEN"),
+		}
+	}
+	var vaultKV *vaultkv.Client
+	if vaultAddr != "" {
+		vaultKV = &vaultkv.Client{Address: vaultAddr, Namespace: vaultNamespace}
+	}
+	if pkcs11Module != "" {
+		pin, err := os.ReadFile(pkcs11PINFile)
+		if err != nil {
+			setupLog.Error(err, "unable to read PKCS#11 PIN file")
+			os.Exit(1)
+		}
+		signers.PKCS11, err = signer.OpenPKCS11(pkcs11Module, pkcs11TokenLabel, strings.TrimSpace(string(pin)))
+		if err != nil {
+			setupLog.Error(err, "unable to open PKCS#11 token")
+			os.Exit(1)
+		}
+		defer signers.PKCS11.Close()
+	}
+
+	jwtOptions := []githubappjwt.Option{githubappjwt.WithBackdate(jwtBackdate)}
+	jwtCache := githubappjwt.NewCache(append(jwtOptions, githubappjwt.WithExpiration(jwtExpiration))...)
+
+	var remoteClients *remotecluster.Cache
+	if remoteClusterSinks {
+		remoteClients = remotecluster.NewCache(func(kubeconfig []byte) (client.Client, error) {
+			return remotecluster.NewClient(kubeconfig, mgr.GetScheme())
+		})
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracingConfig)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+
+	githubMiddleware := []githubapi.Middleware{tracing.Middleware(), githubmetrics.Middleware()}
+	if logGitHubRequests {
+		githubMiddleware = append(githubMiddleware, githubapi.Logging(ctrl.Log.WithName("github")))
+	}
+	githubClients := githubapi.NewProvider(githubapi.ProviderConfig{
+		Middleware: githubMiddleware,
+		UserAgent:  version.UserAgent(),
+		Timeout:    githubAPITimeout,
+	})
+	setupLog.Info("Using the GitHub API", "version", version.Version, "url", githubAPIURL)
+	appRateLimiter := ratelimit.NewPerApp(githubAppQPS, githubAppBurst)
+
+	var auditLogger *audit.Logger
+	if auditLog != "" || auditWebhookURL != "" {
+		auditLogger = &audit.Logger{}
+		switch auditLog {
+		case "":
+		case "-":
+			auditLogger.Sinks = append(auditLogger.Sinks, audit.NewWriterSink(os.Stdout))
+		default:
+			fileSink, err := audit.OpenFile(auditLog)
+			if err != nil {
+				setupLog.Error(err, "unable to open audit log", "path", auditLog)
+				os.Exit(1)
+			}
+			auditLogger.Sinks = append(auditLogger.Sinks, fileSink)
+		}
+		if auditWebhookURL != "" {
+			webhookSink := audit.NewAsyncSink(&audit.WebhookSink{URL: auditWebhookURL}, auditWebhookQueueSize)
+			if err := mgr.Add(webhookSink); err != nil {
+				setupLog.Error(err, "unable to set up the audit webhook")
+				os.Exit(1)
+			}
+			auditLogger.Sinks = append(auditLogger.Sinks, webhookSink)
+		}
+	}
+
 	if err = (&controller.InstallationAccessTokenReconciler{
-		Client:               mgr.GetClient(),
-		Scheme:               mgr.GetScheme(),
-		TokenRefreshInterval: tokenRefreshInterval,
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		TokenRefreshInterval:    tokenRefreshInterval,
+		SuspendAll:              suspendAll,
+		JWTCache:                jwtCache,
+		Signers:                 signers,
+		VaultKV:                 vaultKV,
+		VaultAudience:           vaultKubernetesAudience,
+		APIReader:               mgr.GetAPIReader(),
+		RemoteClients:           remoteClients,
+		GitHubAPIURL:            githubAPIURL,
+		GitHubClients:           githubClients,
+		Audit:                   auditLogger,
+		AppRateLimiter:          appRateLimiter,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "InstallationAccessToken")
 		os.Exit(1)
 	}
+	if err = (&controller.ActionsRunnerRegistrationTokenReconciler{
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		JWTCache:                jwtCache,
+		Signers:                 signers,
+		GitHubAPIURL:            githubAPIURL,
+		GitHubClients:           githubClients,
+		Audit:                   auditLogger,
+		AppRateLimiter:          appRateLimiter,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ActionsRunnerRegistrationToken")
+		os.Exit(1)
+	}
+	if err = (&controller.AppJWTReconciler{
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		JWTOptions:              jwtOptions,
+		Signers:                 signers,
+		Audit:                   auditLogger,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "AppJWT")
+		os.Exit(1)
+	}
+	if enableConversionWebhook {
+		if err = (&tokenautappthrustiov1alpha1.InstallationAccessToken{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "InstallationAccessToken")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
+	if brokerAddr != "0" {
+		if err = mgr.Add(&broker.Server{
+			Client:         mgr.GetClient(),
+			BindAddress:    brokerAddr,
+			CertFile:       brokerCertFile,
+			KeyFile:        brokerKeyFile,
+			Insecure:       brokerInsecure,
+			Audiences:      strings.Split(brokerAudiences, ","),
+			GitHub:         githubClients.Client(githubAPIURL),
+			JWTCache:       jwtCache,
+			Signers:        signers,
+			Audit:          auditLogger,
+			AppRateLimiter: appRateLimiter,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up token broker")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -170,7 +479,11 @@ func main() {
 	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	err = mgr.Start(ctrl.SetupSignalHandler())
+	if err := shutdownTracing(context.Background()); err != nil {
+		setupLog.Error(err, "unable to flush traces")
+	}
+	if err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
@@ -0,0 +1,57 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command tokenaut-git-credential is a git credential helper that supplies GitHub
+// installation access tokens from a mounted token file or the tokenaut broker.
+//
+//	git config --global credential.helper "/usr/local/bin/tokenaut-git-credential --token-file=/var/run/secrets/github/token"
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/appthrust/tokenaut/internal/gitcredential"
+)
+
+func main() {
+	var hosts string
+	helper := &gitcredential.Helper{}
+	flag.StringVar(&hosts, "hosts", "github.com", "Comma-separated hosts to provide credentials for, e.g. github.com,ghe.example.com")
+	flag.StringVar(&helper.TokenFile, "token-file", os.Getenv("TOKENAUT_TOKEN_FILE"),
+		"File containing the token, e.g. a mounted key of a Secret managed by an InstallationAccessToken.")
+	flag.StringVar(&helper.BrokerURL, "broker-url", os.Getenv("TOKENAUT_BROKER_URL"),
+		"Base URL of the tokenaut token broker. Used when --token-file is not set.")
+	flag.StringVar(&helper.ServiceAccountTokenFile, "service-account-token-file", "/var/run/secrets/tokenaut/token",
+		"Projected ServiceAccount token presented to the broker.")
+	flag.StringVar(&helper.Binding, "binding", os.Getenv("TOKENAUT_BINDING"),
+		"Name of the TokenBinding to use when several bind the ServiceAccount.")
+	flag.StringVar(&helper.BrokerCAFile, "broker-ca-file", "", "CA bundle used to verify the broker's TLS certificate.")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: tokenaut-git-credential [flags] <get|store|erase>")
+		os.Exit(2)
+	}
+	helper.Hosts = strings.Split(hosts, ",")
+
+	if err := helper.Run(flag.Arg(0), os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "tokenaut-git-credential: %v\n", err)
+		os.Exit(1)
+	}
+}
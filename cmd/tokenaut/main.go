@@ -0,0 +1,192 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command tokenaut holds developer tools for tokenaut.
+//
+//	tokenaut fake-github --config fake-github.yaml
+//
+// serves a fake GitHub API, so that the manager can be run offline with --github-api-url.
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/cockroachdb/errors"
+	"sigs.k8s.io/yaml"
+
+	"github.com/appthrust/tokenaut/pkg/githubapi/fakegithub"
+)
+
+const usage = `Usage: tokenaut <command> [flags]
+
+Commands:
+  fake-github   Serve a fake GitHub API for running the manager offline
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "fake-github":
+		err = runFakeGitHub(os.Args[2:])
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// fakeGitHubConfig is the file passed to "tokenaut fake-github --config"
+type fakeGitHubConfig struct {
+	Apps []struct {
+		ID       int    `json:"id"`
+		Slug     string `json:"slug"`
+		Name     string `json:"name"`
+		ClientID string `json:"clientId"`
+		// KeyFiles are PEM encoded public keys, or the private keys themselves, of the app
+		KeyFiles []string `json:"keyFiles"`
+	} `json:"apps"`
+	Installations []struct {
+		ID              int               `json:"id"`
+		AppID           int               `json:"appId"`
+		Account         string            `json:"account"`
+		Permissions     map[string]string `json:"permissions"`
+		AllRepositories bool              `json:"allRepositories"`
+		Repositories    []struct {
+			ID      int    `json:"id"`
+			Name    string `json:"name"`
+			Private bool   `json:"private"`
+		} `json:"repositories"`
+		Suspended bool `json:"suspended"`
+	} `json:"installations"`
+}
+
+func runFakeGitHub(args []string) error {
+	fs := flag.NewFlagSet("fake-github", flag.ContinueOnError)
+	var bindAddress, configFile string
+	var rateLimit int
+	fs.StringVar(&bindAddress, "bind-address", ":8090", "The address the fake GitHub API binds to.")
+	fs.StringVar(&configFile, "config", "", "File listing the apps and installations to serve.")
+	fs.IntVar(&rateLimit, "rate-limit", fakegithub.DefaultRateLimit, "Requests per hour allowed for each app and installation.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if configFile == "" {
+		return errors.New("--config is required")
+	}
+	server, err := loadFakeGitHub(configFile)
+	if err != nil {
+		return err
+	}
+	server.RateLimit = rateLimit
+
+	fmt.Fprintf(os.Stderr, "Serving a fake GitHub API on %s; start the manager with --github-api-url=http://<host>%s\n", bindAddress, bindAddress)
+	return http.ListenAndServe(bindAddress, server)
+}
+
+// loadFakeGitHub returns a fake GitHub API serving the apps and installations of the config file
+func loadFakeGitHub(configFile string) (*fakegithub.Server, error) {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, errors.Errorf("failed to read config: %v", err)
+	}
+	var config fakeGitHubConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, errors.Errorf("failed to parse config %s: %v", configFile, err)
+	}
+
+	server := fakegithub.New()
+	for _, a := range config.Apps {
+		app := fakegithub.App{ID: a.ID, Slug: a.Slug, Name: a.Name, ClientID: a.ClientID}
+		for _, keyFile := range a.KeyFiles {
+			key, err := readPublicKey(keyFile)
+			if err != nil {
+				return nil, err
+			}
+			app.PublicKeys = append(app.PublicKeys, key)
+		}
+		server.AddApp(app)
+	}
+	for _, i := range config.Installations {
+		installation := fakegithub.Installation{
+			ID:              i.ID,
+			AppID:           i.AppID,
+			Account:         i.Account,
+			Permissions:     i.Permissions,
+			AllRepositories: i.AllRepositories,
+			Suspended:       i.Suspended,
+		}
+		for _, repo := range i.Repositories {
+			installation.Repositories = append(installation.Repositories, fakegithub.Repository{ID: repo.ID, Name: repo.Name, Private: repo.Private})
+		}
+		server.AddInstallation(installation)
+	}
+	return server, nil
+}
+
+// readPublicKey reads an RSA public key from a PEM file holding either the public key or the private key
+func readPublicKey(file string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Errorf("failed to read key file: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.Errorf("no PEM data found in %s", file)
+	}
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, errors.Errorf("unsupported PEM block %q in %s", block.Type, file)
+	}
+	if err != nil {
+		return nil, errors.Errorf("failed to parse key in %s: %v", file, err)
+	}
+	if signer, ok := key.(crypto.Signer); ok {
+		key = signer.Public()
+	}
+	pub, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.Errorf("expected an RSA key in %s, got %T", file, key)
+	}
+	return pub, nil
+}
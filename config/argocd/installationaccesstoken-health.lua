@@ -0,0 +1,54 @@
+-- Argo CD health check for tokenaut.appthrust.io/InstallationAccessToken.
+-- Register it in argocd-cm as resource.customizations.health.tokenaut.appthrust.io_InstallationAccessToken.
+local hs = {status = "Progressing", message = "Waiting for the token to be issued"}
+if obj.status == nil then
+  return hs
+end
+if obj.status.observedGeneration == nil or obj.status.observedGeneration < obj.metadata.generation then
+  hs.message = "Waiting for the latest spec to be reconciled"
+  return hs
+end
+
+local conditions = {}
+for _, condition in ipairs(obj.status.conditions or {}) do
+  conditions[condition.type] = condition
+end
+
+if conditions.Stalled ~= nil and conditions.Stalled.status == "True" then
+  hs.status = "Degraded"
+  hs.message = conditions.Stalled.message
+  return hs
+end
+-- status.tokenValid is only updated when the controller reconciles, so compare the expiry with the current time
+local expiresAt = nil
+if obj.status.token ~= nil then
+  expiresAt = obj.status.token.expiresAt
+end
+if expiresAt == nil then
+  hs.status = "Degraded"
+  hs.message = "No token has been issued"
+  return hs
+end
+local year, month, day, hour, min, sec = string.match(expiresAt, "^(%d+)-(%d+)-(%d+)T(%d+):(%d+):(%d+)")
+-- os.date("!*t") is the current time in UTC, which os.time converts like the expiry whatever the time zone of Argo CD
+local expires = os.time({year = tonumber(year), month = tonumber(month), day = tonumber(day), hour = tonumber(hour), min = tonumber(min), sec = tonumber(sec)})
+if os.time(os.date("!*t")) >= expires then
+  hs.status = "Degraded"
+  hs.message = "The token expired at " .. expiresAt
+  return hs
+end
+if conditions.Suspended ~= nil and conditions.Suspended.status == "True" then
+  hs.status = "Suspended"
+  hs.message = conditions.Suspended.message
+  return hs
+end
+if conditions.Reconciling ~= nil and conditions.Reconciling.status == "True" then
+  hs.message = conditions.Reconciling.message
+  return hs
+end
+if conditions.Ready ~= nil and conditions.Ready.status == "True" then
+  hs.status = "Healthy"
+  hs.message = "The token is valid until " .. expiresAt
+  return hs
+end
+return hs
@@ -0,0 +1,285 @@
+// Package audit records every token tokenaut hands out or deletes as an append-only stream of JSON events,
+// to answer who got a token for which repositories, when and with what permissions.
+// Tokens themselves are never recorded, only a prefix of their SHA-256 hash to correlate events.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/appthrust/tokenaut/pkg/githubapi"
+)
+
+const (
+	// ActionMint is recorded when a new token is created at GitHub, or an app JWT is signed and published
+	ActionMint = "mint"
+	// ActionReuse is recorded when the token broker hands out a token it minted earlier
+	ActionReuse = "reuse"
+	// ActionDelete is recorded when a token is deleted from where it was written. GitHub keeps it valid until it expires.
+	ActionDelete = "delete"
+
+	tokenHashLength = 16
+
+	// DefaultQueueSize is how many events an AsyncSink holds while its sink is slow or down
+	DefaultQueueSize = 1000
+
+	// drainTimeout bounds how long an AsyncSink keeps writing queued events after it was stopped
+	drainTimeout = 10 * time.Second
+)
+
+// Event is a single audit record
+type Event struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+
+	// Kind, Namespace, Name and UID identify the resource the token was issued for
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid,omitempty"`
+
+	// RequestedBy is the field manager that last changed the resource's spec,
+	// or the ServiceAccount that requested a token from the broker
+	RequestedBy string `json:"requestedBy,omitempty"`
+
+	AppID          string `json:"appId,omitempty"`
+	InstallationID string `json:"installationId,omitempty"`
+
+	// Permissions, RepositorySelection and Repositories are what GitHub granted the token
+	Permissions         map[string]string `json:"permissions,omitempty"`
+	RepositorySelection string            `json:"repositorySelection,omitempty"`
+	Repositories        []string          `json:"repositories,omitempty"`
+
+	// TokenHash is a prefix of the hex SHA-256 hash of the token
+	TokenHash string     `json:"tokenHash,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	// Targets are where the token was written, e.g. "Secret default/my-token"
+	Targets []string `json:"targets,omitempty"`
+
+	// Error is set when the token was minted but could not be written to its targets
+	Error string `json:"error,omitempty"`
+}
+
+// SetAccessToken fills in the installation access token GitHub granted
+func (e *Event) SetAccessToken(resp *githubapi.AccessTokenResponse) {
+	e.Permissions = resp.Permissions
+	e.RepositorySelection = resp.RepositorySelection
+	e.Repositories = nil
+	for _, repo := range resp.Repositories {
+		e.Repositories = append(e.Repositories, repo.Name)
+	}
+	e.TokenHash = TokenHash(resp.Token)
+	expiresAt := resp.ExpiresAt
+	e.ExpiresAt = &expiresAt
+}
+
+// TokenHash returns the hash prefix recorded for a token in Event.TokenHash
+func TokenHash(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(sum[:])[:tokenHashLength]
+}
+
+// SpecManager returns the field manager of the most recent managedFields entry that owns fields of the spec,
+// i.e. who last asked for the token to look the way it does
+func SpecManager(obj metav1.Object) string {
+	var manager string
+	var latest time.Time
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Subresource != "" || entry.FieldsV1 == nil || !bytes.Contains(entry.FieldsV1.Raw, []byte(`"f:spec"`)) {
+			continue
+		}
+		var t time.Time
+		if entry.Time != nil {
+			t = entry.Time.Time
+		}
+		if manager == "" || !t.Before(latest) {
+			manager = entry.Manager
+			latest = t
+		}
+	}
+	return manager
+}
+
+// Sink stores audit events
+type Sink interface {
+	Write(ctx context.Context, event Event) error
+}
+
+// Logger records events to its sinks. A nil *Logger records nothing.
+type Logger struct {
+	Sinks []Sink
+
+	// Now replaces time.Now, e.g. in tests
+	Now func() time.Time
+}
+
+// Record stamps the event with the current time and writes it to every sink.
+// Failing sinks are logged rather than failing the token issuance they record.
+func (l *Logger) Record(ctx context.Context, event Event) {
+	if l == nil {
+		return
+	}
+	now := time.Now
+	if l.Now != nil {
+		now = l.Now
+	}
+	event.Time = now().UTC()
+	for _, sink := range l.Sinks {
+		if err := sink.Write(ctx, event); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to write audit event", "action", event.Action,
+				"kind", event.Kind, "namespace", event.Namespace, "name", event.Name)
+		}
+	}
+}
+
+// WriterSink writes each event as a line of JSON
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink returns a sink writing JSON lines to w, e.g. os.Stdout
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// OpenFile returns a sink appending JSON lines to the file at path, creating it when missing
+func OpenFile(path string) (*WriterSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, errors.Errorf("failed to open the audit log: %v", err)
+	}
+	return NewWriterSink(f), nil
+}
+
+func (s *WriterSink) Write(_ context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(line)
+	return err
+}
+
+// WebhookSink posts each event as JSON to a URL
+type WebhookSink struct {
+	URL string
+
+	// Client sends the requests; one with a 10 second timeout when nil
+	Client *http.Client
+}
+
+func (s *WebhookSink) Write(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Errorf("error sending the audit event: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("the audit webhook answered with status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// errQueueFull is returned by AsyncSink.Write when the event is dropped
+var errQueueFull = errors.New("the audit event queue is full; dropping the event")
+
+// AsyncSink writes events to another sink in the background, so that a slow or unreachable sink such as a
+// webhook does not hold up the token issuance the events record. At most a bounded number of events wait to
+// be written; further events are dropped and reported by Write. It is a manager.Runnable writing until stopped.
+type AsyncSink struct {
+	sink  Sink
+	queue chan Event
+}
+
+// NewAsyncSink returns a sink queueing up to queueSize events for sink, DefaultQueueSize when not positive
+func NewAsyncSink(sink Sink, queueSize int) *AsyncSink {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	return &AsyncSink{sink: sink, queue: make(chan Event, queueSize)}
+}
+
+// Write queues the event without waiting for it to be written
+func (s *AsyncSink) Write(_ context.Context, event Event) error {
+	select {
+	case s.queue <- event:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+// Start writes queued events until ctx is done, then tries to write the events still queued for a short while
+func (s *AsyncSink) Start(ctx context.Context) error {
+	for {
+		select {
+		case event := <-s.queue:
+			s.write(ctx, event)
+		case <-ctx.Done():
+			s.drain()
+			return nil
+		}
+	}
+}
+
+// NeedLeaderElection runs the sink on every replica, as every replica may record events, e.g. in the token broker
+func (s *AsyncSink) NeedLeaderElection() bool {
+	return false
+}
+
+// drain writes the queued events until the queue is empty or drainTimeout passed
+func (s *AsyncSink) drain() {
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	for ctx.Err() == nil {
+		select {
+		case event := <-s.queue:
+			s.write(ctx, event)
+		default:
+			return
+		}
+	}
+}
+
+func (s *AsyncSink) write(ctx context.Context, event Event) {
+	if err := s.sink.Write(ctx, event); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to write audit event", "action", event.Action,
+			"kind", event.Kind, "namespace", event.Namespace, "name", event.Name)
+	}
+}
@@ -0,0 +1,213 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/appthrust/tokenaut/pkg/githubapi"
+)
+
+func TestTokenHash(t *testing.T) {
+	hash := TokenHash("ghs_secret")
+	if !strings.HasPrefix(hash, "sha256:") || len(hash) != len("sha256:")+tokenHashLength {
+		t.Errorf("Unexpected hash %q", hash)
+	}
+	if strings.Contains(hash, "ghs_secret") {
+		t.Errorf("The hash %q contains the token", hash)
+	}
+	if hash != TokenHash("ghs_secret") {
+		t.Error("Expected the hash to be stable")
+	}
+	if TokenHash("") != "" {
+		t.Error("Expected no hash for an empty token")
+	}
+}
+
+func TestSpecManager(t *testing.T) {
+	at := func(minute int) *metav1.Time {
+		ts := metav1.NewTime(time.Date(2026, 10, 19, 9, minute, 0, 0, time.UTC))
+		return &ts
+	}
+	fields := func(raw string) *metav1.FieldsV1 {
+		return &metav1.FieldsV1{Raw: []byte(raw)}
+	}
+	obj := &metav1.ObjectMeta{ManagedFields: []metav1.ManagedFieldsEntry{
+		{Manager: "kubectl-client-side-apply", Time: at(0), FieldsV1: fields(`{"f:spec":{"f:appId":{}}}`)},
+		{Manager: "argocd-controller", Time: at(5), FieldsV1: fields(`{"f:spec":{"f:installationId":{}}}`)},
+		{Manager: "tokenaut", Time: at(10), FieldsV1: fields(`{"f:metadata":{"f:finalizers":{}}}`)},
+		{Manager: "tokenaut", Time: at(15), Subresource: "status", FieldsV1: fields(`{"f:status":{"f:spec":{}}}`)},
+	}}
+	if got := SpecManager(obj); got != "argocd-controller" {
+		t.Errorf("Expected argocd-controller, got %q", got)
+	}
+	if got := SpecManager(&metav1.ObjectMeta{}); got != "" {
+		t.Errorf("Expected no manager, got %q", got)
+	}
+}
+
+func TestLoggerWritesJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.FixedZone("JST", 9*60*60))
+	logger := &Logger{Sinks: []Sink{NewWriterSink(&buf)}, Now: func() time.Time { return now }}
+
+	event := Event{Action: ActionMint, Kind: "InstallationAccessToken", Namespace: "ci", Name: "github-token"}
+	event.SetAccessToken(&githubapi.AccessTokenResponse{
+		Token:               "ghs_secret",
+		ExpiresAt:           now.Add(time.Hour),
+		Permissions:         map[string]string{"contents": "read"},
+		RepositorySelection: "selected",
+		Repositories:        []githubapi.Repository{{Name: "app"}},
+	})
+	logger.Record(context.Background(), event)
+	logger.Record(context.Background(), Event{Action: ActionDelete, Kind: "InstallationAccessToken", Namespace: "ci", Name: "github-token"})
+
+	if strings.Contains(buf.String(), "ghs_secret") {
+		t.Fatalf("The audit log contains the token: %s", buf.String())
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d: %s", len(lines), buf.String())
+	}
+	var got Event
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !got.Time.Equal(now) || got.Time.Location() != time.UTC {
+		t.Errorf("Expected the time %v in UTC, got %v", now, got.Time)
+	}
+	if got.TokenHash != TokenHash("ghs_secret") || got.Permissions["contents"] != "read" ||
+		got.RepositorySelection != "selected" || len(got.Repositories) != 1 || got.Repositories[0] != "app" {
+		t.Errorf("Unexpected event %+v", got)
+	}
+	if got.ExpiresAt == nil || !got.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("Unexpected expiry %v", got.ExpiresAt)
+	}
+	if strings.Contains(lines[1], "tokenHash") || strings.Contains(lines[1], "expiresAt") {
+		t.Errorf("Expected empty fields to be omitted: %s", lines[1])
+	}
+
+	var nilLogger *Logger
+	nilLogger.Record(context.Background(), event)
+}
+
+func TestOpenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i := 0; i < 2; i++ {
+		sink, err := OpenFile(path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := sink.Write(context.Background(), Event{Action: ActionMint}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+	content, _ := os.ReadFile(path)
+	if lines := strings.Count(string(content), "\n"); lines != 2 {
+		t.Errorf("Expected 2 appended lines, got %d", lines)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received Event
+	status := http.StatusAccepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := &WebhookSink{URL: server.URL}
+	if err := sink.Write(context.Background(), Event{Action: ActionMint, Name: "github-token"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if received.Action != ActionMint || received.Name != "github-token" {
+		t.Errorf("Unexpected event %+v", received)
+	}
+
+	status = http.StatusInternalServerError
+	if err := sink.Write(context.Background(), Event{Action: ActionMint}); err == nil {
+		t.Error("Expected an error for a failing webhook")
+	}
+}
+
+// blockingSink records events once release is closed
+type blockingSink struct {
+	release chan struct{}
+	mu      sync.Mutex
+	events  []Event
+}
+
+func (s *blockingSink) Write(_ context.Context, event Event) error {
+	<-s.release
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *blockingSink) written() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events)
+}
+
+func TestAsyncSink(t *testing.T) {
+	blocking := &blockingSink{release: make(chan struct{})}
+	sink := NewAsyncSink(blocking, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- sink.Start(ctx) }()
+
+	// The first event is taken by the writer, which blocks; two more fill the queue
+	if err := sink.Write(context.Background(), Event{Name: "first"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sink.queue) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, name := range []string{"second", "third"} {
+		if err := sink.Write(context.Background(), Event{Name: name}); err != nil {
+			t.Fatalf("Expected %s to be queued, got %v", name, err)
+		}
+	}
+	if err := sink.Write(context.Background(), Event{Name: "dropped"}); err == nil {
+		t.Error("Expected an error for a full queue")
+	}
+
+	// Queued events are still written once stopped
+	cancel()
+	close(blocking.release)
+	if err := <-done; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := blocking.written(); got != 3 {
+		t.Errorf("Expected 3 events to be written, got %d", got)
+	}
+	if sink.NeedLeaderElection() {
+		t.Error("Expected the sink to run on every replica")
+	}
+}
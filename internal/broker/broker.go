@@ -0,0 +1,352 @@
+package broker
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	"github.com/appthrust/tokenaut/internal/audit"
+	"github.com/appthrust/tokenaut/internal/ratelimit"
+	"github.com/appthrust/tokenaut/internal/signer"
+	"github.com/appthrust/tokenaut/pkg/brokerapi"
+	"github.com/appthrust/tokenaut/pkg/githubapi"
+	"github.com/appthrust/tokenaut/pkg/githubappjwt"
+)
+
+const (
+	// DefaultAudience is the audience projected ServiceAccount tokens must be issued for
+	DefaultAudience = "tokenaut"
+
+	// DefaultMinTokenTTL is the remaining lifetime below which a cached token is not handed out again
+	DefaultMinTokenTTL = 10 * time.Minute
+
+	// maxRequestBodySize caps the token request read before the caller is authenticated. It only names a binding.
+	maxRequestBodySize = 4 << 10
+
+	serviceAccountUsernamePrefix = "system:serviceaccount:"
+)
+
+// Server exchanges projected ServiceAccount tokens for scoped GitHub installation access tokens
+type Server struct {
+	Client client.Client
+
+	// BindAddress is the address the broker listens on
+	BindAddress string
+
+	// CertFile and KeyFile enable TLS when both are set
+	CertFile string
+	KeyFile  string
+
+	// Insecure allows serving plain HTTP on an address other than loopback, which exposes the
+	// ServiceAccount tokens presented to the broker to anyone on the network path
+	Insecure bool
+
+	// Audiences the presented ServiceAccount token must be valid for
+	Audiences []string
+
+	// MinTokenTTL is the remaining lifetime below which a cached token is replaced
+	MinTokenTTL time.Duration
+
+	// GitHub is the client used to create installation access tokens
+	GitHub *githubapi.Client
+
+	// JWTCache reuses app JWTs across requests; nil signs a new JWT every time
+	JWTCache *githubappjwt.Cache
+
+	// Signers resolves spec.signer of TokenBindings; nil only supports private key Secrets
+	Signers *signer.Resolver
+
+	// Audit records every token handed out; nil records nothing
+	Audit *audit.Logger
+
+	// AppRateLimiter holds requests that need a new token while their app is over its budget; nil does not limit
+	AppRateLimiter *ratelimit.PerApp
+
+	cache tokenCache
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Every replica serves the broker.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable
+func (s *Server) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("broker")
+
+	tls := s.CertFile != "" && s.KeyFile != ""
+	if !tls && !isLoopback(s.BindAddress) {
+		if !s.Insecure {
+			return errors.Errorf("refusing to serve the token broker on \"%s\" without TLS; set a certificate and key, or allow plain HTTP explicitly", s.BindAddress)
+		}
+		log.Info("WARNING: the token broker serves plain HTTP, so ServiceAccount and GitHub tokens cross the network unencrypted", "address", s.BindAddress)
+	}
+
+	srv := &http.Server{
+		Addr:              s.BindAddress,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Error(err, "Failed to shut down token broker")
+		}
+	}()
+
+	log.Info("Starting token broker", "address", s.BindAddress, "tls", tls)
+	var err error
+	if tls {
+		err = srv.ListenAndServeTLS(s.CertFile, s.KeyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return errors.Errorf("token broker stopped: %v", err)
+	}
+	return nil
+}
+
+// isLoopback reports whether addr only accepts connections from the same host
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Handler returns the HTTP handler serving the broker endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(brokerapi.TokenPath, s.handleToken)
+	return mux
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := log.FromContext(ctx).WithName("broker")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	saToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || saToken == "" {
+		http.Error(w, "missing bearer token", http.StatusUnauthorized)
+		return
+	}
+
+	var tokenReq brokerapi.TokenRequest
+	if r.ContentLength != 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+		if err := json.NewDecoder(r.Body).Decode(&tokenReq); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	namespace, serviceAccount, err := s.authenticate(ctx, saToken)
+	if err != nil {
+		log.Info("Rejected token request", "reason", err.Error())
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	log = log.WithValues("namespace", namespace, "serviceAccount", serviceAccount)
+
+	binding, status, err := s.findBinding(ctx, namespace, serviceAccount, tokenReq.Binding)
+	if err != nil {
+		log.Info("No usable TokenBinding", "reason", err.Error())
+		http.Error(w, err.Error(), status)
+		return
+	}
+	log = log.WithValues("binding", binding.Name)
+
+	tokenResp, minted, err := s.issue(ctx, binding)
+	if err != nil {
+		log.Error(err, "Failed to issue installation access token")
+		http.Error(w, "failed to issue token", http.StatusBadGateway)
+		return
+	}
+	log.Info("Issued installation access token", "expiresAt", tokenResp.ExpiresAt)
+	action := audit.ActionReuse
+	if minted {
+		action = audit.ActionMint
+	}
+	event := audit.Event{
+		Action:         action,
+		Kind:           "TokenBinding",
+		Namespace:      binding.Namespace,
+		Name:           binding.Name,
+		UID:            binding.UID,
+		RequestedBy:    serviceAccountUsernamePrefix + namespace + ":" + serviceAccount,
+		AppID:          binding.Spec.AppID,
+		InstallationID: binding.Spec.InstallationID,
+	}
+	event.SetAccessToken(tokenResp)
+	s.Audit.Record(ctx, event)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(brokerapi.TokenResponse{
+		Token:               tokenResp.Token,
+		ExpiresAt:           tokenResp.ExpiresAt,
+		Permissions:         tokenResp.Permissions,
+		RepositorySelection: tokenResp.RepositorySelection,
+	}); err != nil {
+		log.Error(err, "Failed to write token response")
+	}
+}
+
+// authenticate validates the ServiceAccount token with a TokenReview and returns its namespace and name
+func (s *Server) authenticate(ctx context.Context, saToken string) (string, string, error) {
+	audiences := s.Audiences
+	if len(audiences) == 0 {
+		audiences = []string{DefaultAudience}
+	}
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     saToken,
+			Audiences: audiences,
+		},
+	}
+	if err := s.Client.Create(ctx, review); err != nil {
+		return "", "", errors.Errorf("failed to create TokenReview: %v", err)
+	}
+	if !review.Status.Authenticated {
+		return "", "", errors.Errorf("token was not authenticated: %s", review.Status.Error)
+	}
+
+	username, ok := strings.CutPrefix(review.Status.User.Username, serviceAccountUsernamePrefix)
+	if !ok {
+		return "", "", errors.Errorf("user \"%s\" is not a ServiceAccount", review.Status.User.Username)
+	}
+	namespace, name, ok := strings.Cut(username, ":")
+	if !ok || namespace == "" || name == "" {
+		return "", "", errors.Errorf("malformed ServiceAccount username \"%s\"", review.Status.User.Username)
+	}
+	return namespace, name, nil
+}
+
+// findBinding returns the TokenBinding in the ServiceAccount's namespace that grants it a token
+func (s *Server) findBinding(ctx context.Context, namespace, serviceAccount, name string) (*tokenautv1alpha1.TokenBinding, int, error) {
+	var bindings tokenautv1alpha1.TokenBindingList
+	if err := s.Client.List(ctx, &bindings, client.InNamespace(namespace)); err != nil {
+		return nil, http.StatusInternalServerError, errors.Errorf("failed to list TokenBindings: %v", err)
+	}
+
+	var matched []*tokenautv1alpha1.TokenBinding
+	for i := range bindings.Items {
+		binding := &bindings.Items[i]
+		if name != "" && binding.Name != name {
+			continue
+		}
+		for _, sa := range binding.Spec.ServiceAccounts {
+			if sa == serviceAccount {
+				matched = append(matched, binding)
+				break
+			}
+		}
+	}
+
+	switch len(matched) {
+	case 0:
+		return nil, http.StatusForbidden, errors.Errorf("no TokenBinding grants a token to this ServiceAccount")
+	case 1:
+		return matched[0], http.StatusOK, nil
+	default:
+		return nil, http.StatusConflict, errors.Errorf("%d TokenBindings match this ServiceAccount; select one with the \"binding\" field", len(matched))
+	}
+}
+
+// issue returns a cached token for the binding, or mints a new one when none is fresh enough.
+// minted reports whether the token is new; requests that waited for another one to mint it reuse the token.
+func (s *Server) issue(ctx context.Context, binding *tokenautv1alpha1.TokenBinding) (_ *githubapi.AccessTokenResponse, minted bool, err error) {
+	minTTL := s.MinTokenTTL
+	if minTTL == 0 {
+		minTTL = DefaultMinTokenTTL
+	}
+	key := cacheKey{namespace: binding.Namespace, name: binding.Name, uid: binding.UID, generation: binding.Generation}
+	if cached := s.cache.get(key, minTTL); cached != nil {
+		return cached, false, nil
+	}
+
+	// The token is minted within the context of the first request; the others get its error if it is cancelled
+	tokenResp, err, _ := s.cache.minting.Do(key.String(), func() (interface{}, error) {
+		// Another request may have stored a token between the lookup and this call
+		if cached := s.cache.get(key, minTTL); cached != nil {
+			return cached, nil
+		}
+		tokenResp, err := s.mint(ctx, binding)
+		if err != nil {
+			return nil, err
+		}
+		minted = true
+		s.cache.put(key, tokenResp)
+		return tokenResp, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return tokenResp.(*githubapi.AccessTokenResponse), minted, nil
+}
+
+// mint creates a new installation access token for the binding
+func (s *Server) mint(ctx context.Context, binding *tokenautv1alpha1.TokenBinding) (*githubapi.AccessTokenResponse, error) {
+	if err := s.AppRateLimiter.Wait(ctx, binding.Spec.AppID); err != nil {
+		return nil, errors.Errorf("failed to wait for the app's rate limit: %v", err)
+	}
+
+	keySigners, err := s.Signers.ResolveAll(ctx, s.Client, binding.Namespace, binding.Spec.PrivateKeyRef, binding.Spec.PrivateKeyRefs, binding.Spec.Signer)
+	if err != nil {
+		return nil, err
+	}
+
+	githubClient := s.GitHub
+	if githubClient == nil {
+		githubClient = githubapi.NewClient(githubapi.ClientConfig{})
+	}
+	githubClient = githubClient.WithContext(ctx)
+	var tokenResp *githubapi.AccessTokenResponse
+	_, rejected, err := signer.Failover(keySigners, func(keySigner crypto.Signer) error {
+		jwt, err := s.JWTCache.GenerateContext(ctx, binding.Spec.AppID, keySigner)
+		if err != nil {
+			return err
+		}
+		tokenResp, err = githubClient.CreateScopedInstallationAccessToken(binding.Spec.InstallationID, jwt, githubapi.AccessTokenRequestFromScope(binding.Spec.Scope))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(rejected) > 0 {
+		log.FromContext(ctx).Info("GitHub rejected preferred private keys, using a fallback key", "rejectedKeys", rejected)
+	}
+	return tokenResp, nil
+}
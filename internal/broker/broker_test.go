@@ -0,0 +1,275 @@
+package broker
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	"github.com/appthrust/tokenaut/pkg/brokerapi"
+	"github.com/appthrust/tokenaut/pkg/githubapi"
+)
+
+// newTestServer returns a broker whose GitHub API counts token requests in githubCalls. When hold is set,
+// GitHub only answers once it is closed.
+func newTestServer(t *testing.T, githubCalls *atomic.Int32, hold <-chan struct{}) (*Server, func()) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate private key: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := tokenautv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "github-app-private-key", Namespace: "default"},
+				Data:       map[string][]byte{"privateKey": keyPEM},
+			},
+			&tokenautv1alpha1.TokenBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "ci", Namespace: "team-a"},
+				Spec: tokenautv1alpha1.TokenBindingSpec{
+					ServiceAccounts: []string{"builder"},
+					AppID:           "12345",
+					InstallationID:  "67890",
+					Scope: &tokenautv1alpha1.Scope{
+						Repositories: []string{"repo1"},
+					},
+				},
+			},
+		).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				review, ok := obj.(*authenticationv1.TokenReview)
+				if !ok {
+					return c.Create(ctx, obj, opts...)
+				}
+				switch review.Spec.Token {
+				case "builder-token":
+					review.Status.Authenticated = true
+					review.Status.User.Username = "system:serviceaccount:team-a:builder"
+				case "other-token":
+					review.Status.Authenticated = true
+					review.Status.User.Username = "system:serviceaccount:team-a:other"
+				default:
+					review.Status.Error = "invalid token"
+				}
+				return nil
+			},
+		}).
+		Build()
+
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		githubCalls.Add(1)
+		if hold != nil {
+			<-hold
+		}
+		if r.URL.Path != "/app/installations/67890/access_tokens" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		var body githubapi.AccessTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+		if len(body.Repositories) != 1 || body.Repositories[0] != "repo1" {
+			t.Errorf("Expected repositories [repo1], got %v", body.Repositories)
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(githubapi.AccessTokenResponse{
+			Token:     "ghs_test",
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+	}))
+
+	return &Server{
+		Client: c,
+		GitHub: githubapi.NewClient(githubapi.ClientConfig{BaseURL: github.URL}),
+	}, github.Close
+}
+
+func TestHandleToken(t *testing.T) {
+	var githubCalls atomic.Int32
+	server, cleanup := newTestServer(t, &githubCalls, nil)
+	defer cleanup()
+	handler := server.Handler()
+
+	testCases := []struct {
+		name       string
+		token      string
+		body       string
+		wantStatus int
+	}{
+		{"Missing bearer token", "", "", http.StatusUnauthorized},
+		{"Unauthenticated token", "bogus", "", http.StatusUnauthorized},
+		{"Unbound ServiceAccount", "other-token", "", http.StatusForbidden},
+		{"Unknown binding name", "builder-token", `{"binding":"nope"}`, http.StatusForbidden},
+		{"Bound ServiceAccount", "builder-token", "", http.StatusOK},
+		{"Bound ServiceAccount with binding name", "builder-token", `{"binding":"ci"}`, http.StatusOK},
+		{"Oversized body", "builder-token", `{"binding":"` + strings.Repeat("x", maxRequestBodySize) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, brokerapi.TokenPath, bytes.NewBufferString(tc.body))
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			var resp brokerapi.TokenResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Token != "ghs_test" {
+				t.Errorf("Expected token 'ghs_test', got %s", resp.Token)
+			}
+		})
+	}
+
+	if got := githubCalls.Load(); got != 1 {
+		t.Errorf("Expected the cached token to be reused, but GitHub was called %d times", got)
+	}
+}
+
+func TestHandleTokenRecreatedBinding(t *testing.T) {
+	var githubCalls atomic.Int32
+	server, cleanup := newTestServer(t, &githubCalls, nil)
+	defer cleanup()
+	handler := server.Handler()
+	ctx := context.Background()
+
+	request := func() {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, brokerapi.TokenPath, nil)
+		req.Header.Set("Authorization", "Bearer builder-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+	}
+
+	request()
+	var binding tokenautv1alpha1.TokenBinding
+	if err := server.Client.Get(ctx, client.ObjectKey{Namespace: "team-a", Name: "ci"}, &binding); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Client.Delete(ctx, &binding); err != nil {
+		t.Fatal(err)
+	}
+	recreated := &tokenautv1alpha1.TokenBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "ci", Namespace: "team-a", UID: "recreated", Generation: binding.Generation},
+		Spec:       binding.Spec,
+	}
+	if err := server.Client.Create(ctx, recreated); err != nil {
+		t.Fatal(err)
+	}
+	request()
+
+	if got := githubCalls.Load(); got != 2 {
+		t.Errorf("Expected a new token for the recreated TokenBinding, but GitHub was called %d times", got)
+	}
+}
+
+func TestHandleTokenConcurrentMisses(t *testing.T) {
+	var githubCalls atomic.Int32
+	hold := make(chan struct{})
+	server, cleanup := newTestServer(t, &githubCalls, hold)
+	defer cleanup()
+	releaseGitHub := sync.OnceFunc(func() { close(hold) })
+	defer releaseGitHub()
+	handler := server.Handler()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, brokerapi.TokenPath, nil)
+			req.Header.Set("Authorization", "Bearer builder-token")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+			}
+		}()
+	}
+
+	// Let the other requests miss the cache while the first token is being minted
+	for githubCalls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	releaseGitHub()
+	wg.Wait()
+
+	if got := githubCalls.Load(); got != 1 {
+		t.Errorf("Expected concurrent requests to share a single token, but GitHub was called %d times", got)
+	}
+}
+
+func TestStartRefusesPlainHTTP(t *testing.T) {
+	server := &Server{BindAddress: ":0"}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := server.Start(ctx); err == nil {
+		t.Error("Expected the broker to refuse plain HTTP on all interfaces")
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	testCases := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "127.0.0.1:8082", want: true},
+		{addr: "[::1]:8082", want: true},
+		{addr: "localhost:8082", want: true},
+		{addr: ":8082", want: false},
+		{addr: "0.0.0.0:8082", want: false},
+		{addr: "10.0.0.1:8082", want: false},
+		{addr: "8082", want: false},
+	}
+	for _, tc := range testCases {
+		if got := isLoopback(tc.addr); got != tc.want {
+			t.Errorf("Expected %v for %q, got %v", tc.want, tc.addr, got)
+		}
+	}
+}
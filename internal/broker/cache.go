@@ -0,0 +1,63 @@
+package broker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/appthrust/tokenaut/pkg/githubapi"
+)
+
+// cacheKey identifies a TokenBinding revision. A spec change bumps the generation and invalidates the cached token;
+// a TokenBinding recreated under the same name starts again at generation 1, but has a new UID.
+type cacheKey struct {
+	namespace  string
+	name       string
+	uid        types.UID
+	generation int64
+}
+
+func (k cacheKey) String() string {
+	return fmt.Sprintf("%s/%s/%s/%d", k.namespace, k.name, k.uid, k.generation)
+}
+
+// tokenCache keeps the last token minted per TokenBinding so that pods don't each consume GitHub's token quota
+type tokenCache struct {
+	mu      sync.Mutex
+	entries map[cacheKey]*githubapi.AccessTokenResponse
+
+	// minting makes concurrent requests missing the cache for the same TokenBinding wait for a single new token,
+	// e.g. when a scaled up Deployment starts its pods at once
+	minting singleflight.Group
+}
+
+func (c *tokenCache) get(key cacheKey, minTTL time.Duration) *githubapi.AccessTokenResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if time.Until(entry.ExpiresAt) < minTTL {
+		delete(c.entries, key)
+		return nil
+	}
+	return entry
+}
+
+func (c *tokenCache) put(key cacheKey, token *githubapi.AccessTokenResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[cacheKey]*githubapi.AccessTokenResponse)
+	}
+	for k := range c.entries {
+		if k.namespace == key.namespace && k.name == key.name {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = token
+}
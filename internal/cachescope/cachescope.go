@@ -0,0 +1,112 @@
+// Package cachescope limits the objects the manager caches, and therefore watches and reconciles, to some
+// namespaces, labels and shards, so that tokenaut needs less memory and less access on large clusters.
+package cachescope
+
+import (
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/appthrust/tokenaut/internal/sharding"
+)
+
+// Scope describes what the manager caches
+type Scope struct {
+	// Namespaces are the namespaces whose objects are cached; every namespace when empty
+	Namespaces []string
+
+	// Selector limits the resources tokenaut reconciles and the TokenBindings it serves; nil selects all
+	Selector labels.Selector
+
+	// Shard is the shard whose resources are reconciled (see package sharding)
+	Shard string
+
+	// SecretSelector limits the Secrets that are cached and watched for changes; nil caches every Secret
+	SecretSelector labels.Selector
+
+	// SecretNamespaces are cached for Secrets in addition to Namespaces, e.g. the namespace of the default
+	// private key Secret. They are ignored when Namespaces is empty.
+	SecretNamespaces []string
+}
+
+// CacheOptions returns the manager's cache options for the scope
+func (s Scope) CacheOptions() cache.Options {
+	opts := cache.Options{
+		DefaultLabelSelector: s.Selector,
+		ByObject:             map[client.Object]cache.ByObject{},
+	}
+	if len(s.Namespaces) > 0 {
+		opts.DefaultNamespaces = map[string]cache.Config{}
+		for _, namespace := range s.Namespaces {
+			opts.DefaultNamespaces[namespace] = cache.Config{}
+		}
+	}
+
+	shardSelector := sharding.Selector(s.Shard)
+	if s.Selector != nil {
+		requirements, _ := s.Selector.Requirements()
+		shardSelector = shardSelector.Add(requirements...)
+	}
+	for _, obj := range sharding.Objects() {
+		opts.ByObject[obj] = cache.ByObject{Label: shardSelector}
+	}
+
+	// Secrets are referenced by name, so the labels of the resources don't apply to them
+	secrets := cache.ByObject{Label: labels.Everything()}
+	if s.SecretSelector != nil {
+		secrets.Label = s.SecretSelector
+	}
+	if len(s.Namespaces) > 0 {
+		secrets.Namespaces = map[string]cache.Config{}
+		for _, namespaces := range [][]string{s.Namespaces, s.SecretNamespaces} {
+			for _, namespace := range namespaces {
+				secrets.Namespaces[namespace] = cache.Config{}
+			}
+		}
+	}
+	opts.ByObject[&corev1.Secret{}] = secrets
+	return opts
+}
+
+// ClientOptions returns the options of the manager's client for the scope. When only some Secrets are cached,
+// Secrets are read from the API server, so that a resource can still read a private key Secret outside of the
+// cache, e.g. in a namespace that isn't watched, as far as the manager's RBAC allows.
+func (s Scope) ClientOptions() client.Options {
+	if s.SecretSelector == nil && len(s.Namespaces) == 0 {
+		return client.Options{}
+	}
+	return client.Options{Cache: &client.CacheOptions{DisableFor: []client.Object{&corev1.Secret{}}}}
+}
+
+// ParseNamespaces parses a comma-separated list of namespaces, ignoring blanks
+func ParseNamespaces(s string) ([]string, error) {
+	var namespaces []string
+	for _, namespace := range strings.Split(s, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace == "" {
+			continue
+		}
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return nil, errors.Errorf("invalid namespace \"%s\": %s", namespace, strings.Join(errs, ", "))
+		}
+		namespaces = append(namespaces, namespace)
+	}
+	return namespaces, nil
+}
+
+// ParseSelector parses a label selector, returning nil when s is empty
+func ParseSelector(s string) (labels.Selector, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	selector, err := labels.Parse(s)
+	if err != nil {
+		return nil, errors.Errorf("invalid label selector \"%s\": %v", s, err)
+	}
+	return selector, nil
+}
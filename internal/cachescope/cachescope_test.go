@@ -0,0 +1,139 @@
+package cachescope
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+)
+
+func byObject(t *testing.T, opts cache.Options, obj client.Object) cache.ByObject {
+	t.Helper()
+	for o, byObject := range opts.ByObject {
+		if reflect.TypeOf(o) == reflect.TypeOf(obj) {
+			return byObject
+		}
+	}
+	t.Fatalf("No cache options for %T", obj)
+	return cache.ByObject{}
+}
+
+func keys(m map[string]cache.Config) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestCacheOptionsAllNamespaces(t *testing.T) {
+	opts := Scope{SecretNamespaces: []string{"tokenaut-system"}}.CacheOptions()
+	if opts.DefaultNamespaces != nil {
+		t.Errorf("Expected every namespace to be cached, got %v", keys(opts.DefaultNamespaces))
+	}
+	if opts.DefaultLabelSelector != nil {
+		t.Errorf("Expected no default label selector, got %v", opts.DefaultLabelSelector)
+	}
+	secrets := byObject(t, opts, &corev1.Secret{})
+	if secrets.Namespaces != nil {
+		t.Errorf("Expected Secrets of every namespace to be cached, got %v", keys(secrets.Namespaces))
+	}
+	if !secrets.Label.Empty() {
+		t.Errorf("Expected every Secret to be cached, got %v", secrets.Label)
+	}
+	if opts := (Scope{}).ClientOptions(); opts.Cache != nil {
+		t.Errorf("Expected Secrets to be read from the cache, got %+v", opts.Cache)
+	}
+}
+
+func TestCacheOptionsNamespaces(t *testing.T) {
+	opts := Scope{
+		Namespaces:       []string{"team-a", "team-b"},
+		SecretNamespaces: []string{"tokenaut-system", "team-a"},
+	}.CacheOptions()
+	if got, want := keys(opts.DefaultNamespaces), []string{"team-a", "team-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected namespaces %v, got %v", want, got)
+	}
+	secrets := byObject(t, opts, &corev1.Secret{})
+	if got, want := keys(secrets.Namespaces), []string{"team-a", "team-b", "tokenaut-system"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected Secret namespaces %v, got %v", want, got)
+	}
+	if opts := (Scope{Namespaces: []string{"team-a"}}).ClientOptions(); opts.Cache == nil || len(opts.Cache.DisableFor) != 1 {
+		t.Errorf("Expected Secrets outside the watched namespaces to be read from the API server, got %+v", opts.Cache)
+	}
+}
+
+func TestCacheOptionsSelectors(t *testing.T) {
+	selector, err := ParseSelector("team in (a, b)")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	secretSelector, err := ParseSelector("tokenaut.appthrust.io/watch=true")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	scope := Scope{Selector: selector, Shard: "shard-a", SecretSelector: secretSelector}
+	opts := scope.CacheOptions()
+
+	if opts.DefaultLabelSelector == nil || opts.DefaultLabelSelector.String() != selector.String() {
+		t.Errorf("Expected TokenBindings to be selected by %v, got %v", selector, opts.DefaultLabelSelector)
+	}
+	iats := byObject(t, opts, &tokenautv1alpha1.InstallationAccessToken{}).Label
+	testCases := []struct {
+		labels labels.Set
+		want   bool
+	}{
+		{labels: labels.Set{"team": "a", tokenautv1alpha1.ShardLabel: "shard-a"}, want: true},
+		{labels: labels.Set{"team": "c", tokenautv1alpha1.ShardLabel: "shard-a"}, want: false},
+		{labels: labels.Set{"team": "a", tokenautv1alpha1.ShardLabel: "shard-b"}, want: false},
+		{labels: labels.Set{"team": "a"}, want: false},
+	}
+	for _, tc := range testCases {
+		if got := iats.Matches(tc.labels); got != tc.want {
+			t.Errorf("Expected %v for labels %v, got %v", tc.want, tc.labels, got)
+		}
+	}
+
+	if got := byObject(t, opts, &corev1.Secret{}).Label; got.String() != secretSelector.String() {
+		t.Errorf("Expected Secrets to be selected by %v, got %v", secretSelector, got)
+	}
+	clientOpts := scope.ClientOptions()
+	if clientOpts.Cache == nil || len(clientOpts.Cache.DisableFor) != 1 {
+		t.Fatalf("Expected Secrets to be read from the API server, got %+v", clientOpts.Cache)
+	}
+	if _, ok := clientOpts.Cache.DisableFor[0].(*corev1.Secret); !ok {
+		t.Errorf("Expected Secrets to be read from the API server, got %T", clientOpts.Cache.DisableFor[0])
+	}
+}
+
+func TestParseNamespaces(t *testing.T) {
+	got, err := ParseNamespaces(" team-a,,team-b ")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := []string{"team-a", "team-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if got, err := ParseNamespaces(""); err != nil || got != nil {
+		t.Errorf("Expected no namespaces, got %v, %v", got, err)
+	}
+	if _, err := ParseNamespaces("team-a,Team_B"); err == nil {
+		t.Error("Expected an error for an invalid namespace")
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	if selector, err := ParseSelector(" "); err != nil || selector != nil {
+		t.Errorf("Expected no selector, got %v, %v", selector, err)
+	}
+	if _, err := ParseSelector("team in (a"); err == nil {
+		t.Error("Expected an error for an invalid selector")
+	}
+}
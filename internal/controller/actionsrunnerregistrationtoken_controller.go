@@ -0,0 +1,287 @@
+package controller
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	"github.com/appthrust/tokenaut/internal/audit"
+	"github.com/appthrust/tokenaut/internal/ratelimit"
+	"github.com/appthrust/tokenaut/internal/secrettemplate"
+	"github.com/appthrust/tokenaut/internal/signer"
+	"github.com/appthrust/tokenaut/internal/tracing"
+	"github.com/appthrust/tokenaut/pkg/githubapi"
+	"github.com/appthrust/tokenaut/pkg/githubappjwt"
+)
+
+const (
+	// DefaultRunnerTokenRefreshBefore is how long before expiration a runner token is refreshed when spec.refreshBefore is unset
+	DefaultRunnerTokenRefreshBefore = 10 * time.Minute
+
+	// minRunnerTokenRequeue keeps a refreshBefore longer than the token's lifetime from hot-looping
+	minRunnerTokenRequeue = time.Minute
+)
+
+// ActionsRunnerRegistrationTokenReconciler reconciles a ActionsRunnerRegistrationToken object
+type ActionsRunnerRegistrationTokenReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// JWTCache reuses app JWTs across reconciles; nil signs a new JWT every time
+	JWTCache *githubappjwt.Cache
+	// Signers resolves spec.signer; nil only supports private key Secrets
+	Signers *signer.Resolver
+	// GitHubAPIURL is the base URL of the GitHub API, e.g. for GitHub Enterprise Server; api.github.com when empty
+	GitHubAPIURL string
+	// GitHubClients provides the client for GitHubAPIURL; a new client is created for every reconcile when nil
+	GitHubClients githubapi.ClientProvider
+	// Now replaces time.Now, e.g. to expire tokens in tests
+	Now func() time.Time
+	// Audit records every runner token minted or deleted; nil records nothing
+	Audit *audit.Logger
+	// AppRateLimiter delays mints of apps that exceed their share of GitHub's rate limits; nil does not limit
+	AppRateLimiter *ratelimit.PerApp
+	// MaxConcurrentReconciles is how many ActionsRunnerRegistrationTokens are reconciled at once, 1 when zero
+	MaxConcurrentReconciles int
+}
+
+// Reconcile mints an installation access token, exchanges it for a runner registration or removal token
+// and keeps the rendered Secret refreshed ahead of the token's expiration.
+func (r *ActionsRunnerRegistrationTokenReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	ctx, span := tracing.Start(ctx, "ActionsRunnerRegistrationToken.Reconcile",
+		attribute.String("k8s.namespace.name", req.Namespace),
+		attribute.String("tokenaut.name", req.Name))
+	defer func() { tracing.End(span, err) }()
+	log := log.FromContext(ctx)
+
+	var art tokenautv1alpha1.ActionsRunnerRegistrationToken
+	if err := r.Get(ctx, req.NamespacedName, &art); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	log.Info("Reconciling ActionsRunnerRegistrationToken", "Generation", art.Generation)
+	span.SetAttributes(tracing.AppIDKey.String(art.Spec.AppID), tracing.InstallationIDKey.String(art.Spec.InstallationID))
+
+	// Add finalizer if it doesn't exist
+	if !controllerutil.ContainsFinalizer(&art, FinalizerName) {
+		controllerutil.AddFinalizer(&art, FinalizerName)
+		if err := r.Update(ctx, &art); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if !art.ObjectMeta.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, &art)
+	}
+
+	// The status is changed in memory and written once at the end of the reconcile
+	original := art.DeepCopy()
+
+	keySigners, err := r.Signers.ResolveAll(ctx, r.Client, art.Namespace, art.Spec.PrivateKeyRef, art.Spec.PrivateKeyRefs, art.Spec.Signer)
+	if err != nil {
+		log.Error(err, "Failed to get private key")
+		return r.updateStatusWithError(ctx, original, &art, "Token", err)
+	}
+
+	if delay := r.AppRateLimiter.Reserve(art.Spec.AppID); delay > 0 {
+		tracing.SetResult(ctx, "RateLimited")
+		log.V(1).Info("App is over its rate limit, requeuing", "AppID", art.Spec.AppID, "after", delay)
+		if err := r.patchStatus(ctx, original, &art); err != nil {
+			log.Error(err, "Failed to update ActionsRunnerRegistrationToken status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: delay}, nil
+	}
+
+	githubClient := githubClient(r.GitHubClients, r.GitHubAPIURL).WithContext(ctx)
+
+	log.Info("Creating installation access token", "InstallationID", art.Spec.InstallationID)
+	var installationToken *githubapi.AccessTokenResponse
+	fingerprint, rejected, err := signer.Failover(keySigners, func(keySigner crypto.Signer) error {
+		jwt, err := r.JWTCache.GenerateContext(ctx, art.Spec.AppID, keySigner)
+		if err != nil {
+			return err
+		}
+		installationToken, err = githubClient.CreateInstallationAccessToken(art.Spec.InstallationID, jwt)
+		return err
+	})
+	art.Status.RejectedKeyFingerprints = rejected
+	if err != nil {
+		log.Error(err, "Failed to create installation access token", "rejectedKeys", rejected)
+		return r.updateStatusWithError(ctx, original, &art, "Token", err)
+	}
+	if len(rejected) > 0 {
+		log.Info("GitHub rejected preferred private keys, using a fallback key", "rejectedKeys", rejected, "key", fingerprint)
+	}
+	art.Status.KeyFingerprint = fingerprint
+
+	kind := githubapi.RunnerTokenKind(art.Spec.Type)
+	if kind == "" {
+		kind = githubapi.RunnerTokenKindRegistration
+	}
+	target := githubapi.RunnerTarget{
+		Enterprise:   art.Spec.Enterprise,
+		Organization: art.Spec.Organization,
+		Repository:   art.Spec.Repository,
+	}
+	log.Info("Creating runner token", "Type", kind)
+	runnerToken, err := githubClient.CreateRunnerToken(target, kind, installationToken.Token)
+	if err != nil {
+		log.Error(err, "Failed to create runner token")
+		return r.updateStatusWithError(ctx, original, &art, "Token", err)
+	}
+	art.Status.ExpiresAt = metav1.NewTime(runnerToken.ExpiresAt)
+	setStatusCondition(&art.Status.Conditions, "Token", metav1.ConditionTrue, "Created", "Token successfully created")
+
+	secret, err := secrettemplate.RenderSource(secrettemplate.Source{
+		Name:           art.Name,
+		Namespace:      art.Namespace,
+		AppID:          art.Spec.AppID,
+		InstallationID: art.Spec.InstallationID,
+		Template:       art.Spec.Template,
+		SourceLabel:    secrettemplate.ActionsRunnerRegistrationTokenLabel,
+	}, runnerToken.Token, r.now())
+	if err == nil {
+		err = createOrUpdateSecret(ctx, r.Client, secret)
+	}
+	event := auditEvent(audit.ActionMint, "ActionsRunnerRegistrationToken", &art, art.Spec.AppID, art.Spec.InstallationID)
+	event.TokenHash = audit.TokenHash(runnerToken.Token)
+	event.ExpiresAt = &runnerToken.ExpiresAt
+	if art.Spec.Repository != "" {
+		event.Repositories = []string{art.Spec.Repository}
+	}
+	if err != nil {
+		event.Error = err.Error()
+	} else {
+		event.Targets = []string{fmt.Sprintf("Secret %s/%s", secret.Namespace, secret.Name)}
+	}
+	r.Audit.Record(ctx, event)
+	if err != nil {
+		log.Error(err, "Failed to create or update secret")
+		return r.updateStatusWithError(ctx, original, &art, "Secret", err)
+	}
+	if err := deleteReplacedSecret(ctx, r.Client, art.Status.SecretRef, secret); err != nil {
+		log.Error(err, "Failed to delete the previous Secret",
+			"secretName", art.Status.SecretRef.Name,
+			"secretNamespace", art.Status.SecretRef.Namespace)
+	}
+	art.Status.SecretRef = tokenautv1alpha1.SecretRef{
+		Name:      secret.Name,
+		Namespace: secret.Namespace,
+	}
+	setStatusCondition(&art.Status.Conditions, "Secret", metav1.ConditionTrue, "Updated", "Secret successfully created/updated")
+
+	r.updateOverallStatus(&art)
+	if err := r.patchStatus(ctx, original, &art); err != nil {
+		log.Error(err, "Failed to update ActionsRunnerRegistrationToken status")
+		return ctrl.Result{}, err
+	}
+	tracing.SetResult(ctx, "Ready")
+
+	refreshBefore := DefaultRunnerTokenRefreshBefore
+	if art.Spec.RefreshBefore != nil {
+		refreshBefore = art.Spec.RefreshBefore.Duration
+	}
+	requeueAfter := runnerToken.ExpiresAt.Add(-refreshBefore).Sub(r.now())
+	if requeueAfter < minRunnerTokenRequeue {
+		requeueAfter = minRunnerTokenRequeue
+	}
+	log.Info(fmt.Sprintf("Completed reconciliation for %s, requeuing after %v", req.NamespacedName, requeueAfter))
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+func (r *ActionsRunnerRegistrationTokenReconciler) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+// updateStatusWithError marks the failed condition and everything after it as not ready
+func (r *ActionsRunnerRegistrationTokenReconciler) updateStatusWithError(ctx context.Context, original, art *tokenautv1alpha1.ActionsRunnerRegistrationToken, failed string, err error) (ctrl.Result, error) {
+	tracing.SetResult(ctx, failed+"Error")
+	trace.SpanFromContext(ctx).RecordError(err)
+	if failed == "Token" {
+		setStatusCondition(&art.Status.Conditions, "Token", metav1.ConditionFalse, "Failed", fmt.Sprintf("Failed to create token: %v", err))
+	}
+	setStatusCondition(&art.Status.Conditions, "Secret", metav1.ConditionFalse, "Failed", fmt.Sprintf("Failed to create/update Secret: %v", err))
+	r.updateOverallStatus(art)
+	if err := r.patchStatus(ctx, original, art); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update ActionsRunnerRegistrationToken status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+}
+
+func (r *ActionsRunnerRegistrationTokenReconciler) updateOverallStatus(art *tokenautv1alpha1.ActionsRunnerRegistrationToken) {
+	tokenCondition := meta.FindStatusCondition(art.Status.Conditions, "Token")
+	secretCondition := meta.FindStatusCondition(art.Status.Conditions, "Secret")
+
+	switch {
+	case tokenCondition != nil && tokenCondition.Status == metav1.ConditionFalse:
+		setStatusCondition(&art.Status.Conditions, "Ready", metav1.ConditionFalse, "NotReady", fmt.Sprintf("Token is not ready: %s", tokenCondition.Message))
+	case secretCondition != nil && secretCondition.Status == metav1.ConditionFalse:
+		setStatusCondition(&art.Status.Conditions, "Ready", metav1.ConditionFalse, "NotReady", fmt.Sprintf("Secret is not ready: %s", secretCondition.Message))
+	case tokenCondition != nil && secretCondition != nil:
+		setStatusCondition(&art.Status.Conditions, "Ready", metav1.ConditionTrue, "AllReady", "ActionsRunnerRegistrationToken is ready for use")
+	default:
+		setStatusCondition(&art.Status.Conditions, "Ready", metav1.ConditionFalse, "NotReady", "ActionsRunnerRegistrationToken is not ready")
+	}
+}
+
+// patchStatus writes the status changed since original, see patchStatus
+func (r *ActionsRunnerRegistrationTokenReconciler) patchStatus(ctx context.Context, original, art *tokenautv1alpha1.ActionsRunnerRegistrationToken) error {
+	return patchStatus(ctx, r.Client, original, art, func(from, to *tokenautv1alpha1.ActionsRunnerRegistrationToken) {
+		from.Status.DeepCopyInto(&to.Status)
+	})
+}
+
+func (r *ActionsRunnerRegistrationTokenReconciler) reconcileDelete(ctx context.Context, art *tokenautv1alpha1.ActionsRunnerRegistrationToken) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	if err := deleteSecret(ctx, r.Client, art.Status.SecretRef.Name, art.Status.SecretRef.Namespace); err != nil {
+		log.Error(err, "Failed to delete associated Secret",
+			"secretName", art.Status.SecretRef.Name,
+			"secretNamespace", art.Status.SecretRef.Namespace)
+		return ctrl.Result{RequeueAfter: time.Second * 10}, err
+	}
+	if art.Status.SecretRef.Name != "" {
+		event := auditEvent(audit.ActionDelete, "ActionsRunnerRegistrationToken", art, art.Spec.AppID, art.Spec.InstallationID)
+		event.Targets = []string{fmt.Sprintf("Secret %s/%s", art.Status.SecretRef.Namespace, art.Status.SecretRef.Name)}
+		r.Audit.Record(ctx, event)
+	}
+	controllerutil.RemoveFinalizer(art, FinalizerName)
+	if err := r.Update(ctx, art); err != nil {
+		log.Error(err, "Failed to remove finalizer from ActionsRunnerRegistrationToken")
+		return ctrl.Result{}, err
+	}
+	log.Info("Successfully completed deletion process for ActionsRunnerRegistrationToken",
+		"name", art.Name,
+		"namespace", art.Namespace)
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ActionsRunnerRegistrationTokenReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&tokenautv1alpha1.ActionsRunnerRegistrationToken{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(r)
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	tokenautappthrustiov1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	"github.com/appthrust/tokenaut/internal/privatekey"
+	"github.com/appthrust/tokenaut/pkg/githubapi/fakegithub"
+	"github.com/appthrust/tokenaut/pkg/githubappjwt"
+)
+
+var _ = Describe("ActionsRunnerRegistrationToken Controller", func() {
+	ctx := context.Background()
+
+	var (
+		namespace  string
+		now        time.Time
+		reconciler *ActionsRunnerRegistrationTokenReconciler
+	)
+
+	clock := func() time.Time { return now }
+
+	BeforeEach(func() {
+		now = time.Now().Truncate(time.Second)
+
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+
+		fake := fakegithub.New()
+		fake.Now = clock
+		fake.AddApp(fakegithub.App{ID: testAppID, Slug: "tokenaut-test", PublicKeys: []*rsa.PublicKey{&key.PublicKey}})
+		fake.AddInstallation(fakegithub.Installation{
+			ID:              testInstallationID,
+			AppID:           testAppID,
+			Account:         "my-org",
+			Permissions:     map[string]string{"organization_self_hosted_runners": "write"},
+			AllRepositories: true,
+		})
+		server := httptest.NewServer(fake)
+		DeferCleanup(server.Close)
+
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "tokenaut-test-"}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+		namespace = ns.Name
+		Expect(k8sClient.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "github-app-private-key", Namespace: namespace},
+			Data: map[string][]byte{
+				privatekey.DefaultSecretKey: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+			},
+		})).To(Succeed())
+
+		reconciler = &ActionsRunnerRegistrationTokenReconciler{
+			Client:       k8sClient,
+			Scheme:       k8sClient.Scheme(),
+			JWTCache:     githubappjwt.NewCache(githubappjwt.WithClock(clock)),
+			GitHubAPIURL: server.URL,
+			Now:          clock,
+		}
+	})
+
+	reconcileART := func(name types.NamespacedName) reconcile.Result {
+		result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: name})
+		Expect(err).NotTo(HaveOccurred())
+		return result
+	}
+
+	getART := func(name types.NamespacedName) *tokenautappthrustiov1alpha1.ActionsRunnerRegistrationToken {
+		art := &tokenautappthrustiov1alpha1.ActionsRunnerRegistrationToken{}
+		Expect(k8sClient.Get(ctx, name, art)).To(Succeed())
+		return art
+	}
+
+	secretExists := func(name string) bool {
+		err := k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, &corev1.Secret{})
+		if apierrors.IsNotFound(err) {
+			return false
+		}
+		Expect(err).NotTo(HaveOccurred())
+		return true
+	}
+
+	It("should write the runner token to a Secret and delete it once the template renames it", func() {
+		art := &tokenautappthrustiov1alpha1.ActionsRunnerRegistrationToken{
+			ObjectMeta: metav1.ObjectMeta{Name: "runner", Namespace: namespace},
+			Spec: tokenautappthrustiov1alpha1.ActionsRunnerRegistrationTokenSpec{
+				AppID:          "12345",
+				InstallationID: "1234567890",
+				PrivateKeyRef:  &tokenautappthrustiov1alpha1.PrivateKeyRef{Name: "github-app-private-key", Namespace: namespace},
+				Organization:   "my-org",
+			},
+		}
+		Expect(k8sClient.Create(ctx, art)).To(Succeed())
+		name := types.NamespacedName{Name: "runner", Namespace: namespace}
+
+		reconcileART(name)
+		art = getART(name)
+		Expect(meta.IsStatusConditionTrue(art.Status.Conditions, "Ready")).To(BeTrue())
+		Expect(art.Status.SecretRef).To(Equal(tokenautappthrustiov1alpha1.SecretRef{Name: "runner", Namespace: namespace}))
+		Expect(art.Status.KeyFingerprint).NotTo(BeEmpty())
+		Expect(secretExists("runner")).To(BeTrue())
+
+		By("deleting the previous Secret once the template renames it")
+		art.Spec.Template = &runtime.RawExtension{Raw: []byte(`{"metadata": {"name": "runner-renamed"}}`)}
+		Expect(k8sClient.Update(ctx, art)).To(Succeed())
+		reconcileART(name)
+		art = getART(name)
+		Expect(art.Status.SecretRef).To(Equal(tokenautappthrustiov1alpha1.SecretRef{Name: "runner-renamed", Namespace: namespace}))
+		Expect(secretExists("runner-renamed")).To(BeTrue())
+		Expect(secretExists("runner")).To(BeFalse())
+	})
+
+	It("should refresh the runner token refreshBefore its expiration", func() {
+		art := &tokenautappthrustiov1alpha1.ActionsRunnerRegistrationToken{
+			ObjectMeta: metav1.ObjectMeta{Name: "refresh", Namespace: namespace},
+			Spec: tokenautappthrustiov1alpha1.ActionsRunnerRegistrationTokenSpec{
+				AppID:          "12345",
+				InstallationID: "1234567890",
+				PrivateKeyRef:  &tokenautappthrustiov1alpha1.PrivateKeyRef{Name: "github-app-private-key", Namespace: namespace},
+				Organization:   "my-org",
+			},
+		}
+		Expect(k8sClient.Create(ctx, art)).To(Succeed())
+		name := types.NamespacedName{Name: "refresh", Namespace: namespace}
+
+		Expect(reconcileART(name).RequeueAfter).To(Equal(fakegithub.TokenLifetime - DefaultRunnerTokenRefreshBefore))
+		Expect(getART(name).Status.ExpiresAt.Time).To(BeTemporally("==", now.Add(fakegithub.TokenLifetime)))
+
+		By("honoring spec.refreshBefore")
+		art = getART(name)
+		art.Spec.RefreshBefore = &metav1.Duration{Duration: 20 * time.Minute}
+		Expect(k8sClient.Update(ctx, art)).To(Succeed())
+		Expect(reconcileART(name).RequeueAfter).To(Equal(fakegithub.TokenLifetime - 20*time.Minute))
+
+		By("waiting at least a minute once the refresh is overdue")
+		reconciler.Now = func() time.Time { return now.Add(58 * time.Minute) }
+		Expect(reconcileART(name).RequeueAfter).To(Equal(minRunnerTokenRequeue))
+	})
+
+	It("should report a private key that can't be used", func() {
+		art := &tokenautappthrustiov1alpha1.ActionsRunnerRegistrationToken{
+			ObjectMeta: metav1.ObjectMeta{Name: "missing-key", Namespace: namespace},
+			Spec: tokenautappthrustiov1alpha1.ActionsRunnerRegistrationTokenSpec{
+				AppID:          "12345",
+				InstallationID: "1234567890",
+				PrivateKeyRef:  &tokenautappthrustiov1alpha1.PrivateKeyRef{Name: "does-not-exist", Namespace: namespace},
+				Organization:   "my-org",
+			},
+		}
+		Expect(k8sClient.Create(ctx, art)).To(Succeed())
+		name := types.NamespacedName{Name: "missing-key", Namespace: namespace}
+
+		reconcileART(name)
+		art = getART(name)
+		condition := meta.FindStatusCondition(art.Status.Conditions, "Token")
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(meta.IsStatusConditionTrue(art.Status.Conditions, "Ready")).To(BeFalse())
+		Expect(secretExists("missing-key")).To(BeFalse())
+	})
+})
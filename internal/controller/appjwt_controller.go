@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	"github.com/appthrust/tokenaut/internal/audit"
+	"github.com/appthrust/tokenaut/internal/secrettemplate"
+	"github.com/appthrust/tokenaut/internal/signer"
+	"github.com/appthrust/tokenaut/pkg/githubappjwt"
+)
+
+const (
+	// AppJWTLifetime is the lifetime of a published JWT, kept under GitHub's 10-minute maximum
+	AppJWTLifetime = 9 * time.Minute
+
+	// AppJWTRefreshInterval is how often a published JWT is replaced, leaving consumers
+	// several minutes to pick up the new Secret before the old JWT expires
+	AppJWTRefreshInterval = 5 * time.Minute
+)
+
+// AppJWTReconciler reconciles a AppJWT object
+type AppJWTReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// JWTOptions are applied to every published JWT before its lifetime is set
+	JWTOptions []githubappjwt.Option
+	// Signers resolves spec.signer; nil only supports private key Secrets
+	Signers *signer.Resolver
+	// Audit records every JWT published or deleted; nil records nothing
+	Audit *audit.Logger
+	// MaxConcurrentReconciles is how many AppJWTs are reconciled at once, 1 when zero
+	MaxConcurrentReconciles int
+}
+
+// Reconcile signs a JWT for the GitHub App and keeps the rendered Secret rotated well within its lifetime.
+func (r *AppJWTReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	var appJWT tokenautv1alpha1.AppJWT
+	if err := r.Get(ctx, req.NamespacedName, &appJWT); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	log.Info("Reconciling AppJWT", "Generation", appJWT.Generation)
+
+	// Add finalizer if it doesn't exist
+	if !controllerutil.ContainsFinalizer(&appJWT, FinalizerName) {
+		controllerutil.AddFinalizer(&appJWT, FinalizerName)
+		if err := r.Update(ctx, &appJWT); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if !appJWT.ObjectMeta.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, &appJWT)
+	}
+
+	// The status is changed in memory and written once at the end of the reconcile
+	original := appJWT.DeepCopy()
+
+	// Nothing verifies the JWT before consumers use it, so the first key that can be read signs it
+	keySigners, err := r.Signers.ResolveAll(ctx, r.Client, appJWT.Namespace, appJWT.Spec.PrivateKeyRef, appJWT.Spec.PrivateKeyRefs, appJWT.Spec.Signer)
+	if err != nil {
+		log.Error(err, "Failed to get private key")
+		return r.updateStatusWithError(ctx, original, &appJWT, "Token", err)
+	}
+	keySigner := keySigners[0]
+
+	jwtOptions := append([]githubappjwt.Option{}, r.JWTOptions...)
+	jwtOptions = append(jwtOptions, githubappjwt.WithExpiration(AppJWTLifetime))
+	token, err := githubappjwt.GenerateToken(ctx, appJWT.Spec.AppID, keySigner, jwtOptions...)
+	if err != nil {
+		log.Error(err, "Failed to generate JWT")
+		return r.updateStatusWithError(ctx, original, &appJWT, "Token", err)
+	}
+	jwt := token.Token
+	appJWT.Status.IssuedAt = metav1.NewTime(token.IssuedAt)
+	appJWT.Status.ExpiresAt = metav1.NewTime(token.ExpiresAt)
+	setStatusCondition(&appJWT.Status.Conditions, "Token", metav1.ConditionTrue, "Created", "JWT successfully signed")
+
+	secret, err := secrettemplate.RenderSource(secrettemplate.Source{
+		Name:        appJWT.Name,
+		Namespace:   appJWT.Namespace,
+		AppID:       appJWT.Spec.AppID,
+		Template:    appJWT.Spec.Template,
+		SourceLabel: secrettemplate.AppJWTLabel,
+	}, jwt, time.Now())
+	if err == nil {
+		err = createOrUpdateSecret(ctx, r.Client, secret)
+	}
+	event := auditEvent(audit.ActionMint, "AppJWT", &appJWT, appJWT.Spec.AppID, "")
+	event.TokenHash = audit.TokenHash(jwt)
+	event.ExpiresAt = &appJWT.Status.ExpiresAt.Time
+	if err != nil {
+		event.Error = err.Error()
+	} else {
+		event.Targets = []string{fmt.Sprintf("Secret %s/%s", secret.Namespace, secret.Name)}
+	}
+	r.Audit.Record(ctx, event)
+	if err != nil {
+		log.Error(err, "Failed to create or update secret")
+		return r.updateStatusWithError(ctx, original, &appJWT, "Secret", err)
+	}
+	if err := deleteReplacedSecret(ctx, r.Client, appJWT.Status.SecretRef, secret); err != nil {
+		log.Error(err, "Failed to delete the previous Secret",
+			"secretName", appJWT.Status.SecretRef.Name,
+			"secretNamespace", appJWT.Status.SecretRef.Namespace)
+	}
+	appJWT.Status.SecretRef = tokenautv1alpha1.SecretRef{
+		Name:      secret.Name,
+		Namespace: secret.Namespace,
+	}
+	setStatusCondition(&appJWT.Status.Conditions, "Secret", metav1.ConditionTrue, "Updated", "Secret successfully created/updated")
+
+	r.updateOverallStatus(&appJWT)
+	if err := r.patchStatus(ctx, original, &appJWT); err != nil {
+		log.Error(err, "Failed to update AppJWT status")
+		return ctrl.Result{}, err
+	}
+
+	log.Info(fmt.Sprintf("Completed reconciliation for %s, requeuing after %v", req.NamespacedName, AppJWTRefreshInterval))
+	return ctrl.Result{RequeueAfter: AppJWTRefreshInterval}, nil
+}
+
+// updateStatusWithError marks the failed condition and everything after it as not ready
+func (r *AppJWTReconciler) updateStatusWithError(ctx context.Context, original, appJWT *tokenautv1alpha1.AppJWT, failed string, err error) (ctrl.Result, error) {
+	if failed == "Token" {
+		setStatusCondition(&appJWT.Status.Conditions, "Token", metav1.ConditionFalse, "Failed", fmt.Sprintf("Failed to sign JWT: %v", err))
+	}
+	setStatusCondition(&appJWT.Status.Conditions, "Secret", metav1.ConditionFalse, "Failed", fmt.Sprintf("Failed to create/update Secret: %v", err))
+	r.updateOverallStatus(appJWT)
+	if err := r.patchStatus(ctx, original, appJWT); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update AppJWT status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+}
+
+func (r *AppJWTReconciler) updateOverallStatus(appJWT *tokenautv1alpha1.AppJWT) {
+	tokenCondition := meta.FindStatusCondition(appJWT.Status.Conditions, "Token")
+	secretCondition := meta.FindStatusCondition(appJWT.Status.Conditions, "Secret")
+
+	switch {
+	case tokenCondition != nil && tokenCondition.Status == metav1.ConditionFalse:
+		setStatusCondition(&appJWT.Status.Conditions, "Ready", metav1.ConditionFalse, "NotReady", fmt.Sprintf("Token is not ready: %s", tokenCondition.Message))
+	case secretCondition != nil && secretCondition.Status == metav1.ConditionFalse:
+		setStatusCondition(&appJWT.Status.Conditions, "Ready", metav1.ConditionFalse, "NotReady", fmt.Sprintf("Secret is not ready: %s", secretCondition.Message))
+	case tokenCondition != nil && secretCondition != nil:
+		setStatusCondition(&appJWT.Status.Conditions, "Ready", metav1.ConditionTrue, "AllReady", "AppJWT is ready for use")
+	default:
+		setStatusCondition(&appJWT.Status.Conditions, "Ready", metav1.ConditionFalse, "NotReady", "AppJWT is not ready")
+	}
+}
+
+// patchStatus writes the status changed since original, see patchStatus
+func (r *AppJWTReconciler) patchStatus(ctx context.Context, original, appJWT *tokenautv1alpha1.AppJWT) error {
+	return patchStatus(ctx, r.Client, original, appJWT, func(from, to *tokenautv1alpha1.AppJWT) {
+		from.Status.DeepCopyInto(&to.Status)
+	})
+}
+
+func (r *AppJWTReconciler) reconcileDelete(ctx context.Context, appJWT *tokenautv1alpha1.AppJWT) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	if err := deleteSecret(ctx, r.Client, appJWT.Status.SecretRef.Name, appJWT.Status.SecretRef.Namespace); err != nil {
+		log.Error(err, "Failed to delete associated Secret",
+			"secretName", appJWT.Status.SecretRef.Name,
+			"secretNamespace", appJWT.Status.SecretRef.Namespace)
+		return ctrl.Result{RequeueAfter: time.Second * 10}, err
+	}
+	if appJWT.Status.SecretRef.Name != "" {
+		event := auditEvent(audit.ActionDelete, "AppJWT", appJWT, appJWT.Spec.AppID, "")
+		event.Targets = []string{fmt.Sprintf("Secret %s/%s", appJWT.Status.SecretRef.Namespace, appJWT.Status.SecretRef.Name)}
+		r.Audit.Record(ctx, event)
+	}
+	controllerutil.RemoveFinalizer(appJWT, FinalizerName)
+	if err := r.Update(ctx, appJWT); err != nil {
+		log.Error(err, "Failed to remove finalizer from AppJWT")
+		return ctrl.Result{}, err
+	}
+	log.Info("Successfully completed deletion process for AppJWT",
+		"name", appJWT.Name,
+		"namespace", appJWT.Namespace)
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *AppJWTReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&tokenautv1alpha1.AppJWT{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(r)
+}
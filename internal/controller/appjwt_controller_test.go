@@ -0,0 +1,166 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+
+	"github.com/golang-jwt/jwt/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	tokenautappthrustiov1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	"github.com/appthrust/tokenaut/internal/privatekey"
+)
+
+var _ = Describe("AppJWT Controller", func() {
+	ctx := context.Background()
+
+	var (
+		namespace  string
+		key        *rsa.PrivateKey
+		reconciler *AppJWTReconciler
+	)
+
+	BeforeEach(func() {
+		var err error
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "tokenaut-test-"}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+		namespace = ns.Name
+		Expect(k8sClient.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "github-app-private-key", Namespace: namespace},
+			Data: map[string][]byte{
+				privatekey.DefaultSecretKey: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+			},
+		})).To(Succeed())
+
+		reconciler = &AppJWTReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+	})
+
+	reconcileAppJWT := func(name types.NamespacedName) reconcile.Result {
+		result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: name})
+		Expect(err).NotTo(HaveOccurred())
+		return result
+	}
+
+	getAppJWT := func(name types.NamespacedName) *tokenautappthrustiov1alpha1.AppJWT {
+		appJWT := &tokenautappthrustiov1alpha1.AppJWT{}
+		Expect(k8sClient.Get(ctx, name, appJWT)).To(Succeed())
+		return appJWT
+	}
+
+	secretExists := func(name string) bool {
+		err := k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, &corev1.Secret{})
+		if apierrors.IsNotFound(err) {
+			return false
+		}
+		Expect(err).NotTo(HaveOccurred())
+		return true
+	}
+
+	It("should write the JWT to a Secret and delete it once the template renames it", func() {
+		appJWT := &tokenautappthrustiov1alpha1.AppJWT{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-jwt", Namespace: namespace},
+			Spec: tokenautappthrustiov1alpha1.AppJWTSpec{
+				AppID:         "12345",
+				PrivateKeyRef: &tokenautappthrustiov1alpha1.PrivateKeyRef{Name: "github-app-private-key", Namespace: namespace},
+			},
+		}
+		Expect(k8sClient.Create(ctx, appJWT)).To(Succeed())
+		name := types.NamespacedName{Name: "app-jwt", Namespace: namespace}
+
+		Expect(reconcileAppJWT(name).RequeueAfter).To(Equal(AppJWTRefreshInterval))
+		appJWT = getAppJWT(name)
+		Expect(meta.IsStatusConditionTrue(appJWT.Status.Conditions, "Ready")).To(BeTrue())
+		Expect(appJWT.Status.SecretRef).To(Equal(tokenautappthrustiov1alpha1.SecretRef{Name: "app-jwt", Namespace: namespace}))
+		Expect(secretExists("app-jwt")).To(BeTrue())
+
+		By("recording the validity signed into the JWT")
+		secret := &corev1.Secret{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "app-jwt", Namespace: namespace}, secret)).To(Succeed())
+		claims := &jwt.RegisteredClaims{}
+		_, _, err := jwt.NewParser().ParseUnverified(string(secret.Data["token"]), claims)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(appJWT.Status.IssuedAt.Time).To(BeTemporally("==", claims.IssuedAt.Time))
+		Expect(appJWT.Status.ExpiresAt.Time).To(BeTemporally("==", claims.ExpiresAt.Time))
+
+		By("deleting the previous Secret once the template renames it")
+		appJWT.Spec.Template = &runtime.RawExtension{Raw: []byte(`{"metadata": {"name": "app-jwt-renamed"}}`)}
+		Expect(k8sClient.Update(ctx, appJWT)).To(Succeed())
+		reconcileAppJWT(name)
+		appJWT = getAppJWT(name)
+		Expect(appJWT.Status.SecretRef).To(Equal(tokenautappthrustiov1alpha1.SecretRef{Name: "app-jwt-renamed", Namespace: namespace}))
+		Expect(secretExists("app-jwt-renamed")).To(BeTrue())
+		Expect(secretExists("app-jwt")).To(BeFalse())
+	})
+
+	It("should sign with the first key of privateKeyRefs that can be read", func() {
+		appJWT := &tokenautappthrustiov1alpha1.AppJWT{
+			ObjectMeta: metav1.ObjectMeta{Name: "rolled-key", Namespace: namespace},
+			Spec: tokenautappthrustiov1alpha1.AppJWTSpec{
+				AppID: "12345",
+				PrivateKeyRefs: []tokenautappthrustiov1alpha1.PrivateKeyRef{
+					{Name: "does-not-exist", Namespace: namespace},
+					{Name: "github-app-private-key", Namespace: namespace},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, appJWT)).To(Succeed())
+		name := types.NamespacedName{Name: "rolled-key", Namespace: namespace}
+
+		reconcileAppJWT(name)
+		Expect(meta.IsStatusConditionTrue(getAppJWT(name).Status.Conditions, "Ready")).To(BeTrue())
+		secret := &corev1.Secret{}
+		Expect(k8sClient.Get(ctx, name, secret)).To(Succeed())
+		_, err := jwt.Parse(string(secret.Data["token"]), func(*jwt.Token) (interface{}, error) { return &key.PublicKey, nil })
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should report a private key that can't be used", func() {
+		appJWT := &tokenautappthrustiov1alpha1.AppJWT{
+			ObjectMeta: metav1.ObjectMeta{Name: "missing-key", Namespace: namespace},
+			Spec: tokenautappthrustiov1alpha1.AppJWTSpec{
+				AppID:         "12345",
+				PrivateKeyRef: &tokenautappthrustiov1alpha1.PrivateKeyRef{Name: "does-not-exist", Namespace: namespace},
+			},
+		}
+		Expect(k8sClient.Create(ctx, appJWT)).To(Succeed())
+		name := types.NamespacedName{Name: "missing-key", Namespace: namespace}
+
+		reconcileAppJWT(name)
+		appJWT = getAppJWT(name)
+		condition := meta.FindStatusCondition(appJWT.Status.Conditions, "Token")
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(meta.IsStatusConditionTrue(appJWT.Status.Conditions, "Ready")).To(BeFalse())
+		Expect(secretExists("missing-key")).To(BeFalse())
+	})
+})
@@ -0,0 +1,21 @@
+package controller
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/appthrust/tokenaut/internal/audit"
+)
+
+// auditEvent returns an audit event for a token of the resource, requested by whoever last changed its spec
+func auditEvent(action, kind string, obj client.Object, appID, installationID string) audit.Event {
+	return audit.Event{
+		Action:         action,
+		Kind:           kind,
+		Namespace:      obj.GetNamespace(),
+		Name:           obj.GetName(),
+		UID:            obj.GetUID(),
+		RequestedBy:    audit.SpecManager(obj),
+		AppID:          appID,
+		InstallationID: installationID,
+	}
+}
@@ -0,0 +1,13 @@
+package controller
+
+import (
+	"github.com/appthrust/tokenaut/pkg/githubapi"
+)
+
+// githubClient returns the client for the GitHub API at baseURL from clients, or a new client when clients is nil
+func githubClient(clients githubapi.ClientProvider, baseURL string) *githubapi.Client {
+	if clients == nil {
+		return githubapi.NewClient(githubapi.ClientConfig{BaseURL: baseURL})
+	}
+	return clients.Client(baseURL)
+}
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	"github.com/appthrust/tokenaut/pkg/githubapi"
+)
+
+const (
+	// ReconcilingCondition is set while an error that may go away on its own is retried.
+	// Like StalledCondition it follows the kstatus conventions Flux judges health by.
+	ReconcilingCondition = "Reconciling"
+	// StalledCondition is set while an error persists until the resource, its private key or the GitHub App is fixed
+	StalledCondition = "Stalled"
+)
+
+// updateTokenValidity records whether the token in the status is within its validity window
+func (r *InstallationAccessTokenReconciler) updateTokenValidity(iat *tokenautv1alpha1.InstallationAccessToken) {
+	expiresAt := iat.Status.Token.ExpiresAt
+	iat.Status.TokenValid = !expiresAt.IsZero() && r.now().Before(expiresAt.Time)
+}
+
+// updateProgressConditions sets the Reconciling and Stalled conditions for the outcome of a reconcile that
+// failed with reason and err, or removes both when err is nil. It must run after updateTokenValidity.
+func (r *InstallationAccessTokenReconciler) updateProgressConditions(iat *tokenautv1alpha1.InstallationAccessToken, reason string, err error) {
+	if err == nil {
+		meta.RemoveStatusCondition(&iat.Status.Conditions, ReconcilingCondition)
+		meta.RemoveStatusCondition(&iat.Status.Conditions, StalledCondition)
+		return
+	}
+
+	if !isTerminal(reason, err) {
+		message := "Retrying while the current token is still valid: "
+		if !iat.Status.TokenValid {
+			message = "Retrying without a valid token: "
+		}
+		meta.RemoveStatusCondition(&iat.Status.Conditions, StalledCondition)
+		r.setCondition(iat, metav1.Condition{
+			Type:    ReconcilingCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  reason,
+			Message: message + err.Error(),
+		})
+		return
+	}
+
+	message := err.Error()
+	if !iat.Status.TokenValid {
+		message = "No valid token: " + message
+	}
+
+	// kstatus reports a resource that is still reconciling as in progress, however stalled it is
+	meta.RemoveStatusCondition(&iat.Status.Conditions, ReconcilingCondition)
+	r.setCondition(iat, metav1.Condition{
+		Type:    StalledCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+// isTerminal reports whether a reconcile that failed with reason and err will keep failing until someone fixes
+// the configuration, e.g. a missing or rejected private key or an app that is not installed. Errors retrying
+// may fix, e.g. rate limits, a suspended installation or a GitHub outage, are not terminal.
+func isTerminal(reason string, err error) bool {
+	return reason == "InvalidConfiguration" || githubapi.IsPermanent(err)
+}
+
+// requeueBeforeExpiry shortens after so that the resource is reconciled again by the time its token expires,
+// keeping tokenValid and the conditions from going stale
+func (r *InstallationAccessTokenReconciler) requeueBeforeExpiry(iat *tokenautv1alpha1.InstallationAccessToken, after time.Duration) time.Duration {
+	expiresAt := iat.Status.Token.ExpiresAt
+	if remaining := expiresAt.Sub(r.now()); !expiresAt.IsZero() && remaining > 0 && remaining < after {
+		return remaining
+	}
+	return after
+}
@@ -2,30 +2,36 @@ package controller
 
 import (
 	"context"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/json"
-	"encoding/pem"
+	"crypto"
 	"fmt"
-	"html/template"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
-	"strings"
 	"time"
 
-	"github.com/cockroachdb/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	"github.com/appthrust/tokenaut/internal/audit"
+	"github.com/appthrust/tokenaut/internal/ratelimit"
+	"github.com/appthrust/tokenaut/internal/remotecluster"
+	"github.com/appthrust/tokenaut/internal/secrettemplate"
+	"github.com/appthrust/tokenaut/internal/signer"
+	"github.com/appthrust/tokenaut/internal/tracing"
+	"github.com/appthrust/tokenaut/internal/vaultkv"
 	"github.com/appthrust/tokenaut/pkg/githubapi"
 	"github.com/appthrust/tokenaut/pkg/githubappjwt"
 )
@@ -33,6 +39,13 @@ import (
 const (
 	// FinalizerName is the name of the finalizer used to clean up secrets
 	FinalizerName = "tokenaut.appthrust.io/cleanup-secret"
+
+	// tokenRefreshBefore is how long before expiration a token is refreshed at the latest,
+	// when the token refresh interval would otherwise let it expire
+	tokenRefreshBefore = 5 * time.Minute
+
+	// minTokenRequeue keeps tokens that are about to expire from hot-looping
+	minTokenRequeue = time.Minute
 )
 
 // InstallationAccessTokenReconciler reconciles a InstallationAccessToken object
@@ -40,11 +53,41 @@ type InstallationAccessTokenReconciler struct {
 	client.Client
 	Scheme               *runtime.Scheme
 	TokenRefreshInterval time.Duration
+	// SuspendAll suspends every InstallationAccessToken regardless of spec.suspend
+	SuspendAll bool
+	// JWTCache reuses app JWTs across reconciles; nil signs a new JWT every time
+	JWTCache *githubappjwt.Cache
+	// Signers resolves spec.signer; nil only supports private key Secrets
+	Signers *signer.Resolver
+	// VaultKV writes tokens for spec.sink.vaultKV; Vault KV sinks are disabled when nil
+	VaultKV *vaultkv.Client
+	// VaultAudience is the audience of the ServiceAccount tokens presented to Vault's Kubernetes auth method; DefaultVaultAudience when empty
+	VaultAudience string
+	// APIReader reads the ServiceAccounts of Vault KV sinks, which aren't cached; the client is used when nil
+	APIReader client.Reader
+	// RemoteClients connect to the cluster of a kubeconfig Secret for spec.sink.remoteCluster; remote cluster sinks are disabled when nil
+	RemoteClients *remotecluster.Cache
+	// GitHubAPIURL is the base URL of the GitHub API, e.g. for GitHub Enterprise Server; api.github.com when empty
+	GitHubAPIURL string
+	// GitHubClients provides the client for GitHubAPIURL; a new client is created for every reconcile when nil
+	GitHubClients githubapi.ClientProvider
+	// Now replaces time.Now, e.g. to expire tokens in tests
+	Now func() time.Time
+	// Audit records every token minted or deleted; nil records nothing
+	Audit *audit.Logger
+	// AppRateLimiter delays mints of apps that exceed their share of GitHub's rate limits; nil does not limit
+	AppRateLimiter *ratelimit.PerApp
+	// MaxConcurrentReconciles is how many InstallationAccessTokens are reconciled at once, 1 when zero
+	MaxConcurrentReconciles int
 }
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
-func (r *InstallationAccessTokenReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *InstallationAccessTokenReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	ctx, span := tracing.Start(ctx, "InstallationAccessToken.Reconcile",
+		attribute.String("k8s.namespace.name", req.Namespace),
+		attribute.String("tokenaut.name", req.Name))
+	defer func() { tracing.End(span, err) }()
 	log := log.FromContext(ctx)
 
 	// Fetch the InstallationAccessToken instance
@@ -58,6 +101,9 @@ func (r *InstallationAccessTokenReconciler) Reconcile(ctx context.Context, req c
 		return ctrl.Result{}, err
 	}
 	log.Info("Reconciling InstallationAccessToken", "Generation", installationAccessToken.Generation)
+	span.SetAttributes(
+		tracing.AppIDKey.String(installationAccessToken.Spec.AppID),
+		tracing.InstallationIDKey.String(installationAccessToken.Spec.InstallationID))
 
 	// Add finalizer if it doesn't exist
 	if !controllerutil.ContainsFinalizer(&installationAccessToken, FinalizerName) {
@@ -72,179 +118,227 @@ func (r *InstallationAccessTokenReconciler) Reconcile(ctx context.Context, req c
 		return r.reconcileDelete(ctx, &installationAccessToken)
 	}
 
-	// Get the private key
-	privateKey, err := r.getPrivateKey(ctx, &installationAccessToken)
-	if err != nil {
-		log.Error(err, "Failed to get private key")
-		return r.updateStatusWithError(ctx, &installationAccessToken, "InvalidConfiguration", err)
+	// The status is changed in memory and written once at the end of the reconcile
+	original := installationAccessToken.DeepCopy()
+
+	// Leave the existing token and Secret alone while suspended
+	if r.SuspendAll || installationAccessToken.Spec.Suspend {
+		return r.reconcileSuspended(ctx, original, &installationAccessToken)
 	}
+	meta.RemoveStatusCondition(&installationAccessToken.Status.Conditions, "Suspended")
 
-	// Generate JWT
-	jwt, err := githubappjwt.Generate(installationAccessToken.Spec.AppID, privateKey)
+	// Get the signers holding the private keys, in order of preference
+	keySigners, err := r.getSigners(ctx, &installationAccessToken)
 	if err != nil {
-		log.Error(err, "Failed to generate JWT")
-		return r.updateStatusWithError(ctx, &installationAccessToken, "JWTGenerationError", err)
+		log.Error(err, "Failed to get private key")
+		if reason := privateKeyMissingReason(err); reason != "" {
+			r.setCondition(&installationAccessToken, metav1.Condition{
+				Type:    PrivateKeyMissingCondition,
+				Status:  metav1.ConditionTrue,
+				Reason:  reason,
+				Message: err.Error(),
+			})
+		}
+		return r.updateStatusWithError(ctx, original, &installationAccessToken, "InvalidConfiguration", err)
+	}
+	meta.RemoveStatusCondition(&installationAccessToken.Status.Conditions, PrivateKeyMissingCondition)
+
+	// Leave the worker to other apps while this one is over its budget
+	if delay := r.AppRateLimiter.Reserve(installationAccessToken.Spec.AppID); delay > 0 {
+		tracing.SetResult(ctx, "RateLimited")
+		log.V(1).Info("App is over its rate limit, requeuing", "AppID", installationAccessToken.Spec.AppID, "after", delay)
+		// Keep the condition changes made so far, e.g. a private key that is no longer missing
+		if err := r.patchStatus(ctx, original, &installationAccessToken); err != nil {
+			log.Error(err, "Failed to update InstallationAccessToken status")
+			return ctrl.Result{}, err
+		}
+		// Don't wait past the token's expiry, when tokenValid has to be updated
+		return ctrl.Result{RequeueAfter: r.requeueBeforeExpiry(&installationAccessToken, delay)}, nil
 	}
 
 	// Create GitHub API client
-	githubClient := githubapi.NewClient(githubapi.ClientConfig{})
+	githubClient := r.githubClient().WithContext(ctx)
 
-	// Create installation access token
+	// Create installation access token, falling back to the next key when GitHub rejects the JWT
 	log.Info("Creating installation access token", "InstallationID", installationAccessToken.Spec.InstallationID)
-	tokenResp, err := githubClient.CreateInstallationAccessToken(installationAccessToken.Spec.InstallationID, jwt)
+	var tokenResp *githubapi.AccessTokenResponse
+	fingerprint, rejected, err := signer.Failover(keySigners, func(keySigner crypto.Signer) error {
+		signCtx, signSpan := tracing.Start(ctx, "SignJWT")
+		jwt, err := r.JWTCache.GenerateContext(signCtx, installationAccessToken.Spec.AppID, keySigner)
+		tracing.End(signSpan, err)
+		if err != nil {
+			return err
+		}
+		tokenCtx, tokenSpan := tracing.Start(ctx, "CreateInstallationAccessToken")
+		tokenResp, err = githubClient.WithContext(tokenCtx).CreateScopedInstallationAccessToken(installationAccessToken.Spec.InstallationID, jwt, githubapi.AccessTokenRequestFromScope(installationAccessToken.Spec.Scope))
+		tracing.End(tokenSpan, err)
+		return err
+	})
+	installationAccessToken.Status.RejectedKeyFingerprints = rejected
 	if err != nil {
-		log.Error(err, "Failed to create installation access token")
-		return r.updateStatusWithError(ctx, &installationAccessToken, "TokenCreationError", err)
+		log.Error(err, "Failed to create installation access token", "rejectedKeys", rejected)
+		return r.updateStatusWithError(ctx, original, &installationAccessToken, "TokenCreationError", err)
+	}
+	if len(rejected) > 0 {
+		log.Info("GitHub rejected preferred private keys, using a fallback key", "rejectedKeys", rejected, "key", fingerprint)
 	}
+	installationAccessToken.Status.KeyFingerprint = fingerprint
 
 	// Update Token condition
 	r.updateTokenCondition(ctx, &installationAccessToken, tokenResp, nil)
 
 	// Create or update the Secret
 	createdSecret, err := r.createOrUpdateSecret(ctx, &installationAccessToken, tokenResp.Token)
+	r.auditMint(ctx, &installationAccessToken, tokenResp, err)
 	if err != nil {
 		log.Error(err, "Failed to create or update secret")
-		return r.updateStatusWithError(ctx, &installationAccessToken, "SecretUpdateError", err)
+		return r.updateStatusWithError(ctx, original, &installationAccessToken, "SecretUpdateError", err)
 	}
 
 	// Update Secret condition
 	r.updateSecretCondition(ctx, &installationAccessToken, createdSecret, nil)
 
-	// Update overall status
-	r.updateOverallStatus(ctx, &installationAccessToken)
-
-	// Requeue after 50 minutes to refresh the token before it expires
-	log.Info(fmt.Sprintf("Completed reconciliation for %s, requeuing after %v", req.NamespacedName, r.TokenRefreshInterval))
-	return ctrl.Result{RequeueAfter: r.TokenRefreshInterval}, nil
-}
-
-func (r *InstallationAccessTokenReconciler) getPrivateKey(ctx context.Context, iat *tokenautv1alpha1.InstallationAccessToken) (*rsa.PrivateKey, error) {
-	secretName := "github-app-private-key"
-	secretNamespace := "default"
-	secretKey := "privateKey"
-
-	if iat.Spec.PrivateKeyRef != nil {
-		if iat.Spec.PrivateKeyRef.Name != "" {
-			secretName = iat.Spec.PrivateKeyRef.Name
-		}
-		if iat.Spec.PrivateKeyRef.Namespace != "" {
-			secretNamespace = iat.Spec.PrivateKeyRef.Namespace
-		}
-		if iat.Spec.PrivateKeyRef.Key != "" {
-			secretKey = iat.Spec.PrivateKeyRef.Key
-		}
+	// Acknowledge the refresh request handled by this rotation
+	if requestedAt, ok := installationAccessToken.Annotations[tokenautv1alpha1.RefreshRequestedAtAnnotation]; ok {
+		installationAccessToken.Status.LastRefreshRequest = requestedAt
 	}
 
-	var secret corev1.Secret
-	if err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: secretNamespace}, &secret); err != nil {
-		return nil, errors.Errorf("tried to get a secret named \"%s\" in namespace \"%s\", but got error: %v. Please create the secret with the private key or specify the correct secret name and key in the InstallationAccessToken `spec.privateKeyRef`", secretName, secretNamespace, err)
-	}
+	// Requeue to refresh the token before it expires
+	requeueAfter := r.refreshAfter(tokenResp.ExpiresAt)
+	now := r.now()
+	installationAccessToken.Status.LastRefreshTime = &metav1.Time{Time: now}
+	installationAccessToken.Status.NextRefreshTime = &metav1.Time{Time: now.Add(requeueAfter)}
 
-	privateKeyPEM, ok := secret.Data[secretKey]
-	if !ok {
-		return nil, errors.Errorf("tried to read the key \"%s\" from the secret \"%s\" in namespace \"%s\", but the key was not found. Please create the secret with the private key or specify the correct secret name and key in the InstallationAccessToken `spec.privateKeyRef`", secretKey, secretName, secretNamespace)
+	// Update overall status
+	r.updateOverallStatus(&installationAccessToken)
+	r.updateTokenValidity(&installationAccessToken)
+	r.updateProgressConditions(&installationAccessToken, "", nil)
+	if err := r.patchStatus(ctx, original, &installationAccessToken); err != nil {
+		log.Error(err, "Failed to update InstallationAccessToken status")
+		return ctrl.Result{}, err
 	}
 
-	block, _ := pem.Decode(privateKeyPEM)
-	if block == nil {
-		return nil, errors.Errorf("failed to parse PEM block containing the private key")
-	}
+	tracing.SetResult(ctx, "Ready")
+	log.Info(fmt.Sprintf("Completed reconciliation for %s, requeuing after %v", req.NamespacedName, requeueAfter))
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
 
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+// auditMint records a minted token with where it was written, or the error writing it
+func (r *InstallationAccessTokenReconciler) auditMint(ctx context.Context, iat *tokenautv1alpha1.InstallationAccessToken, tokenResp *githubapi.AccessTokenResponse, err error) {
+	event := auditEvent(audit.ActionMint, "InstallationAccessToken", iat, iat.Spec.AppID, iat.Spec.InstallationID)
+	event.SetAccessToken(tokenResp)
 	if err != nil {
-		return nil, errors.Errorf("failed to parse private key: %v", err)
+		event.Error = err.Error()
+	} else if sink, _ := r.recordedSink(iat); sink != nil {
+		event.Targets = []string{sink.String()}
 	}
+	r.Audit.Record(ctx, event)
+}
 
-	return privateKey, nil
+func (r *InstallationAccessTokenReconciler) githubClient() *githubapi.Client {
+	return githubClient(r.GitHubClients, r.GitHubAPIURL)
 }
 
-func (r *InstallationAccessTokenReconciler) createOrUpdateSecret(ctx context.Context, iat *tokenautv1alpha1.InstallationAccessToken, token string) (*corev1.Secret, error) {
-	namespace := iat.Namespace
-	name := iat.Name
-	secret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: namespace,
-		},
-		Type: corev1.SecretTypeOpaque,
-		StringData: map[string]string{
-			"token": token,
-		},
+func (r *InstallationAccessTokenReconciler) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
 	}
+	return time.Now()
+}
 
-	if iat.Spec.Template != nil {
-		var templateData map[string]interface{}
-		if err := json.Unmarshal(iat.Spec.Template.Raw, &templateData); err != nil {
-			return nil, errors.Errorf("failed to unmarshal template: %v", err)
-		}
+// refreshAfter returns when to refresh a token expiring at expiresAt: after TokenRefreshInterval,
+// but no later than tokenRefreshBefore ahead of the expiration
+func (r *InstallationAccessTokenReconciler) refreshAfter(expiresAt time.Time) time.Duration {
+	latest := expiresAt.Sub(r.now()) - tokenRefreshBefore
+	if latest < minTokenRequeue {
+		latest = minTokenRequeue
+	}
+	if r.TokenRefreshInterval <= 0 || r.TokenRefreshInterval > latest {
+		return latest
+	}
+	return r.TokenRefreshInterval
+}
 
-		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(templateData, secret); err != nil {
-			return nil, errors.Errorf("failed to apply template: %v", err)
-		}
+func (r *InstallationAccessTokenReconciler) getSigners(ctx context.Context, iat *tokenautv1alpha1.InstallationAccessToken) (signers []crypto.Signer, err error) {
+	ctx, span := tracing.Start(ctx, "LoadPrivateKeys")
+	defer func() { tracing.End(span, err) }()
+	return r.Signers.ResolveAll(ctx, r.Client, iat.Namespace, iat.Spec.PrivateKeyRef, iat.Spec.PrivateKeyRefs, iat.Spec.Signer)
+}
 
-		// Ensure the token is still present in the secret data
-		if secret.StringData == nil {
-			secret.StringData = make(map[string]string)
-		}
-		for k, v := range secret.StringData {
-			tpl, err := template.New("secret").Parse(v)
-			if err != nil {
-				return nil, errors.Errorf("failed to parse template: %v", err)
-			}
-			out := new(strings.Builder)
-			err = tpl.Execute(out, map[string]string{"Token": token})
-			if err != nil {
-				return nil, errors.Errorf("failed to execute template: %v", err)
-			}
-			secret.StringData[k] = out.String()
-		}
-	}
+func (r *InstallationAccessTokenReconciler) createOrUpdateSecret(ctx context.Context, iat *tokenautv1alpha1.InstallationAccessToken, token string) (_ *corev1.Secret, err error) {
+	ctx, span := tracing.Start(ctx, "ApplySecret")
+	defer func() { tracing.End(span, err) }()
 
-	// Add metadata to the secret
-	if secret.Labels == nil {
-		secret.Labels = make(map[string]string)
+	secret, err := secrettemplate.Render(iat, token, r.now())
+	if err != nil {
+		return nil, err
 	}
-	secret.Labels["app.kubernetes.io/managed-by"] = "tokenaut"
-	secret.Labels["tokenaut.appthrust.io/installation-access-token"] = fmt.Sprintf("%s.%s", iat.Namespace, iat.Name)
 
-	if secret.Annotations == nil {
-		secret.Annotations = make(map[string]string)
+	sink, err := r.sinkFor(iat, secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := sink.Put(ctx, secret); err != nil {
+		return nil, err
 	}
-	secret.Annotations["tokenaut.appthrust.io/last-updated"] = time.Now().Format(time.RFC3339)
-	secret.Annotations["tokenaut.appthrust.io/app-id"] = iat.Spec.AppID
-	secret.Annotations["tokenaut.appthrust.io/installation-id"] = iat.Spec.InstallationID
-	secret.Annotations["tokenaut.appthrust.io/source-namespace"] = iat.Namespace
-	secret.Annotations["tokenaut.appthrust.io/source-name"] = iat.Name
 
-	// Create or update the secret
-	err := r.Create(ctx, secret)
-	if err != nil {
-		if apierrors.IsAlreadyExists(err) {
-			// Secret already exists, update it
-			err = r.Update(ctx, secret)
-			if err != nil {
-				return nil, errors.Errorf("failed to update secret: %v", err)
-			}
-		} else {
-			return nil, errors.Errorf("failed to create secret: %v", err)
+	// Remove the token from where it was written before when the destination changed
+	if previous, err := r.recordedSink(iat); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to delete the token from its previous destination")
+	} else if previous != nil && previous.String() != sink.String() {
+		if err := previous.Delete(ctx); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to delete the token from its previous destination", "destination", previous.String())
 		}
 	}
+	recordSink(iat, sink)
 
 	return secret, nil
 }
 
-func (r *InstallationAccessTokenReconciler) updateStatusWithError(ctx context.Context, iat *tokenautv1alpha1.InstallationAccessToken, reason string, err error) (ctrl.Result, error) {
+func (r *InstallationAccessTokenReconciler) updateStatusWithError(ctx context.Context, original, iat *tokenautv1alpha1.InstallationAccessToken, reason string, err error) (ctrl.Result, error) {
+	tracing.SetResult(ctx, reason)
+	trace.SpanFromContext(ctx).RecordError(err)
 	r.updateTokenCondition(ctx, iat, nil, err)
 	r.updateSecretCondition(ctx, iat, nil, err)
-	r.updateOverallStatus(ctx, iat)
+	r.updateOverallStatus(iat)
+	r.updateTokenValidity(iat)
+	r.updateProgressConditions(iat, reason, err)
+	if err := r.patchStatus(ctx, original, iat); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update InstallationAccessToken status")
+		return ctrl.Result{}, err
+	}
 
 	return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
 }
 
+// setCondition sets a condition observed at the current generation. Its lastTransitionTime only
+// moves when its status changes.
+func (r *InstallationAccessTokenReconciler) setCondition(iat *tokenautv1alpha1.InstallationAccessToken, condition metav1.Condition) {
+	condition.ObservedGeneration = iat.Generation
+	condition.LastTransitionTime = metav1.NewTime(r.now())
+	meta.SetStatusCondition(&iat.Status.Conditions, condition)
+}
+
+// patchStatus writes the status changed since original in a single merge patch, conditional on the
+// resourceVersion it was computed against. On a conflict the latest object is read and the status reapplied
+// to it, so that e.g. an annotation added during the reconcile doesn't lose the status.
+// Nothing is written when the status didn't change.
+func (r *InstallationAccessTokenReconciler) patchStatus(ctx context.Context, original, iat *tokenautv1alpha1.InstallationAccessToken) (err error) {
+	iat.Status.ObservedGeneration = iat.Generation
+	if equality.Semantic.DeepEqual(original.Status, iat.Status) {
+		return nil
+	}
+
+	ctx, span := tracing.Start(ctx, "UpdateStatus")
+	defer func() { tracing.End(span, err) }()
+	return patchStatus(ctx, r.Client, original, iat, func(from, to *tokenautv1alpha1.InstallationAccessToken) {
+		from.Status.DeepCopyInto(&to.Status)
+	})
+}
+
 func (r *InstallationAccessTokenReconciler) updateTokenCondition(ctx context.Context, iat *tokenautv1alpha1.InstallationAccessToken, tokenResp *githubapi.AccessTokenResponse, err error) {
 	condition := metav1.Condition{
-		Type:               "Token",
-		LastTransitionTime: metav1.Now(),
+		Type: "Token",
 	}
 
 	if tokenResp != nil {
@@ -269,23 +363,18 @@ func (r *InstallationAccessTokenReconciler) updateTokenCondition(ctx context.Con
 		}
 	}
 
-	meta.SetStatusCondition(&iat.Status.Conditions, condition)
+	r.setCondition(iat, condition)
 }
 
 func (r *InstallationAccessTokenReconciler) updateSecretCondition(ctx context.Context, iat *tokenautv1alpha1.InstallationAccessToken, createdSecret *corev1.Secret, err error) {
 	condition := metav1.Condition{
-		Type:               "Secret",
-		LastTransitionTime: metav1.Now(),
+		Type: "Secret",
 	}
 
 	if createdSecret != nil {
 		condition.Status = metav1.ConditionTrue
 		condition.Reason = "Updated"
 		condition.Message = "Secret successfully created/updated"
-		iat.Status.SecretRef = tokenautv1alpha1.SecretRef{
-			Name:      createdSecret.Name,
-			Namespace: createdSecret.Namespace,
-		}
 	} else {
 		condition.Status = metav1.ConditionFalse
 		condition.Reason = "Failed"
@@ -296,16 +385,15 @@ func (r *InstallationAccessTokenReconciler) updateSecretCondition(ctx context.Co
 		}
 	}
 
-	meta.SetStatusCondition(&iat.Status.Conditions, condition)
+	r.setCondition(iat, condition)
 }
 
-func (r *InstallationAccessTokenReconciler) updateOverallStatus(ctx context.Context, iat *tokenautv1alpha1.InstallationAccessToken) {
+func (r *InstallationAccessTokenReconciler) updateOverallStatus(iat *tokenautv1alpha1.InstallationAccessToken) {
 	tokenCondition := meta.FindStatusCondition(iat.Status.Conditions, "Token")
 	secretCondition := meta.FindStatusCondition(iat.Status.Conditions, "Secret")
 
 	condition := metav1.Condition{
-		Type:               "Ready",
-		LastTransitionTime: metav1.Now(),
+		Type: "Ready",
 	}
 
 	if tokenCondition != nil && secretCondition != nil &&
@@ -326,11 +414,50 @@ func (r *InstallationAccessTokenReconciler) updateOverallStatus(ctx context.Cont
 		}
 	}
 
-	meta.SetStatusCondition(&iat.Status.Conditions, condition)
+	r.setCondition(iat, condition)
+}
 
-	if err := r.Status().Update(ctx, iat); err != nil {
-		log.FromContext(ctx).Error(err, "Failed to update InstallationAccessToken status")
+func (r *InstallationAccessTokenReconciler) reconcileSuspended(ctx context.Context, original, iat *tokenautv1alpha1.InstallationAccessToken) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	reason := "SuspendedBySpec"
+	message := "Reconciliation is suspended by spec.suspend"
+	if r.SuspendAll {
+		reason = "SuspendedByManager"
+		message = "Reconciliation is suspended by the manager's --suspend-all flag"
+	}
+
+	var result ctrl.Result
+	expiresAt := iat.Status.Token.ExpiresAt
+	switch remaining := expiresAt.Sub(r.now()); {
+	case expiresAt.IsZero():
+		message += "; no token has been issued"
+	case remaining > 0:
+		message += fmt.Sprintf("; the current token expires in %v at %s", remaining.Round(time.Second), expiresAt.UTC().Format(time.RFC3339))
+		// Come back when the token expires so that the message reflects it
+		result.RequeueAfter = remaining
+	default:
+		message += fmt.Sprintf("; the current token expired at %s", expiresAt.UTC().Format(time.RFC3339))
+	}
+
+	r.setCondition(iat, metav1.Condition{
+		Type:    "Suspended",
+		Status:  metav1.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	})
+	// No refresh is scheduled while suspended
+	iat.Status.NextRefreshTime = nil
+	r.updateTokenValidity(iat)
+	r.updateProgressConditions(iat, "", nil)
+	if err := r.patchStatus(ctx, original, iat); err != nil {
+		log.Error(err, "Failed to update InstallationAccessToken status")
+		return ctrl.Result{}, err
 	}
+
+	tracing.SetResult(ctx, reason)
+	log.Info("InstallationAccessToken is suspended, skipping token refresh", "reason", reason)
+	return result, nil
 }
 
 func (r *InstallationAccessTokenReconciler) reconcileDelete(ctx context.Context, iat *tokenautv1alpha1.InstallationAccessToken) (ctrl.Result, error) {
@@ -338,34 +465,60 @@ func (r *InstallationAccessTokenReconciler) reconcileDelete(ctx context.Context,
 	log.Info("Starting deletion process for InstallationAccessToken",
 		"name", iat.Name,
 		"namespace", iat.Namespace)
-	if iat.Status.SecretRef.Name != "" && iat.Status.SecretRef.Namespace != "" {
-		secretToDelete := &corev1.Secret{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      iat.Status.SecretRef.Name,
-				Namespace: iat.Status.SecretRef.Namespace,
-			},
-		}
-		if err := r.Delete(ctx, secretToDelete); err != nil && !apierrors.IsNotFound(err) {
-			log.Error(err, "Failed to delete associated Secret",
-				"secretName", secretToDelete.Name,
-				"secretNamespace", secretToDelete.Namespace)
+	sink, err := r.recordedSink(iat)
+	if err != nil {
+		// Without the configuration the token was written with, it can never be deleted
+		log.Error(err, "Skipping deletion of the token written outside the cluster",
+			"vaultKVRef", iat.Status.VaultKVRef,
+			"remoteSecretRef", iat.Status.RemoteSecretRef)
+	} else if sink != nil {
+		if err := sink.Delete(ctx); err != nil {
+			log.Error(err, "Failed to delete associated Secret", "destination", sink.String())
 			return ctrl.Result{RequeueAfter: time.Second * 10}, err
 		}
+		event := auditEvent(audit.ActionDelete, "InstallationAccessToken", iat, iat.Spec.AppID, iat.Spec.InstallationID)
+		event.Targets = []string{sink.String()}
+		r.Audit.Record(ctx, event)
 	}
 	controllerutil.RemoveFinalizer(iat, FinalizerName)
 	if err := r.Update(ctx, iat); err != nil {
 		log.Error(err, "Failed to remove finalizer from InstallationAccessToken")
 		return ctrl.Result{}, err
 	}
+	tracing.SetResult(ctx, "Deleted")
 	log.Info("Successfully completed deletion process for InstallationAccessToken",
 		"name", iat.Name,
 		"namespace", iat.Namespace)
 	return ctrl.Result{}, nil
 }
 
+// refreshRequestedPredicate passes updates that change the refresh-requested-at annotation
+func refreshRequestedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if e.ObjectOld == nil || e.ObjectNew == nil {
+				return false
+			}
+			return e.ObjectOld.GetAnnotations()[tokenautv1alpha1.RefreshRequestedAtAnnotation] !=
+				e.ObjectNew.GetAnnotations()[tokenautv1alpha1.RefreshRequestedAtAnnotation]
+		},
+	}
+}
+
 // SetupWithManager sets up the controller with the Manager.
+// InstallationAccessTokens are also reconciled when the data of their private key Secret changes or the Secret is deleted.
 func (r *InstallationAccessTokenReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &tokenautv1alpha1.InstallationAccessToken{},
+		privateKeySecretIndex, r.indexByPrivateKeySecret); err != nil {
+		return err
+	}
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&tokenautv1alpha1.InstallationAccessToken{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		For(&tokenautv1alpha1.InstallationAccessToken{}, builder.WithPredicates(
+			predicate.Or(predicate.GenerationChangedPredicate{}, refreshRequestedPredicate()),
+		)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.requestsForPrivateKeySecret),
+			builder.WithPredicates(secretDataChangedPredicate())).
+		Watches(&corev1.Secret{}, r.forgetRemoteClients()).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
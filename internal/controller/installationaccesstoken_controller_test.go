@@ -17,68 +17,766 @@ limitations under the License.
 package controller
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
-	"k8s.io/apimachinery/pkg/api/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-
 	tokenautappthrustiov1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	"github.com/appthrust/tokenaut/internal/audit"
+	"github.com/appthrust/tokenaut/internal/privatekey"
+	"github.com/appthrust/tokenaut/internal/ratelimit"
+	"github.com/appthrust/tokenaut/internal/remotecluster"
+	"github.com/appthrust/tokenaut/internal/vaultkv"
+	"github.com/appthrust/tokenaut/pkg/githubapi"
+	"github.com/appthrust/tokenaut/pkg/githubapi/fakegithub"
+	"github.com/appthrust/tokenaut/pkg/githubappjwt"
+)
+
+const (
+	testAppID          = 12345
+	testInstallationID = 1234567890
 )
 
 var _ = Describe("InstallationAccessToken Controller", func() {
-	Context("When reconciling a resource", func() {
-		const resourceName = "test-resource"
+	ctx := context.Background()
+
+	var (
+		now        time.Time
+		fake       *fakegithub.Server
+		server     *httptest.Server
+		key        *rsa.PrivateKey
+		namespace  string
+		reconciler *InstallationAccessTokenReconciler
+	)
+
+	clock := func() time.Time { return now }
+
+	createNamespace := func() string {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "tokenaut-test-"}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+		return ns.Name
+	}
+
+	createPrivateKeySecret := func(name, namespace string, key *rsa.PrivateKey) {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Data: map[string][]byte{
+				privatekey.DefaultSecretKey: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+			},
+		}
+		Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+	}
+
+	createIAT := func(name string, spec tokenautappthrustiov1alpha1.InstallationAccessTokenSpec) types.NamespacedName {
+		spec.AppID = "12345"
+		spec.InstallationID = "1234567890"
+		iat := &tokenautappthrustiov1alpha1.InstallationAccessToken{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       spec,
+		}
+		Expect(k8sClient.Create(ctx, iat)).To(Succeed())
+		return types.NamespacedName{Name: name, Namespace: namespace}
+	}
+
+	reconcileIAT := func(name types.NamespacedName) reconcile.Result {
+		result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: name})
+		Expect(err).NotTo(HaveOccurred())
+		return result
+	}
+
+	getIAT := func(name types.NamespacedName) *tokenautappthrustiov1alpha1.InstallationAccessToken {
+		iat := &tokenautappthrustiov1alpha1.InstallationAccessToken{}
+		Expect(k8sClient.Get(ctx, name, iat)).To(Succeed())
+		return iat
+	}
+
+	getSecret := func(name, namespace string) *corev1.Secret {
+		secret := &corev1.Secret{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, secret)).To(Succeed())
+		return secret
+	}
+
+	expectCondition := func(iat *tokenautappthrustiov1alpha1.InstallationAccessToken, conditionType string, status metav1.ConditionStatus, reason string) {
+		condition := meta.FindStatusCondition(iat.Status.Conditions, conditionType)
+		ExpectWithOffset(1, condition).NotTo(BeNil(), "condition %s", conditionType)
+		ExpectWithOffset(1, condition.Status).To(Equal(status), "condition %s: %s", conditionType, condition.Message)
+		ExpectWithOffset(1, condition.Reason).To(Equal(reason), "condition %s: %s", conditionType, condition.Message)
+	}
+
+	BeforeEach(func() {
+		now = time.Now().Truncate(time.Second)
+
+		var err error
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+
+		fake = fakegithub.New()
+		fake.Now = clock
+		fake.AddApp(fakegithub.App{ID: testAppID, Slug: "tokenaut-test", PublicKeys: []*rsa.PublicKey{&key.PublicKey}})
+		fake.AddInstallation(fakegithub.Installation{
+			ID:              testInstallationID,
+			AppID:           testAppID,
+			Account:         "my-org",
+			Permissions:     map[string]string{"contents": "write", "metadata": "read"},
+			AllRepositories: true,
+			Repositories:    []fakegithub.Repository{{ID: 1, Name: "repo1"}},
+		})
+		server = httptest.NewServer(fake)
+		DeferCleanup(server.Close)
 
-		ctx := context.Background()
+		namespace = createNamespace()
+		createPrivateKeySecret("github-app-private-key", namespace, key)
 
-		typeNamespacedName := types.NamespacedName{
-			Name:      resourceName,
-			Namespace: "default", // TODO(user):Modify as needed
+		reconciler = &InstallationAccessTokenReconciler{
+			Client:               k8sClient,
+			Scheme:               k8sClient.Scheme(),
+			TokenRefreshInterval: 50 * time.Minute,
+			JWTCache:             githubappjwt.NewCache(githubappjwt.WithClock(clock)),
+			GitHubAPIURL:         server.URL,
+			GitHubClients:        githubapi.NewProvider(githubapi.ProviderConfig{}),
+			Now:                  clock,
 		}
-		installationaccesstoken := &tokenautappthrustiov1alpha1.InstallationAccessToken{}
+	})
+
+	privateKeyRef := func() *tokenautappthrustiov1alpha1.PrivateKeyRef {
+		return &tokenautappthrustiov1alpha1.PrivateKeyRef{Name: "github-app-private-key", Namespace: namespace}
+	}
+
+	Context("When the private key is available", func() {
+		It("should write the token to a Secret and report it ready", func() {
+			name := createIAT("ready", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{PrivateKeyRef: privateKeyRef()})
+
+			result := reconcileIAT(name)
+			Expect(result.RequeueAfter).To(Equal(50 * time.Minute))
+
+			iat := getIAT(name)
+			Expect(controllerutil.ContainsFinalizer(iat, FinalizerName)).To(BeTrue())
+			expectCondition(iat, "Token", metav1.ConditionTrue, "Created")
+			expectCondition(iat, "Secret", metav1.ConditionTrue, "Updated")
+			expectCondition(iat, "Ready", metav1.ConditionTrue, "AllReady")
+			Expect(meta.FindStatusCondition(iat.Status.Conditions, PrivateKeyMissingCondition)).To(BeNil())
+			Expect(iat.Status.SecretRef).To(Equal(tokenautappthrustiov1alpha1.SecretRef{Name: "ready", Namespace: namespace}))
+			Expect(iat.Status.Token.ExpiresAt.Time).To(BeTemporally("==", now.Add(fakegithub.TokenLifetime)))
+			Expect(iat.Status.Token.Permissions).To(Equal(map[string]string{"contents": "write", "metadata": "read"}))
+			Expect(iat.Status.KeyFingerprint).NotTo(BeEmpty())
+
+			secret := getSecret("ready", namespace)
+			token, ok := fake.Token(string(secret.Data["token"]))
+			Expect(ok).To(BeTrue())
+			Expect(token.InstallationID).To(Equal(testInstallationID))
+			Expect(secret.Labels).To(HaveKeyWithValue("app.kubernetes.io/managed-by", "tokenaut"))
+			Expect(secret.Annotations).To(HaveKeyWithValue("tokenaut.appthrust.io/last-updated", now.Format(time.RFC3339)))
+		})
+
+		It("should narrow the token to spec.scope", func() {
+			name := createIAT("scoped", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{
+				PrivateKeyRef: privateKeyRef(),
+				Scope: &tokenautappthrustiov1alpha1.Scope{
+					Repositories: []string{"repo1"},
+					Permissions:  map[string]string{"contents": "read"},
+				},
+			})
+
+			reconcileIAT(name)
+
+			Expect(getIAT(name).Status.Token.Permissions).To(Equal(map[string]string{"contents": "read"}))
+			token, ok := fake.Token(string(getSecret("scoped", namespace).Data["token"]))
+			Expect(ok).To(BeTrue())
+			Expect(token.Permissions).To(Equal(map[string]string{"contents": "read"}))
+			Expect(token.Repositories).To(Equal([]fakegithub.Repository{{ID: 1, Name: "repo1"}}))
+
+			By("requesting the next token with the changed scope")
+			iat := getIAT(name)
+			iat.Spec.Scope.Permissions = map[string]string{"metadata": "read"}
+			Expect(k8sClient.Update(ctx, iat)).To(Succeed())
+			reconcileIAT(name)
+
+			Expect(getIAT(name).Status.Token.Permissions).To(Equal(map[string]string{"metadata": "read"}))
+			token, ok = fake.Token(string(getSecret("scoped", namespace).Data["token"]))
+			Expect(ok).To(BeTrue())
+			Expect(token.Permissions).To(Equal(map[string]string{"metadata": "read"}))
+		})
+
+		It("should render the Secret from spec.template", func() {
+			name := createIAT("templated", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{
+				PrivateKeyRef: privateKeyRef(),
+				Template: &runtime.RawExtension{Raw: []byte(`{
+					"metadata": {"name": "git-credentials", "labels": {"team": "platform"}},
+					"type": "kubernetes.io/basic-auth",
+					"stringData": {"username": "x-access-token", "password": "{{ .Token }}"}
+				}`)},
+			})
+
+			reconcileIAT(name)
+
+			secret := getSecret("git-credentials", namespace)
+			Expect(secret.Type).To(Equal(corev1.SecretTypeBasicAuth))
+			Expect(secret.Labels).To(HaveKeyWithValue("team", "platform"))
+			Expect(string(secret.Data["username"])).To(Equal("x-access-token"))
+			_, ok := fake.Token(string(secret.Data["password"]))
+			Expect(ok).To(BeTrue())
+			Expect(getIAT(name).Status.SecretRef.Name).To(Equal("git-credentials"))
+		})
+
+		It("should write the Secret to the namespace of the template", func() {
+			target := createNamespace()
+			keyNamespace := createNamespace()
+			createPrivateKeySecret("shared-key", keyNamespace, key)
+			name := createIAT("cross-namespace", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{
+				PrivateKeyRef: &tokenautappthrustiov1alpha1.PrivateKeyRef{Name: "shared-key", Namespace: keyNamespace},
+				Template:      &runtime.RawExtension{Raw: []byte(`{"metadata": {"namespace": "` + target + `"}}`)},
+			})
+
+			reconcileIAT(name)
+
+			secret := getSecret("cross-namespace", target)
+			Expect(secret.Annotations).To(HaveKeyWithValue("tokenaut.appthrust.io/source-namespace", namespace))
+			Expect(getIAT(name).Status.SecretRef).To(Equal(tokenautappthrustiov1alpha1.SecretRef{Name: "cross-namespace", Namespace: target}))
+
+			By("deleting the Secret from the target namespace along with the InstallationAccessToken")
+			Expect(k8sClient.Delete(ctx, getIAT(name))).To(Succeed())
+			reconcileIAT(name)
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: "cross-namespace", Namespace: target}, &corev1.Secret{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should delete the Secret and remove the finalizer when deleted", func() {
+			name := createIAT("deleted", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{PrivateKeyRef: privateKeyRef()})
+			reconcileIAT(name)
+			getSecret("deleted", namespace)
+
+			Expect(k8sClient.Delete(ctx, getIAT(name))).To(Succeed())
+			Expect(getIAT(name).DeletionTimestamp).NotTo(BeNil())
+			reconcileIAT(name)
+
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: "deleted", Namespace: namespace}, &corev1.Secret{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			err = k8sClient.Get(ctx, name, &tokenautappthrustiov1alpha1.InstallationAccessToken{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should record the minted and deleted token in the audit log", func() {
+			var auditLog bytes.Buffer
+			reconciler.Audit = &audit.Logger{Sinks: []audit.Sink{audit.NewWriterSink(&auditLog)}, Now: clock}
+			name := createIAT("audited", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{PrivateKeyRef: privateKeyRef()})
+			reconcileIAT(name)
+			token := string(getSecret("audited", namespace).Data["token"])
+			Expect(k8sClient.Delete(ctx, getIAT(name))).To(Succeed())
+			reconcileIAT(name)
+
+			Expect(auditLog.String()).NotTo(ContainSubstring(token))
+			var events []audit.Event
+			decoder := json.NewDecoder(&auditLog)
+			for decoder.More() {
+				var event audit.Event
+				Expect(decoder.Decode(&event)).To(Succeed())
+				events = append(events, event)
+			}
+			Expect(events).To(HaveLen(2))
+
+			mint := events[0]
+			Expect(mint.Action).To(Equal(audit.ActionMint))
+			Expect(mint.Kind).To(Equal("InstallationAccessToken"))
+			Expect(mint.Namespace).To(Equal(namespace))
+			Expect(mint.Name).To(Equal("audited"))
+			Expect(mint.UID).NotTo(BeEmpty())
+			Expect(mint.AppID).To(Equal("12345"))
+			Expect(mint.InstallationID).To(Equal("1234567890"))
+			Expect(mint.Permissions).To(Equal(map[string]string{"contents": "write", "metadata": "read"}))
+			Expect(mint.TokenHash).To(Equal(audit.TokenHash(token)))
+			Expect(mint.ExpiresAt).NotTo(BeNil())
+			Expect(*mint.ExpiresAt).To(BeTemporally("==", now.Add(fakegithub.TokenLifetime)))
+			Expect(mint.Targets).To(Equal([]string{"Secret " + namespace + "/audited"}))
+
+			Expect(events[1].Action).To(Equal(audit.ActionDelete))
+			Expect(events[1].Targets).To(Equal(mint.Targets))
+		})
+
+		It("should overwrite changes made to the Secret", func() {
+			name := createIAT("drift", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{PrivateKeyRef: privateKeyRef()})
+			reconcileIAT(name)
+
+			secret := getSecret("drift", namespace)
+			secret.Data["token"] = []byte("tampered")
+			secret.Data["extra"] = []byte("value")
+			Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+
+			now = now.Add(time.Minute)
+			reconcileIAT(name)
+
+			secret = getSecret("drift", namespace)
+			Expect(secret.Data).NotTo(HaveKey("extra"))
+			_, ok := fake.Token(string(secret.Data["token"]))
+			Expect(ok).To(BeTrue())
+			Expect(secret.Annotations).To(HaveKeyWithValue("tokenaut.appthrust.io/last-updated", now.Format(time.RFC3339)))
+		})
+
+		It("should refresh the token before it expires", func() {
+			name := createIAT("refresh", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{PrivateKeyRef: privateKeyRef()})
+
+			By("refreshing after the token refresh interval")
+			Expect(reconcileIAT(name).RequeueAfter).To(Equal(50 * time.Minute))
+
+			By("refreshing ahead of the expiration when the interval is longer than the token's lifetime")
+			reconciler.TokenRefreshInterval = 2 * time.Hour
+			Expect(reconcileIAT(name).RequeueAfter).To(Equal(fakegithub.TokenLifetime - tokenRefreshBefore))
+
+			By("not refreshing more often than minTokenRequeue when GitHub issues short-lived tokens")
+			reconciler.Now = func() time.Time { return now.Add(58 * time.Minute) }
+			Expect(reconcileIAT(name).RequeueAfter).To(Equal(minTokenRequeue))
+		})
+
+		It("should only write the status when it changed", func() {
+			name := createIAT("status", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{PrivateKeyRef: privateKeyRef()})
+			reconcileIAT(name)
+
+			iat := getIAT(name)
+			Expect(iat.Status.ObservedGeneration).To(Equal(iat.Generation))
+			for _, condition := range iat.Status.Conditions {
+				Expect(condition.ObservedGeneration).To(Equal(iat.Generation), "condition %s", condition.Type)
+			}
+			Expect(iat.Status.LastRefreshTime.Time).To(BeTemporally("==", now))
+			Expect(iat.Status.NextRefreshTime.Time).To(BeTemporally("==", now.Add(50*time.Minute)))
+			readySince := meta.FindStatusCondition(iat.Status.Conditions, "Ready").LastTransitionTime
+
+			By("not writing an unchanged status")
+			reconcileIAT(name)
+			Expect(getIAT(name).ResourceVersion).To(Equal(iat.ResourceVersion))
+
+			By("keeping the lastTransitionTime of conditions that didn't transition")
+			now = now.Add(10 * time.Minute)
+			reconcileIAT(name)
+			iat = getIAT(name)
+			Expect(iat.Status.LastRefreshTime.Time).To(BeTemporally("==", now))
+			Expect(meta.FindStatusCondition(iat.Status.Conditions, "Ready").LastTransitionTime).To(Equal(readySince))
+
+			By("observing the new generation after the spec changed")
+			iat.Spec.Template = &runtime.RawExtension{Raw: []byte(`{"metadata": {"labels": {"team": "platform"}}}`)}
+			Expect(k8sClient.Update(ctx, iat)).To(Succeed())
+			reconcileIAT(name)
+			iat = getIAT(name)
+			Expect(iat.Generation).To(BeNumerically(">", 1))
+			Expect(iat.Status.ObservedGeneration).To(Equal(iat.Generation))
+			expectCondition(iat, "Ready", metav1.ConditionTrue, "AllReady")
+			Expect(meta.FindStatusCondition(iat.Status.Conditions, "Ready").ObservedGeneration).To(Equal(iat.Generation))
+		})
+
+		It("should reapply the status when the object changed in the meantime", func() {
+			name := createIAT("conflict", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{PrivateKeyRef: privateKeyRef()})
+			reconcileIAT(name)
+			original := getIAT(name)
+
+			changed := original.DeepCopy()
+			changed.Annotations = map[string]string{"example.com/owner": "platform"}
+			Expect(k8sClient.Update(ctx, changed)).To(Succeed())
+
+			iat := original.DeepCopy()
+			iat.Status.LastRefreshRequest = "2024-01-01T00:00:00Z"
+			Expect(reconciler.patchStatus(ctx, original, iat)).To(Succeed())
+
+			iat = getIAT(name)
+			Expect(iat.Status.LastRefreshRequest).To(Equal("2024-01-01T00:00:00Z"))
+			Expect(iat.Annotations).To(HaveKeyWithValue("example.com/owner", "platform"))
+		})
+
+		It("should requeue instead of minting while the app is over its rate limit", func() {
+			reconciler.AppRateLimiter = ratelimit.NewPerApp(1.0/60, 1)
+			reconciler.AppRateLimiter.Now = clock
+			limited := createIAT("rate-limited", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{PrivateKeyRef: privateKeyRef()})
+			reconcileIAT(limited)
+			lastRefresh := getIAT(limited).Status.LastRefreshTime
+
+			By("requeuing once the app's budget allows the next mint")
+			name := createIAT("waiting", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{PrivateKeyRef: privateKeyRef()})
+			Expect(reconcileIAT(name).RequeueAfter).To(Equal(time.Minute))
+			Expect(getIAT(name).Status.LastRefreshTime).To(BeNil())
+			Expect(reconcileIAT(limited).RequeueAfter).To(Equal(time.Minute))
+			Expect(getIAT(limited).Status.LastRefreshTime).To(Equal(lastRefresh))
+
+			By("writing the status changed before the rate limit")
+			missing := createIAT("rate-limited-missing-key", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{
+				PrivateKeyRef: &tokenautappthrustiov1alpha1.PrivateKeyRef{Name: "rate-limited-key", Namespace: namespace},
+			})
+			reconcileIAT(missing)
+			expectCondition(getIAT(missing), PrivateKeyMissingCondition, metav1.ConditionTrue, "SecretNotFound")
+			createPrivateKeySecret("rate-limited-key", namespace, key)
+			Expect(reconcileIAT(missing).RequeueAfter).To(Equal(time.Minute))
+			Expect(meta.FindStatusCondition(getIAT(missing).Status.Conditions, PrivateKeyMissingCondition)).To(BeNil())
+
+			By("minting when the budget refilled")
+			now = now.Add(time.Minute)
+			reconcileIAT(name)
+			expectCondition(getIAT(name), "Ready", metav1.ConditionTrue, "AllReady")
+		})
+
+		It("should requeue no later than the token expires", func() {
+			iat := &tokenautappthrustiov1alpha1.InstallationAccessToken{}
+			Expect(reconciler.requeueBeforeExpiry(iat, time.Minute)).To(Equal(time.Minute))
+			iat.Status.Token.ExpiresAt = metav1.NewTime(now.Add(30 * time.Second))
+			Expect(reconciler.requeueBeforeExpiry(iat, time.Minute)).To(Equal(30 * time.Second))
+			Expect(reconciler.requeueBeforeExpiry(iat, 10*time.Second)).To(Equal(10 * time.Second))
+			iat.Status.Token.ExpiresAt = metav1.NewTime(now.Add(-time.Second))
+			Expect(reconciler.requeueBeforeExpiry(iat, time.Minute)).To(Equal(time.Minute))
+		})
+
+		It("should acknowledge refresh requests", func() {
+			name := createIAT("refresh-requested", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{PrivateKeyRef: privateKeyRef()})
+			reconcileIAT(name)
+			first := getSecret("refresh-requested", namespace).Data["token"]
+
+			iat := getIAT(name)
+			iat.Annotations = map[string]string{tokenautappthrustiov1alpha1.RefreshRequestedAtAnnotation: now.Format(time.RFC3339)}
+			Expect(k8sClient.Update(ctx, iat)).To(Succeed())
+			reconcileIAT(name)
+
+			Expect(getIAT(name).Status.LastRefreshRequest).To(Equal(now.Format(time.RFC3339)))
+			Expect(getSecret("refresh-requested", namespace).Data["token"]).NotTo(Equal(first))
+		})
+
+		It("should leave the Secret alone while suspended", func() {
+			name := createIAT("suspended", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{PrivateKeyRef: privateKeyRef()})
+			reconcileIAT(name)
+			token := getSecret("suspended", namespace).Data["token"]
+
+			iat := getIAT(name)
+			iat.Spec.Suspend = true
+			Expect(k8sClient.Update(ctx, iat)).To(Succeed())
+			now = now.Add(20 * time.Minute)
+			Expect(reconcileIAT(name).RequeueAfter).To(Equal(40 * time.Minute))
+
+			iat = getIAT(name)
+			expectCondition(iat, "Suspended", metav1.ConditionTrue, "SuspendedBySpec")
+			Expect(meta.FindStatusCondition(iat.Status.Conditions, "Suspended").Message).To(ContainSubstring("expires in 40m0s"))
+			Expect(iat.Status.NextRefreshTime).To(BeNil())
+			Expect(getSecret("suspended", namespace).Data["token"]).To(Equal(token))
+		})
+	})
+
+	Context("When the token is written to Vault KV", func() {
+		var (
+			vaultData      map[string]string
+			loginAudiences []string
+		)
 
 		BeforeEach(func() {
-			By("creating the custom resource for the Kind InstallationAccessToken")
-			err := k8sClient.Get(ctx, typeNamespacedName, installationaccesstoken)
-			if err != nil && errors.IsNotFound(err) {
-				resource := &tokenautappthrustiov1alpha1.InstallationAccessToken{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      resourceName,
-						Namespace: "default",
-					},
-					// TODO(user): Specify other spec details if needed.
+			vaultData = nil
+			loginAudiences = nil
+			vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/v1/auth/kubernetes/login" {
+					var body struct {
+						JWT string `json:"jwt"`
+					}
+					Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+					claims := &jwt.RegisteredClaims{}
+					_, _, err := jwt.NewParser().ParseUnverified(body.JWT, claims)
+					Expect(err).NotTo(HaveOccurred())
+					loginAudiences = claims.Audience
+					w.Write([]byte(`{"auth": {"client_token": "vault-token"}}`))
+					return
 				}
-				Expect(k8sClient.Create(ctx, resource)).To(Succeed())
-			}
+				if r.Header.Get("X-Vault-Token") != "vault-token" || !strings.HasSuffix(r.URL.Path, "/ci/github") {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				switch r.Method {
+				case http.MethodPost:
+					var body struct {
+						Data map[string]string `json:"data"`
+					}
+					Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+					vaultData = body.Data
+					w.Write([]byte(`{}`))
+				case http.MethodDelete:
+					vaultData = nil
+					w.WriteHeader(http.StatusNoContent)
+				}
+			}))
+			DeferCleanup(vault.Close)
+			reconciler.VaultKV = &vaultkv.Client{Address: vault.URL}
+			Expect(k8sClient.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "vault-token", Namespace: namespace},
+				Data:       map[string][]byte{"token": []byte("vault-token")},
+			})).To(Succeed())
+		})
+
+		It("should delete the secret with the auth it was written with", func() {
+			name := createIAT("vault", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{
+				PrivateKeyRef: privateKeyRef(),
+				Sink: &tokenautappthrustiov1alpha1.Sink{VaultKV: &tokenautappthrustiov1alpha1.VaultKVSink{
+					Path: "ci/github",
+					Auth: tokenautappthrustiov1alpha1.VaultAuth{TokenSecretRef: &tokenautappthrustiov1alpha1.VaultTokenSecretRef{Name: "vault-token"}},
+				}},
+			})
+			reconcileIAT(name)
+			Expect(vaultData).To(HaveKey("token"))
+			iat := getIAT(name)
+			Expect(iat.Status.VaultKVRef).NotTo(BeNil())
+			Expect(iat.Status.VaultKVRef.Auth.TokenSecretRef.Name).To(Equal("vault-token"))
+
+			By("deleting it after the spec switched to another auth")
+			iat.Spec.Sink.VaultKV.Auth = tokenautappthrustiov1alpha1.VaultAuth{TokenSecretRef: &tokenautappthrustiov1alpha1.VaultTokenSecretRef{Name: "not-yet-created"}}
+			Expect(k8sClient.Update(ctx, iat)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, getIAT(name))).To(Succeed())
+			reconcileIAT(name)
+			Expect(vaultData).To(BeNil())
+			err := k8sClient.Get(ctx, name, &tokenautappthrustiov1alpha1.InstallationAccessToken{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should only log in to Vault as ServiceAccounts that opted in", func() {
+			reconciler.VaultAudience = "vault.example.com"
+			serviceAccount := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "github-token-writer", Namespace: namespace}}
+			Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+			name := createIAT("vault-login", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{
+				PrivateKeyRef: privateKeyRef(),
+				Sink: &tokenautappthrustiov1alpha1.Sink{VaultKV: &tokenautappthrustiov1alpha1.VaultKVSink{
+					Path: "ci/github",
+					Auth: tokenautappthrustiov1alpha1.VaultAuth{Kubernetes: &tokenautappthrustiov1alpha1.VaultKubernetesAuth{
+						Role:               "ci",
+						ServiceAccountName: "github-token-writer",
+					}},
+				}},
+			})
+
+			reconcileIAT(name)
+			expectCondition(getIAT(name), "Secret", metav1.ConditionFalse, "Failed")
+			Expect(meta.FindStatusCondition(getIAT(name).Status.Conditions, "Secret").Message).To(ContainSubstring(tokenautappthrustiov1alpha1.VaultKubernetesAuthAnnotation))
+			Expect(loginAudiences).To(BeNil())
+			Expect(vaultData).To(BeNil())
+
+			By("logging in once the ServiceAccount opted in")
+			serviceAccount.Annotations = map[string]string{tokenautappthrustiov1alpha1.VaultKubernetesAuthAnnotation: "true"}
+			Expect(k8sClient.Update(ctx, serviceAccount)).To(Succeed())
+			reconcileIAT(name)
+			expectCondition(getIAT(name), "Secret", metav1.ConditionTrue, "Updated")
+			Expect(loginAudiences).To(Equal([]string{"vault.example.com"}))
+			Expect(vaultData).To(HaveKey("token"))
+		})
+	})
+
+	Context("When the token is written to a remote cluster", func() {
+		var remoteNamespace string
+
+		createRemoteNamespace := func() string {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "tokenaut-remote-"}}
+			Expect(remoteClient.Create(ctx, ns)).To(Succeed())
+			return ns.Name
+		}
+
+		getRemoteSecret := func(name, namespace string) (*corev1.Secret, error) {
+			secret := &corev1.Secret{}
+			return secret, remoteClient.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, secret)
+		}
+
+		BeforeEach(func() {
+			reconciler.RemoteClients = remotecluster.NewCache(newRemoteClient)
+			remoteNamespace = createRemoteNamespace()
+			Expect(k8sClient.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "workload-kubeconfig", Namespace: namespace},
+				Data:       map[string][]byte{remotecluster.DefaultKubeconfigKey: remoteKubeconfig},
+			})).To(Succeed())
 		})
 
-		AfterEach(func() {
-			// TODO(user): Cleanup logic after each test, like removing the resource instance.
-			resource := &tokenautappthrustiov1alpha1.InstallationAccessToken{}
-			err := k8sClient.Get(ctx, typeNamespacedName, resource)
+		It("should write, move and delete the Secret in the remote cluster", func() {
+			name := createIAT("remote", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{
+				PrivateKeyRef: privateKeyRef(),
+				Sink: &tokenautappthrustiov1alpha1.Sink{RemoteCluster: &tokenautappthrustiov1alpha1.RemoteClusterSink{
+					KubeconfigSecretRef: tokenautappthrustiov1alpha1.KubeconfigSecretRef{Name: "workload-kubeconfig"},
+					Namespace:           remoteNamespace,
+				}},
+			})
+
+			By("creating the Secret in the remote cluster")
+			reconcileIAT(name)
+			iat := getIAT(name)
+			expectCondition(iat, "Ready", metav1.ConditionTrue, "AllReady")
+			Expect(iat.Status.RemoteSecretRef).To(Equal(&tokenautappthrustiov1alpha1.RemoteSecretRef{
+				KubeconfigSecretRef: tokenautappthrustiov1alpha1.KubeconfigSecretRef{Name: "workload-kubeconfig"},
+				Name:                "remote",
+				Namespace:           remoteNamespace,
+			}))
+			Expect(iat.Status.SecretRef).To(Equal(tokenautappthrustiov1alpha1.SecretRef{}))
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: "remote", Namespace: namespace}, &corev1.Secret{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			secret, err := getRemoteSecret("remote", remoteNamespace)
+			Expect(err).NotTo(HaveOccurred())
+			first := string(secret.Data["token"])
+			_, ok := fake.Token(first)
+			Expect(ok).To(BeTrue())
+
+			By("updating the Secret in the remote cluster with the next token")
+			now = now.Add(time.Minute)
+			reconcileIAT(name)
+			secret, err = getRemoteSecret("remote", remoteNamespace)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(secret.Data["token"])).NotTo(Equal(first))
+
+			By("deleting the previous Secret once the target namespace changes")
+			target := createRemoteNamespace()
+			iat = getIAT(name)
+			iat.Spec.Sink.RemoteCluster.Namespace = target
+			Expect(k8sClient.Update(ctx, iat)).To(Succeed())
+			reconcileIAT(name)
+			Expect(getIAT(name).Status.RemoteSecretRef.Namespace).To(Equal(target))
+			_, err = getRemoteSecret("remote", target)
 			Expect(err).NotTo(HaveOccurred())
+			_, err = getRemoteSecret("remote", remoteNamespace)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
 
-			By("Cleanup the specific resource instance InstallationAccessToken")
-			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			By("deleting the Secret from the remote cluster along with the InstallationAccessToken")
+			Expect(k8sClient.Delete(ctx, getIAT(name))).To(Succeed())
+			reconcileIAT(name)
+			_, err = getRemoteSecret("remote", target)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			err = k8sClient.Get(ctx, name, &tokenautappthrustiov1alpha1.InstallationAccessToken{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
 		})
-		It("should successfully reconcile the resource", func() {
-			By("Reconciling the created resource")
-			controllerReconciler := &InstallationAccessTokenReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+	})
+
+	Context("When the private key can't be used", func() {
+		It("should report a missing private key Secret", func() {
+			name := createIAT("missing-key", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{
+				PrivateKeyRef: &tokenautappthrustiov1alpha1.PrivateKeyRef{Name: "does-not-exist", Namespace: namespace},
+			})
+
+			Expect(reconcileIAT(name).RequeueAfter).To(Equal(10 * time.Second))
+
+			iat := getIAT(name)
+			expectCondition(iat, PrivateKeyMissingCondition, metav1.ConditionTrue, "SecretNotFound")
+			expectCondition(iat, "Token", metav1.ConditionFalse, "Failed")
+			expectCondition(iat, "Ready", metav1.ConditionFalse, "NotReady")
+			expectCondition(iat, StalledCondition, metav1.ConditionTrue, "InvalidConfiguration")
+			Expect(iat.Status.TokenValid).To(BeFalse())
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: "missing-key", Namespace: namespace}, &corev1.Secret{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+			By("clearing the condition once the Secret is created")
+			createPrivateKeySecret("does-not-exist", namespace, key)
+			reconcileIAT(name)
+			iat = getIAT(name)
+			Expect(meta.FindStatusCondition(iat.Status.Conditions, PrivateKeyMissingCondition)).To(BeNil())
+			Expect(meta.FindStatusCondition(iat.Status.Conditions, StalledCondition)).To(BeNil())
+			expectCondition(iat, "Ready", metav1.ConditionTrue, "AllReady")
+		})
+
+		It("should only pass private key Secret updates that change the key or the namespaces allowed to use it", func() {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "key", Namespace: namespace},
+				Data:       map[string][]byte{privatekey.DefaultSecretKey: []byte("key")},
+			}
+			updated := func(mutate func(*corev1.Secret)) bool {
+				newSecret := secret.DeepCopy()
+				mutate(newSecret)
+				return secretDataChangedPredicate().Update(event.UpdateEvent{ObjectOld: secret, ObjectNew: newSecret})
 			}
 
-			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
-				NamespacedName: typeNamespacedName,
+			Expect(updated(func(s *corev1.Secret) {})).To(BeFalse())
+			Expect(updated(func(s *corev1.Secret) { s.Labels = map[string]string{"team": "platform"} })).To(BeFalse())
+			Expect(updated(func(s *corev1.Secret) { s.Data[privatekey.DefaultSecretKey] = []byte("rotated") })).To(BeTrue())
+			Expect(updated(func(s *corev1.Secret) {
+				s.Annotations = map[string]string{tokenautappthrustiov1alpha1.AllowedNamespacesAnnotation: namespace}
+			})).To(BeTrue())
+		})
+
+		It("should report a private key Secret without the key", func() {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "wrong-key", Namespace: namespace},
+				Data:       map[string][]byte{"other": []byte("value")},
+			}
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			name := createIAT("wrong-key", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{
+				PrivateKeyRef: &tokenautappthrustiov1alpha1.PrivateKeyRef{Name: "wrong-key", Namespace: namespace},
 			})
+
+			reconcileIAT(name)
+
+			iat := getIAT(name)
+			Expect(meta.FindStatusCondition(iat.Status.Conditions, PrivateKeyMissingCondition)).To(BeNil())
+			expectCondition(iat, "Token", metav1.ConditionFalse, "Failed")
+			expectCondition(iat, "Ready", metav1.ConditionFalse, "NotReady")
+		})
+
+		It("should report a private key GitHub rejects", func() {
+			otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
 			Expect(err).NotTo(HaveOccurred())
-			// TODO(user): Add more specific assertions depending on your controller's reconciliation logic.
-			// Example: If you expect a certain status condition after reconciliation, verify it here.
+			fake.SetPublicKeys(testAppID, &otherKey.PublicKey)
+			name := createIAT("rejected", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{PrivateKeyRef: privateKeyRef()})
+
+			reconcileIAT(name)
+
+			iat := getIAT(name)
+			expectCondition(iat, "Token", metav1.ConditionFalse, "Failed")
+			Expect(meta.FindStatusCondition(iat.Status.Conditions, "Token").Message).To(ContainSubstring("401"))
+			Expect(iat.Status.RejectedKeyFingerprints).To(HaveLen(1))
+			expectCondition(iat, StalledCondition, metav1.ConditionTrue, "TokenCreationError")
+			Expect(meta.FindStatusCondition(iat.Status.Conditions, ReconcilingCondition)).To(BeNil())
+		})
+
+		It("should report a suspended installation", func() {
+			fake.SetSuspended(testInstallationID, true)
+			name := createIAT("installation-suspended", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{PrivateKeyRef: privateKeyRef()})
+
+			reconcileIAT(name)
+
+			iat := getIAT(name)
+			expectCondition(iat, "Token", metav1.ConditionFalse, "Failed")
+			Expect(meta.FindStatusCondition(iat.Status.Conditions, "Token").Message).To(ContainSubstring("403"))
+		})
+
+		It("should report it reconciling while GitHub fails, even once the token expired", func() {
+			name := createIAT("failing", tokenautappthrustiov1alpha1.InstallationAccessTokenSpec{PrivateKeyRef: privateKeyRef()})
+			reconcileIAT(name)
+			iat := getIAT(name)
+			Expect(iat.Status.TokenValid).To(BeTrue())
+			Expect(meta.FindStatusCondition(iat.Status.Conditions, ReconcilingCondition)).To(BeNil())
+			Expect(meta.FindStatusCondition(iat.Status.Conditions, StalledCondition)).To(BeNil())
+
+			By("retrying while the token is still valid")
+			fake.SetSuspended(testInstallationID, true)
+			now = now.Add(50 * time.Minute)
+			reconcileIAT(name)
+			iat = getIAT(name)
+			Expect(iat.Status.TokenValid).To(BeTrue())
+			expectCondition(iat, ReconcilingCondition, metav1.ConditionTrue, "TokenCreationError")
+			Expect(meta.FindStatusCondition(iat.Status.Conditions, StalledCondition)).To(BeNil())
+
+			By("still retrying once the token expired")
+			now = now.Add(10 * time.Minute)
+			reconcileIAT(name)
+			iat = getIAT(name)
+			Expect(iat.Status.TokenValid).To(BeFalse())
+			expectCondition(iat, ReconcilingCondition, metav1.ConditionTrue, "TokenCreationError")
+			Expect(meta.FindStatusCondition(iat.Status.Conditions, ReconcilingCondition).Message).To(HavePrefix("Retrying without a valid token"))
+			Expect(meta.FindStatusCondition(iat.Status.Conditions, StalledCondition)).To(BeNil())
+
+			By("recovering once GitHub issues a token again")
+			fake.SetSuspended(testInstallationID, false)
+			reconcileIAT(name)
+			iat = getIAT(name)
+			Expect(iat.Status.TokenValid).To(BeTrue())
+			Expect(meta.FindStatusCondition(iat.Status.Conditions, ReconcilingCondition)).To(BeNil())
+			expectCondition(iat, "Ready", metav1.ConditionTrue, "AllReady")
 		})
 	})
 })
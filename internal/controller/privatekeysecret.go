@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	"github.com/appthrust/tokenaut/internal/privatekey"
+)
+
+const (
+	// privateKeySecretIndex indexes InstallationAccessTokens by the "namespace/name" of the private key Secrets they read
+	privateKeySecretIndex = ".spec.privateKeySecrets"
+
+	// PrivateKeyMissingCondition is set while none of the private key Secrets of a resource exists or may be used
+	PrivateKeyMissingCondition = "PrivateKeyMissing"
+)
+
+// privateKeyMissingReason returns the reason of the PrivateKeyMissing condition for an error resolving private keys,
+// or "" when the error does not mean the key Secret is missing
+func privateKeyMissingReason(err error) string {
+	switch {
+	case errors.Is(err, privatekey.ErrUnavailable):
+		// Strict mode doesn't tell missing Secrets apart from those that may not be used
+		return "SecretUnavailable"
+	case apierrors.IsNotFound(err):
+		return "SecretNotFound"
+	default:
+		return ""
+	}
+}
+
+// indexByPrivateKeySecret returns the private key Secrets of an InstallationAccessToken for privateKeySecretIndex
+func (r *InstallationAccessTokenReconciler) indexByPrivateKeySecret(obj client.Object) []string {
+	iat := obj.(*tokenautv1alpha1.InstallationAccessToken)
+	return r.Signers.PrivateKeySecrets(iat.Namespace, iat.Spec.PrivateKeyRef, iat.Spec.PrivateKeyRefs, iat.Spec.Signer)
+}
+
+// requestsForPrivateKeySecret enqueues the InstallationAccessTokens that read their private key from the Secret
+func (r *InstallationAccessTokenReconciler) requestsForPrivateKeySecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	var iats tokenautv1alpha1.InstallationAccessTokenList
+	if err := r.List(ctx, &iats, client.MatchingFields{privateKeySecretIndex: client.ObjectKeyFromObject(obj).String()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list InstallationAccessTokens using the private key Secret",
+			"secretName", obj.GetName(),
+			"secretNamespace", obj.GetNamespace())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(iats.Items))
+	for _, iat := range iats.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&iat)})
+	}
+	return requests
+}
+
+// secretDataChangedPredicate passes Secret creations and deletions, and only those updates that change the
+// Secret's data or the namespaces allowed to use it, so that other metadata changes and resyncs don't issue new tokens
+func secretDataChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldSecret, ok := e.ObjectOld.(*corev1.Secret)
+			if !ok {
+				return false
+			}
+			newSecret, ok := e.ObjectNew.(*corev1.Secret)
+			if !ok {
+				return false
+			}
+			if len(oldSecret.Data) != len(newSecret.Data) {
+				return true
+			}
+			for k, v := range newSecret.Data {
+				if old, ok := oldSecret.Data[k]; !ok || !bytes.Equal(old, v) {
+					return true
+				}
+			}
+			// In strict mode the annotation decides which resources may use the key
+			oldAllowed, oldOK := oldSecret.Annotations[tokenautv1alpha1.AllowedNamespacesAnnotation]
+			newAllowed, newOK := newSecret.Annotations[tokenautv1alpha1.AllowedNamespacesAnnotation]
+			return oldOK != newOK || oldAllowed != newAllowed
+		},
+		GenericFunc: func(event.GenericEvent) bool {
+			return false
+		},
+	}
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+)
+
+// createOrUpdateSecret creates the rendered secret, updating it when it already exists
+func createOrUpdateSecret(ctx context.Context, c client.Client, secret *corev1.Secret) error {
+	err := c.Create(ctx, secret)
+	if err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			// Secret already exists, update it
+			err = c.Update(ctx, secret)
+			if err != nil {
+				return errors.Errorf("failed to update secret: %v", err)
+			}
+		} else {
+			return errors.Errorf("failed to create secret: %v", err)
+		}
+	}
+	return nil
+}
+
+// deleteSecret deletes the named secret, ignoring a secret that is already gone
+func deleteSecret(ctx context.Context, c client.Client, name, namespace string) error {
+	if name == "" || namespace == "" {
+		return nil
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+	}
+	if err := c.Delete(ctx, secret); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// deleteReplacedSecret deletes the Secret recorded in previous when secret was written to another one,
+// e.g. after the name or namespace in the template changed, so that it isn't left behind with a live token
+func deleteReplacedSecret(ctx context.Context, c client.Client, previous tokenautv1alpha1.SecretRef, secret *corev1.Secret) error {
+	if previous.Name == secret.Name && previous.Namespace == secret.Namespace {
+		return nil
+	}
+	return deleteSecret(ctx, c, previous.Name, previous.Namespace)
+}
@@ -0,0 +1,299 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	"github.com/appthrust/tokenaut/internal/remotecluster"
+	"github.com/appthrust/tokenaut/internal/vaultkv"
+)
+
+const (
+	// DefaultVaultAudience is the audience of ServiceAccount tokens presented to Vault's Kubernetes auth method
+	DefaultVaultAudience = "vault"
+
+	// DefaultVaultTokenSecretKey is the key holding the token in a Vault token Secret
+	DefaultVaultTokenSecretKey = "token"
+
+	vaultTokenExpirationSeconds = 10 * 60
+)
+
+// tokenSink is where the rendered Secret of an InstallationAccessToken is written
+type tokenSink interface {
+	// Put writes the rendered Secret, replacing what was written before
+	Put(ctx context.Context, secret *corev1.Secret) error
+	// Delete removes what Put wrote. Deleting something that doesn't exist is not an error.
+	Delete(ctx context.Context) error
+	// String identifies the destination
+	String() string
+}
+
+// secretSink writes the rendered Secret to the Kubernetes API
+type secretSink struct {
+	client    client.Client
+	name      string
+	namespace string
+}
+
+func (s *secretSink) Put(ctx context.Context, secret *corev1.Secret) error {
+	return createOrUpdateSecret(ctx, s.client, secret)
+}
+
+func (s *secretSink) Delete(ctx context.Context) error {
+	return deleteSecret(ctx, s.client, s.name, s.namespace)
+}
+
+func (s *secretSink) String() string {
+	return fmt.Sprintf("Secret %s/%s", s.namespace, s.name)
+}
+
+// remoteSecretSink writes the rendered Secret to the cluster of a kubeconfig Secret
+type remoteSecretSink struct {
+	// reader reads the kubeconfig Secret from sourceNamespace, the InstallationAccessToken's namespace
+	reader          client.Reader
+	sourceNamespace string
+	kubeconfig      tokenautv1alpha1.KubeconfigSecretRef
+	clients         *remotecluster.Cache
+	name            string
+	namespace       string
+}
+
+func (s *remoteSecretSink) Put(ctx context.Context, secret *corev1.Secret) error {
+	c, err := s.client(ctx)
+	if err != nil {
+		return err
+	}
+	secret = secret.DeepCopy()
+	secret.Namespace = s.namespace
+	return createOrUpdateSecret(ctx, c, secret)
+}
+
+func (s *remoteSecretSink) Delete(ctx context.Context) error {
+	c, err := s.client(ctx)
+	if err != nil {
+		return err
+	}
+	return deleteSecret(ctx, c, s.name, s.namespace)
+}
+
+func (s *remoteSecretSink) String() string {
+	return fmt.Sprintf("Secret %s/%s in the cluster of kubeconfig Secret %s/%s", s.namespace, s.name, s.sourceNamespace, s.kubeconfig.Name)
+}
+
+// client connects to the remote cluster with the current content of the kubeconfig Secret, reusing the
+// client built for it as long as the Secret doesn't change
+func (s *remoteSecretSink) client(ctx context.Context) (client.Client, error) {
+	key := s.kubeconfig.Key
+	if key == "" {
+		key = remotecluster.DefaultKubeconfigKey
+	}
+	var secret corev1.Secret
+	if err := s.reader.Get(ctx, types.NamespacedName{Name: s.kubeconfig.Name, Namespace: s.sourceNamespace}, &secret); err != nil {
+		return nil, errors.Errorf("failed to get the kubeconfig secret \"%s\" in namespace \"%s\": %v", s.kubeconfig.Name, s.sourceNamespace, err)
+	}
+	if _, ok := secret.Data[key]; !ok {
+		return nil, errors.Errorf("the kubeconfig secret \"%s\" in namespace \"%s\" has no key \"%s\"", s.kubeconfig.Name, s.sourceNamespace, key)
+	}
+	c, err := s.clients.Client(&secret, key)
+	if err != nil {
+		return nil, errors.Errorf("failed to connect with the kubeconfig secret \"%s\" in namespace \"%s\": %v", s.kubeconfig.Name, s.sourceNamespace, err)
+	}
+	return c, nil
+}
+
+// sinkFor returns the sink selected by the spec for the rendered Secret
+func (r *InstallationAccessTokenReconciler) sinkFor(iat *tokenautv1alpha1.InstallationAccessToken, secret *corev1.Secret) (tokenSink, error) {
+	sink := iat.Spec.Sink
+	switch {
+	case sink == nil:
+		return &secretSink{client: r.Client, name: secret.Name, namespace: secret.Namespace}, nil
+	case sink.VaultKV != nil && sink.RemoteCluster == nil:
+		return r.vaultKVSink(iat, sink.VaultKV.Mount, sink.VaultKV.Path, &sink.VaultKV.Auth)
+	case sink.RemoteCluster != nil && sink.VaultKV == nil:
+		namespace := sink.RemoteCluster.Namespace
+		if namespace == "" {
+			namespace = secret.Namespace
+		}
+		return r.remoteSecretSink(iat, sink.RemoteCluster.KubeconfigSecretRef, secret.Name, namespace)
+	default:
+		return nil, errors.New("exactly one of `spec.sink.vaultKV` and `spec.sink.remoteCluster` must be set")
+	}
+}
+
+// recordedSink returns the sink the status says the rendered Secret was last written to, or nil
+func (r *InstallationAccessTokenReconciler) recordedSink(iat *tokenautv1alpha1.InstallationAccessToken) (tokenSink, error) {
+	switch {
+	case iat.Status.RemoteSecretRef != nil:
+		ref := iat.Status.RemoteSecretRef
+		return r.remoteSecretSink(iat, ref.KubeconfigSecretRef, ref.Name, ref.Namespace)
+	case iat.Status.VaultKVRef != nil:
+		// Statuses written before the auth was recorded fall back to the spec's
+		auth := iat.Status.VaultKVRef.Auth
+		if auth == nil && iat.Spec.Sink != nil && iat.Spec.Sink.VaultKV != nil {
+			auth = &iat.Spec.Sink.VaultKV.Auth
+		}
+		return r.vaultKVSink(iat, iat.Status.VaultKVRef.Mount, iat.Status.VaultKVRef.Path, auth)
+	case iat.Status.SecretRef.Name != "" && iat.Status.SecretRef.Namespace != "":
+		return &secretSink{client: r.Client, name: iat.Status.SecretRef.Name, namespace: iat.Status.SecretRef.Namespace}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// recordSink records in the status where the rendered Secret was written
+func recordSink(iat *tokenautv1alpha1.InstallationAccessToken, sink tokenSink) {
+	switch s := sink.(type) {
+	case *secretSink:
+		iat.Status.SecretRef = tokenautv1alpha1.SecretRef{Name: s.name, Namespace: s.namespace}
+		iat.Status.VaultKVRef = nil
+		iat.Status.RemoteSecretRef = nil
+	case *vaultKVSink:
+		iat.Status.SecretRef = tokenautv1alpha1.SecretRef{}
+		iat.Status.VaultKVRef = &tokenautv1alpha1.VaultKVRef{Mount: s.Mount, Path: s.Path, Auth: s.auth.DeepCopy()}
+		iat.Status.RemoteSecretRef = nil
+	case *remoteSecretSink:
+		iat.Status.SecretRef = tokenautv1alpha1.SecretRef{}
+		iat.Status.VaultKVRef = nil
+		iat.Status.RemoteSecretRef = &tokenautv1alpha1.RemoteSecretRef{KubeconfigSecretRef: s.kubeconfig, Name: s.name, Namespace: s.namespace}
+	}
+}
+
+// remoteSecretSink returns a sink writing to the cluster of the kubeconfig Secret in the InstallationAccessToken's namespace
+func (r *InstallationAccessTokenReconciler) remoteSecretSink(iat *tokenautv1alpha1.InstallationAccessToken, kubeconfig tokenautv1alpha1.KubeconfigSecretRef, name, namespace string) (tokenSink, error) {
+	if r.RemoteClients == nil {
+		return nil, errors.New("remote cluster sinks are disabled; start the manager with --remote-cluster-sinks to enable them")
+	}
+	if kubeconfig.Name == "" {
+		return nil, errors.New("`spec.sink.remoteCluster.kubeconfigSecretRef.name` is required")
+	}
+	return &remoteSecretSink{
+		reader:          r.Client,
+		sourceNamespace: iat.Namespace,
+		kubeconfig:      kubeconfig,
+		clients:         r.RemoteClients,
+		name:            name,
+		namespace:       namespace,
+	}, nil
+}
+
+// forgetRemoteClients drops the remote cluster clients built from deleted kubeconfig Secrets. Secrets outside the
+// cache, e.g. with --secret-label-selector, are never seen deleted; the cache's bound drops their clients instead.
+func (r *InstallationAccessTokenReconciler) forgetRemoteClients() handler.EventHandler {
+	return handler.Funcs{
+		DeleteFunc: func(_ context.Context, e event.DeleteEvent, _ workqueue.RateLimitingInterface) {
+			r.RemoteClients.Forget(e.Object.GetUID())
+		},
+	}
+}
+
+// vaultKVSink writes to Vault KV and remembers how it authenticates, so that the status can record it
+// and the secret can later be deleted with the same credentials even after the spec changed
+type vaultKVSink struct {
+	*vaultkv.Sink
+	auth tokenautv1alpha1.VaultAuth
+}
+
+// vaultKVSink returns a Vault KV sink for the path, authenticated with auth.
+// Credentials are always taken from the InstallationAccessToken's own namespace.
+func (r *InstallationAccessTokenReconciler) vaultKVSink(iat *tokenautv1alpha1.InstallationAccessToken, mount, path string, auth *tokenautv1alpha1.VaultAuth) (tokenSink, error) {
+	if r.VaultKV == nil {
+		return nil, errors.New("Vault KV sinks are disabled; start the manager with --vault-address to enable them")
+	}
+	if mount == "" {
+		mount = vaultkv.DefaultMount
+	}
+	for _, p := range []string{mount, path} {
+		if strings.Trim(p, "/") == "" || strings.Contains("/"+p+"/", "/../") {
+			return nil, errors.Errorf("invalid Vault KV path %q", p)
+		}
+	}
+	if auth == nil {
+		return nil, errors.New("`spec.sink.vaultKV.auth` is required to delete the token from Vault")
+	}
+
+	var token func(context.Context) (string, error)
+	switch {
+	case auth.Kubernetes != nil && auth.TokenSecretRef == nil:
+		k8sAuth := *auth.Kubernetes
+		token = func(ctx context.Context) (string, error) {
+			return r.vaultKubernetesLogin(ctx, iat.Namespace, k8sAuth)
+		}
+	case auth.TokenSecretRef != nil && auth.Kubernetes == nil:
+		ref := *auth.TokenSecretRef
+		token = func(ctx context.Context) (string, error) {
+			return r.vaultTokenFromSecret(ctx, iat.Namespace, ref)
+		}
+	default:
+		return nil, errors.New("exactly one of `spec.sink.vaultKV.auth.kubernetes` and `spec.sink.vaultKV.auth.tokenSecretRef` must be set")
+	}
+	return &vaultKVSink{Sink: &vaultkv.Sink{Client: r.VaultKV, Mount: mount, Path: path, Token: token}, auth: *auth.DeepCopy()}, nil
+}
+
+// vaultKubernetesLogin requests a short-lived token for the ServiceAccount and exchanges it for a Vault token.
+// The ServiceAccount must opt in with VaultKubernetesAuthAnnotation, so that creating an InstallationAccessToken
+// doesn't give its author the Vault role of every ServiceAccount of the namespace.
+func (r *InstallationAccessTokenReconciler) vaultKubernetesLogin(ctx context.Context, namespace string, auth tokenautv1alpha1.VaultKubernetesAuth) (string, error) {
+	serviceAccountName := auth.ServiceAccountName
+	if serviceAccountName == "" {
+		serviceAccountName = "default"
+	}
+	var serviceAccount corev1.ServiceAccount
+	if err := r.apiReader().Get(ctx, types.NamespacedName{Name: serviceAccountName, Namespace: namespace}, &serviceAccount); err != nil {
+		return "", errors.Errorf("failed to get the ServiceAccount \"%s\" in namespace \"%s\": %v", serviceAccountName, namespace, err)
+	}
+	if serviceAccount.Annotations[tokenautv1alpha1.VaultKubernetesAuthAnnotation] != "true" {
+		return "", errors.Errorf("the ServiceAccount \"%s\" in namespace \"%s\" must be annotated with %s: \"true\" to log in to Vault as it", serviceAccountName, namespace, tokenautv1alpha1.VaultKubernetesAuthAnnotation)
+	}
+
+	audience := r.VaultAudience
+	if audience == "" {
+		audience = DefaultVaultAudience
+	}
+	expirationSeconds := int64(vaultTokenExpirationSeconds)
+	tokenRequest := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences:         []string{audience},
+			ExpirationSeconds: &expirationSeconds,
+		},
+	}
+	if err := r.SubResource("token").Create(ctx, &serviceAccount, tokenRequest); err != nil {
+		return "", errors.Errorf("failed to request a token for the ServiceAccount \"%s\" in namespace \"%s\": %v", serviceAccountName, namespace, err)
+	}
+	return r.VaultKV.KubernetesLogin(ctx, auth.Mount, auth.Role, tokenRequest.Status.Token)
+}
+
+// apiReader returns the reader for objects the manager doesn't cache
+func (r *InstallationAccessTokenReconciler) apiReader() client.Reader {
+	if r.APIReader == nil {
+		return r.Client
+	}
+	return r.APIReader
+}
+
+// vaultTokenFromSecret reads a Vault token from a Secret
+func (r *InstallationAccessTokenReconciler) vaultTokenFromSecret(ctx context.Context, namespace string, ref tokenautv1alpha1.VaultTokenSecretRef) (string, error) {
+	key := ref.Key
+	if key == "" {
+		key = DefaultVaultTokenSecretKey
+	}
+	var secret corev1.Secret
+	if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, &secret); err != nil {
+		return "", errors.Errorf("failed to get the Vault token secret \"%s\" in namespace \"%s\": %v", ref.Name, namespace, err)
+	}
+	token := strings.TrimSpace(string(secret.Data[key]))
+	if token == "" {
+		return "", errors.Errorf("the Vault token secret \"%s\" in namespace \"%s\" has no key \"%s\"", ref.Name, namespace, key)
+	}
+	return token, nil
+}
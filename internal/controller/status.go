@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// setStatusCondition sets a condition, bumping its transition time only when the status changes
+func setStatusCondition(conditions *[]metav1.Condition, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:    conditionType,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+// patchStatus writes the status of obj changed since original in a single merge patch, conditional on the
+// resourceVersion it was computed against. copyStatus copies the status of one object to another. On a conflict
+// the latest object is read and the status reapplied to it, so that e.g. an annotation added during the reconcile
+// doesn't lose the status. Nothing is written when the status didn't change.
+func patchStatus[O any, T interface {
+	*O
+	client.Object
+}](ctx context.Context, c client.Client, original, obj T, copyStatus func(from, to T)) error {
+	base := original
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		patched := base.DeepCopyObject().(T)
+		copyStatus(obj, patched)
+		if equality.Semantic.DeepEqual(base, patched) {
+			return nil
+		}
+		err := c.Status().Patch(ctx, patched, client.MergeFromWithOptions(base, client.MergeFromWithOptimisticLock{}))
+		if apierrors.IsConflict(err) {
+			latest := T(new(O))
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), latest); err != nil {
+				return err
+			}
+			base = latest
+		}
+		return err
+	})
+}
@@ -33,6 +33,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	tokenautappthrustiov1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	"github.com/appthrust/tokenaut/internal/remotecluster"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -43,6 +44,17 @@ var cfg *rest.Config
 var k8sClient client.Client
 var testEnv *envtest.Environment
 
+// remoteEnv is a second API server standing in for the workload cluster of a remote cluster sink.
+// remoteKubeconfig connects to it with inline credentials, as a kubeconfig Secret would.
+var remoteEnv *envtest.Environment
+var remoteClient client.Client
+var remoteKubeconfig []byte
+
+// newRemoteClient builds the clients of remote cluster sinks, as the manager does
+func newRemoteClient(kubeconfig []byte) (client.Client, error) {
+	return remotecluster.NewClient(kubeconfig, scheme.Scheme)
+}
+
 func TestControllers(t *testing.T) {
 	RegisterFailHandler(Fail)
 
@@ -81,10 +93,21 @@ var _ = BeforeSuite(func() {
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
 
+	By("bootstrapping the remote cluster")
+	remoteEnv = &envtest.Environment{BinaryAssetsDirectory: testEnv.BinaryAssetsDirectory}
+	remoteCfg, err := remoteEnv.Start()
+	Expect(err).NotTo(HaveOccurred())
+	remoteClient, err = client.New(remoteCfg, client.Options{Scheme: scheme.Scheme})
+	Expect(err).NotTo(HaveOccurred())
+	remoteUser, err := remoteEnv.AddUser(envtest.User{Name: "tokenaut", Groups: []string{"system:masters"}}, nil)
+	Expect(err).NotTo(HaveOccurred())
+	remoteKubeconfig, err = remoteUser.KubeConfig()
+	Expect(err).NotTo(HaveOccurred())
 })
 
 var _ = AfterSuite(func() {
 	By("tearing down the test environment")
 	err := testEnv.Stop()
 	Expect(err).NotTo(HaveOccurred())
+	Expect(remoteEnv.Stop()).To(Succeed())
 })
@@ -0,0 +1,210 @@
+package gitcredential
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/appthrust/tokenaut/pkg/brokerapi"
+)
+
+// Username is the user name GitHub expects alongside an installation access token
+const Username = "x-access-token"
+
+// Request holds the attributes git passes to a credential helper
+type Request struct {
+	Protocol string
+	Host     string
+	Path     string
+}
+
+// ReadRequest parses git's key=value credential description, terminated by a blank line or EOF
+func ReadRequest(r io.Reader) (*Request, error) {
+	req := &Request{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, errors.Errorf("invalid credential line: %q", line)
+		}
+		switch key {
+		case "protocol":
+			req.Protocol = value
+		case "host":
+			req.Host = value
+		case "path":
+			req.Path = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Errorf("failed to read credential request: %v", err)
+	}
+	return req, nil
+}
+
+// Helper answers git credential requests with tokens from a mounted file or the tokenaut broker
+type Helper struct {
+	// Hosts the helper provides credentials for, e.g. github.com or a GHES hostname
+	Hosts []string
+
+	// TokenFile is a file holding the token, typically a key of a Secret managed by an InstallationAccessToken
+	TokenFile string
+
+	// BrokerURL is the base URL of the tokenaut token broker, used when TokenFile is empty
+	BrokerURL string
+
+	// ServiceAccountTokenFile is the projected ServiceAccount token presented to the broker
+	ServiceAccountTokenFile string
+
+	// Binding optionally selects the TokenBinding to use
+	Binding string
+
+	// BrokerCAFile is an optional CA bundle used to verify the broker's certificate
+	BrokerCAFile string
+
+	// HTTPClient is used to call the broker. A default client is used when nil.
+	HTTPClient *http.Client
+}
+
+// Run executes a credential helper action. Only "get" produces output; "store" and "erase"
+// are accepted and ignored because tokens are short-lived and managed outside git.
+func (h *Helper) Run(action string, in io.Reader, out io.Writer) error {
+	req, err := ReadRequest(in)
+	if err != nil {
+		return err
+	}
+	if action != "get" {
+		return nil
+	}
+	if req.Protocol != "https" || !h.servesHost(req.Host) {
+		return nil
+	}
+
+	token, expiresAt, err := h.token()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "protocol=%s\n", req.Protocol)
+	fmt.Fprintf(out, "host=%s\n", req.Host)
+	fmt.Fprintf(out, "username=%s\n", Username)
+	fmt.Fprintf(out, "password=%s\n", token)
+	if !expiresAt.IsZero() {
+		fmt.Fprintf(out, "password_expiry_utc=%d\n", expiresAt.Unix())
+	}
+	return nil
+}
+
+func (h *Helper) servesHost(host string) bool {
+	hosts := h.Hosts
+	if len(hosts) == 0 {
+		hosts = []string{"github.com"}
+	}
+	for _, h := range hosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Helper) token() (string, time.Time, error) {
+	if h.TokenFile != "" {
+		b, err := os.ReadFile(h.TokenFile)
+		if err != nil {
+			return "", time.Time{}, errors.Errorf("failed to read token file: %v", err)
+		}
+		token := strings.TrimSpace(string(b))
+		if token == "" {
+			return "", time.Time{}, errors.Errorf("token file \"%s\" is empty", h.TokenFile)
+		}
+		return token, time.Time{}, nil
+	}
+	if h.BrokerURL != "" {
+		return h.tokenFromBroker()
+	}
+	return "", time.Time{}, errors.New("neither a token file nor a broker URL is configured")
+}
+
+func (h *Helper) tokenFromBroker() (string, time.Time, error) {
+	saToken, err := os.ReadFile(h.ServiceAccountTokenFile)
+	if err != nil {
+		return "", time.Time{}, errors.Errorf("failed to read ServiceAccount token: %v", err)
+	}
+
+	var body io.Reader
+	if h.Binding != "" {
+		b, err := json.Marshal(brokerapi.TokenRequest{Binding: h.Binding})
+		if err != nil {
+			return "", time.Time{}, errors.Errorf("error marshaling request: %v", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(h.BrokerURL, "/")+brokerapi.TokenPath, body)
+	if err != nil {
+		return "", time.Time{}, errors.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(saToken)))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient, err := h.httpClient()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, errors.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, errors.Errorf("error reading response body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, errors.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	var tokenResp brokerapi.TokenResponse
+	if err := json.Unmarshal(respBody, &tokenResp); err != nil {
+		return "", time.Time{}, errors.Errorf("error unmarshaling response: %v", err)
+	}
+	return tokenResp.Token, tokenResp.ExpiresAt, nil
+}
+
+func (h *Helper) httpClient() (*http.Client, error) {
+	if h.HTTPClient != nil {
+		return h.HTTPClient, nil
+	}
+	if h.BrokerCAFile == "" {
+		return &http.Client{Timeout: 30 * time.Second}, nil
+	}
+	caPEM, err := os.ReadFile(h.BrokerCAFile)
+	if err != nil {
+		return nil, errors.Errorf("failed to read broker CA file: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.Errorf("no certificates found in broker CA file \"%s\"", h.BrokerCAFile)
+	}
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+		},
+	}, nil
+}
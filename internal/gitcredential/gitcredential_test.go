@@ -0,0 +1,126 @@
+package gitcredential
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appthrust/tokenaut/pkg/brokerapi"
+)
+
+func TestRunWithTokenFile(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("ghs_from_file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	helper := &Helper{Hosts: []string{"github.com", "ghe.example.com"}, TokenFile: tokenFile}
+
+	testCases := []struct {
+		name   string
+		action string
+		input  string
+		want   string
+	}{
+		{
+			name:   "Get for github.com",
+			action: "get",
+			input:  "protocol=https\nhost=github.com\npath=my-org/my-repo.git\n\n",
+			want:   "protocol=https\nhost=github.com\nusername=x-access-token\npassword=ghs_from_file\n",
+		},
+		{
+			name:   "Get for GHES host",
+			action: "get",
+			input:  "protocol=https\nhost=GHE.example.com\n",
+			want:   "protocol=https\nhost=GHE.example.com\nusername=x-access-token\npassword=ghs_from_file\n",
+		},
+		{
+			name:   "Get for unrelated host",
+			action: "get",
+			input:  "protocol=https\nhost=gitlab.com\n\n",
+			want:   "",
+		},
+		{
+			name:   "Get over plain HTTP",
+			action: "get",
+			input:  "protocol=http\nhost=github.com\n\n",
+			want:   "",
+		},
+		{
+			name:   "Store is ignored",
+			action: "store",
+			input:  "protocol=https\nhost=github.com\nusername=x-access-token\npassword=ghs_from_file\n\n",
+			want:   "",
+		},
+		{
+			name:   "Erase is ignored",
+			action: "erase",
+			input:  "protocol=https\nhost=github.com\n\n",
+			want:   "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := new(strings.Builder)
+			if err := helper.Run(tc.action, strings.NewReader(tc.input), out); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if out.String() != tc.want {
+				t.Errorf("Expected output %q, got %q", tc.want, out.String())
+			}
+		})
+	}
+}
+
+func TestRunWithBroker(t *testing.T) {
+	expiresAt := time.Date(2024, 4, 1, 13, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != brokerapi.TokenPath {
+			t.Errorf("Expected path %s, got %s", brokerapi.TokenPath, r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer sa-token" {
+			t.Errorf("Expected Authorization header 'Bearer sa-token', got %s", r.Header.Get("Authorization"))
+		}
+		var req brokerapi.TokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+		if req.Binding != "ci" {
+			t.Errorf("Expected binding 'ci', got %s", req.Binding)
+		}
+		json.NewEncoder(w).Encode(brokerapi.TokenResponse{Token: "ghs_from_broker", ExpiresAt: expiresAt})
+	}))
+	defer server.Close()
+
+	saTokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(saTokenFile, []byte("sa-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	helper := &Helper{
+		BrokerURL:               server.URL + "/",
+		ServiceAccountTokenFile: saTokenFile,
+		Binding:                 "ci",
+	}
+
+	out := new(strings.Builder)
+	if err := helper.Run("get", strings.NewReader("protocol=https\nhost=github.com\n\n"), out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := "protocol=https\nhost=github.com\nusername=x-access-token\npassword=ghs_from_broker\npassword_expiry_utc=1711976400\n"
+	if out.String() != want {
+		t.Errorf("Expected output %q, got %q", want, out.String())
+	}
+}
+
+func TestRunWithoutSource(t *testing.T) {
+	helper := &Helper{}
+	err := helper.Run("get", strings.NewReader("protocol=https\nhost=github.com\n\n"), new(strings.Builder))
+	if err == nil {
+		t.Fatal("Expected an error, got nil")
+	}
+}
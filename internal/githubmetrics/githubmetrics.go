@@ -0,0 +1,47 @@
+// Package githubmetrics measures the manager's GitHub API requests and exposes them on its metrics endpoint.
+package githubmetrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/appthrust/tokenaut/pkg/githubapi"
+)
+
+var (
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tokenaut_github_requests_total",
+		Help: "Number of GitHub API requests by host, method and status code, \"error\" when no response was received.",
+	}, []string{"host", "method", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tokenaut_github_request_duration_seconds",
+		Help:    "Duration of GitHub API requests by host and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"host", "method"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(requests, requestDuration)
+}
+
+// Middleware counts GitHub API requests and measures their duration
+func Middleware() githubapi.Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return githubapi.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			requestDuration.WithLabelValues(req.URL.Host, req.Method).Observe(time.Since(start).Seconds())
+			code := "error"
+			if err == nil {
+				code = strconv.Itoa(resp.StatusCode)
+			}
+			requests.WithLabelValues(req.URL.Host, req.Method, code).Inc()
+			return resp, err
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package githubmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/appthrust/tokenaut/pkg/githubapi"
+)
+
+func TestMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+	host := server.Listener.Addr().String()
+
+	client := &http.Client{Transport: Middleware()(http.DefaultTransport)}
+	resp, err := client.Post(server.URL+"/app/installations/1/access_tokens", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	failing := Middleware()(githubapi.RoundTripperFunc(func(*http.Request) (*http.Response, error) {
+		return nil, &url.Error{Op: "Get", URL: "https://" + host, Err: http.ErrHandlerTimeout}
+	}))
+	req, _ := http.NewRequest(http.MethodGet, "https://"+host+"/app", nil)
+	if _, err := failing.RoundTrip(req); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	if got := testutil.ToFloat64(requests.WithLabelValues(host, http.MethodPost, "201")); got != 1 {
+		t.Errorf("Expected 1 request with status 201, got %v", got)
+	}
+	if got := testutil.ToFloat64(requests.WithLabelValues(host, http.MethodGet, "error")); got != 1 {
+		t.Errorf("Expected 1 failed request, got %v", got)
+	}
+	if got := testutil.CollectAndCount(requestDuration); got != 2 {
+		t.Errorf("Expected durations for 2 label sets, got %d", got)
+	}
+}
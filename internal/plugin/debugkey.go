@@ -0,0 +1,205 @@
+package plugin
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	"github.com/appthrust/tokenaut/internal/privatekey"
+	"github.com/appthrust/tokenaut/internal/signer"
+	"github.com/appthrust/tokenaut/pkg/githubapi"
+	"github.com/appthrust/tokenaut/pkg/githubappjwt"
+)
+
+func runDebugKey(p *Plugin, args []string) error {
+	fs := p.newFlagSet("debug-key")
+	ref := tokenautv1alpha1.PrivateKeyRef{}
+	var appID, baseURL string
+	fs.StringVar(&ref.Name, "secret", "", "Name of the private key Secret, when no InstallationAccessToken is given")
+	fs.StringVar(&ref.Namespace, "secret-namespace", "", "Namespace of the private key Secret, when no InstallationAccessToken is given")
+	fs.StringVar(&ref.Key, "key", "", "Key in the Secret holding the PEM, when no InstallationAccessToken is given")
+	fs.StringVar(&appID, "app-id", "", "If set, sign a JWT for this app and verify GitHub accepts it")
+	fs.StringVar(&baseURL, "github-api-url", "", "GitHub API base URL, for GitHub Enterprise Server")
+
+	// The manager's settings, so that keys are resolved as the controller resolves them
+	defaults := privatekey.Defaults{}
+	resolver := &signer.Resolver{PrivateKeyDefaults: &defaults}
+	vault := &signer.VaultClient{Token: os.Getenv("VAULT_TOKEN")}
+	var pkcs11Module, pkcs11TokenLabel, pkcs11PINFile string
+	fs.StringVar(&defaults.Name, "default-private-key-name", privatekey.DefaultSecretName, "The manager's --default-private-key-name")
+	fs.StringVar(&defaults.Namespace, "default-private-key-namespace", privatekey.DefaultSecretNamespace, "The manager's --default-private-key-namespace")
+	fs.StringVar(&defaults.Key, "default-private-key-key", privatekey.DefaultSecretKey, "The manager's --default-private-key-key")
+	fs.BoolVar(&defaults.SameNamespace, "default-private-key-same-namespace", false, "The manager's --default-private-key-same-namespace")
+	fs.BoolVar(&defaults.Disabled, "disable-default-private-key", false, "The manager's --disable-default-private-key")
+	fs.BoolVar(&resolver.StrictPrivateKeys, "strict-private-key-secrets", false, "The manager's --strict-private-key-secrets")
+	fs.StringVar(&resolver.KeyDir, "signer-key-dir", "", "Local directory holding the key files of spec.signer.file")
+	fs.StringVar(&vault.Address, "vault-address", os.Getenv("VAULT_ADDR"), "Address of the Vault server of spec.signer.vaultTransit")
+	fs.StringVar(&vault.Namespace, "vault-namespace", os.Getenv("VAULT_NAMESPACE"), "Vault Enterprise namespace of the Transit secrets engine")
+	fs.StringVar(&pkcs11Module, "pkcs11-module", "", "Path of the PKCS#11 module of spec.signer.pkcs11")
+	fs.StringVar(&pkcs11TokenLabel, "pkcs11-token-label", "", "Label of the PKCS#11 token holding the private keys")
+	fs.StringVar(&pkcs11PINFile, "pkcs11-pin-file", "", "File holding the user PIN of the PKCS#11 token")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		return errors.New("usage: kubectl tokenaut debug-key [<name>] [--secret name --secret-namespace ns --key privateKey --app-id id]")
+	}
+	if len(positional) == 1 && ref != (tokenautv1alpha1.PrivateKeyRef{}) {
+		return errors.New("--secret, --secret-namespace and --key cannot be combined with an InstallationAccessToken name")
+	}
+	if vault.Address != "" {
+		resolver.Vault = vault
+	}
+	if pkcs11Module != "" {
+		pin, err := os.ReadFile(pkcs11PINFile)
+		if err != nil {
+			return errors.Errorf("failed to read the PKCS#11 PIN file: %v", err)
+		}
+		resolver.PKCS11, err = signer.OpenPKCS11(pkcs11Module, pkcs11TokenLabel, strings.TrimSpace(string(pin)))
+		if err != nil {
+			return err
+		}
+		defer resolver.PKCS11.Close()
+	}
+	if err := p.connect(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	namespace := p.Namespace
+	var refs []tokenautv1alpha1.PrivateKeyRef
+	var keySigner *tokenautv1alpha1.Signer
+	if len(positional) == 1 {
+		var iat tokenautv1alpha1.InstallationAccessToken
+		if err := p.Client.Get(ctx, client.ObjectKey{Namespace: p.Namespace, Name: positional[0]}, &iat); err != nil {
+			return errors.Errorf("failed to get InstallationAccessToken: %v", err)
+		}
+		if appID == "" {
+			appID = iat.Spec.AppID
+		}
+		if iat.Spec.PrivateKeyRef != nil {
+			ref = *iat.Spec.PrivateKeyRef
+		}
+		refs = iat.Spec.PrivateKeyRefs
+		keySigner = iat.Spec.Signer
+		if len(refs) > 0 && (iat.Spec.PrivateKeyRef != nil || keySigner != nil) {
+			return errors.New("only one of `spec.privateKeyRef`, `spec.privateKeyRefs` and `spec.signer` may be set")
+		}
+	}
+	if len(refs) == 0 {
+		refs = []tokenautv1alpha1.PrivateKeyRef{ref}
+	}
+
+	var signers []crypto.Signer
+	if keySigner != nil {
+		signers, err = debugSigner(ctx, p, resolver, namespace, keySigner)
+	} else {
+		signers, err = debugSecrets(ctx, p, resolver, namespace, refs)
+	}
+	if err != nil {
+		return err
+	}
+
+	if appID == "" {
+		return nil
+	}
+	githubClient := githubapi.NewClient(githubapi.ClientConfig{BaseURL: baseURL})
+	accepted := false
+	for _, s := range signers {
+		jwt, err := githubappjwt.GenerateContext(ctx, appID, s)
+		if err != nil {
+			return err
+		}
+		app, err := githubClient.GetApp(jwt)
+		if err != nil {
+			fmt.Fprintf(p.Out, "App:         %s rejects %s: %v\n", appID, signer.Fingerprint(s), err)
+			continue
+		}
+		accepted = true
+		fmt.Fprintf(p.Out, "App:         %s (ID %d) accepts %s\n", app.Slug, app.ID, signer.Fingerprint(s))
+	}
+	if !accepted {
+		return errors.Errorf("GitHub rejected JWTs for app %s signed with every key", appID)
+	}
+	return nil
+}
+
+// debugSigner prints the signer selected by spec.signer and its public key
+func debugSigner(ctx context.Context, p *Plugin, resolver *signer.Resolver, namespace string, s *tokenautv1alpha1.Signer) ([]crypto.Signer, error) {
+	switch {
+	case s.File != nil:
+		fmt.Fprintf(p.Out, "Signer:      file \"%s\"\n", s.File.Name)
+	case s.VaultTransit != nil:
+		mount := s.VaultTransit.Mount
+		if mount == "" {
+			mount = signer.DefaultTransitMount
+		}
+		fmt.Fprintf(p.Out, "Signer:      Vault Transit key \"%s/%s\"\n", mount, s.VaultTransit.Key)
+	case s.PKCS11 != nil:
+		fmt.Fprintf(p.Out, "Signer:      PKCS#11 key \"%s\"\n", s.PKCS11.KeyLabel)
+	}
+	signers, err := resolver.ResolveAll(ctx, p.Client, namespace, nil, nil, s)
+	if err != nil {
+		return nil, err
+	}
+	printKeys(p, signers)
+	return signers, nil
+}
+
+// debugSecrets prints each private key Secret in refs and the keys it holds. Like the controller, it only
+// fails when no Secret provides a key.
+func debugSecrets(ctx context.Context, p *Plugin, resolver *signer.Resolver, namespace string, refs []tokenautv1alpha1.PrivateKeyRef) ([]crypto.Signer, error) {
+	var signers []crypto.Signer
+	var firstErr error
+	for i := range refs {
+		ref, err := resolver.PrivateKeyDefaults.Ref(&refs[i], namespace)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(p.Out, "Secret:      %s/%s (key \"%s\")\n", ref.Namespace, ref.Name, ref.Key)
+
+		var secret corev1.Secret
+		if err := p.Client.Get(ctx, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}, &secret); err == nil {
+			fmt.Fprintf(p.Out, "Type:        %s\n", secret.Type)
+			if secret.Type != tokenautv1alpha1.PrivateKeySecretType {
+				fmt.Fprintf(p.Out, "Warning:     Secret type is not %s\n", tokenautv1alpha1.PrivateKeySecretType)
+			}
+		}
+
+		keys, err := resolver.ResolveAll(ctx, p.Client, namespace, ref, nil, nil)
+		if err != nil {
+			if details := errors.FlattenDetails(err); details != "" {
+				err = errors.Errorf("%v (%s)", err, details)
+			}
+			fmt.Fprintf(p.Out, "Error:       %v\n", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		printKeys(p, keys)
+		signers = append(signers, keys...)
+	}
+	if len(signers) == 0 {
+		return nil, firstErr
+	}
+	return signers, nil
+}
+
+func printKeys(p *Plugin, signers []crypto.Signer) {
+	for _, s := range signers {
+		if pub, ok := s.Public().(*rsa.PublicKey); ok {
+			fmt.Fprintf(p.Out, "Key size:    %d bits\n", pub.N.BitLen())
+		}
+		fmt.Fprintf(p.Out, "Fingerprint: %s\n", signer.Fingerprint(s))
+	}
+}
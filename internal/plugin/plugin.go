@@ -0,0 +1,158 @@
+package plugin
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	"github.com/appthrust/tokenaut/internal/remotecluster"
+)
+
+// Plugin holds the state shared by the kubectl-tokenaut subcommands
+type Plugin struct {
+	Out    io.Writer
+	ErrOut io.Writer
+
+	// Client is used to talk to the cluster. It is built from the kubeconfig flags when nil.
+	Client client.Client
+
+	// Namespace is the namespace subcommands operate in
+	Namespace string
+
+	kubeconfig  string
+	kubeContext string
+
+	// newRemoteClient connects to the cluster of a kubeconfig; remotecluster.NewClient when nil
+	newRemoteClient func(kubeconfig []byte) (client.Client, error)
+}
+
+// Command is a kubectl-tokenaut subcommand
+type Command struct {
+	Name    string
+	Usage   string
+	Summary string
+	Run     func(p *Plugin, args []string) error
+}
+
+// Commands lists the available subcommands
+var Commands = []Command{
+	{Name: "status", Usage: "status [-A]", Summary: "Show InstallationAccessTokens with expiry, scope, target Secrets and last error", Run: runStatus},
+	{Name: "refresh", Usage: "refresh <name> [--wait]", Summary: "Request an immediate token rotation, optionally waiting for it to complete", Run: runRefresh},
+	{Name: "whoami", Usage: "whoami <name> [--key token]", Summary: "Show the repositories and permissions the current token actually has", Run: runWhoami},
+	{Name: "debug-key", Usage: "debug-key [<name>] [--secret name --secret-namespace ns --key privateKey --app-id id]", Summary: "Validate a private key Secret and print its fingerprint", Run: runDebugKey},
+	{Name: "render", Usage: "render <file>", Summary: "Render the Secrets an InstallationAccessToken manifest would produce, without a cluster", Run: runRender},
+}
+
+// Run dispatches args to the matching subcommand
+func (p *Plugin) Run(args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		p.usage()
+		return nil
+	}
+	for _, cmd := range Commands {
+		if cmd.Name == args[0] {
+			return cmd.Run(p, args[1:])
+		}
+	}
+	p.usage()
+	return errors.Errorf("unknown command \"%s\"", args[0])
+}
+
+func (p *Plugin) usage() {
+	fmt.Fprintln(p.ErrOut, "Inspect and operate tokenaut InstallationAccessTokens.")
+	fmt.Fprintln(p.ErrOut)
+	fmt.Fprintln(p.ErrOut, "Usage:")
+	for _, cmd := range Commands {
+		fmt.Fprintf(p.ErrOut, "  kubectl tokenaut %s\n      %s\n", cmd.Usage, cmd.Summary)
+	}
+	fmt.Fprintln(p.ErrOut)
+	fmt.Fprintln(p.ErrOut, "Common flags: -n/--namespace, --kubeconfig, --context")
+}
+
+// newFlagSet returns a FlagSet with the flags every subcommand accepts
+func (p *Plugin) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(p.ErrOut)
+	fs.StringVar(&p.Namespace, "namespace", p.Namespace, "Namespace of the InstallationAccessToken")
+	fs.StringVar(&p.Namespace, "n", p.Namespace, "Shorthand for --namespace")
+	fs.StringVar(&p.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file")
+	fs.StringVar(&p.kubeContext, "context", "", "The kubeconfig context to use")
+	return fs
+}
+
+// parseFlags parses flags that may appear before or after positional arguments, as kubectl users expect
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// connect builds the cluster client and resolves the namespace from the kubeconfig when not set explicitly
+func (p *Plugin) connect() error {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = p.kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{
+		CurrentContext: p.kubeContext,
+	})
+
+	if p.Namespace == "" {
+		namespace, _, err := clientConfig.Namespace()
+		if err != nil {
+			return errors.Errorf("failed to determine namespace: %v", err)
+		}
+		p.Namespace = namespace
+	}
+	if p.Client != nil {
+		return nil
+	}
+
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return errors.Errorf("failed to load kubeconfig: %v", err)
+	}
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return err
+	}
+	if err := tokenautv1alpha1.AddToScheme(scheme); err != nil {
+		return err
+	}
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return errors.Errorf("failed to create client: %v", err)
+	}
+	p.Client = c
+	return nil
+}
+
+// remoteClient connects to a remote cluster InstallationAccessTokens write Secrets to
+func (p *Plugin) remoteClient(kubeconfig []byte) (client.Client, error) {
+	if p.newRemoteClient != nil {
+		return p.newRemoteClient(kubeconfig)
+	}
+	return remotecluster.NewClient(kubeconfig, p.Client.Scheme())
+}
+
+func truncate(s string, n int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
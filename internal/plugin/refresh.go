@@ -0,0 +1,69 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+)
+
+func runRefresh(p *Plugin, args []string) error {
+	fs := p.newFlagSet("refresh")
+	var waitFor bool
+	var timeout time.Duration
+	fs.BoolVar(&waitFor, "wait", false, "Wait until the controller acknowledges the refresh in status.lastRefreshRequest")
+	fs.DurationVar(&timeout, "timeout", 2*time.Minute, "How long to wait with --wait")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("usage: kubectl tokenaut refresh <name> [--wait]")
+	}
+	if err := p.connect(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	key := client.ObjectKey{Namespace: p.Namespace, Name: positional[0]}
+	var iat tokenautv1alpha1.InstallationAccessToken
+	if err := p.Client.Get(ctx, key, &iat); err != nil {
+		return errors.Errorf("failed to get InstallationAccessToken: %v", err)
+	}
+
+	requestedAt := time.Now().UTC().Format(time.RFC3339Nano)
+	patch := client.MergeFrom(iat.DeepCopy())
+	if iat.Annotations == nil {
+		iat.Annotations = make(map[string]string)
+	}
+	iat.Annotations[tokenautv1alpha1.RefreshRequestedAtAnnotation] = requestedAt
+	if err := p.Client.Patch(ctx, &iat, patch); err != nil {
+		return errors.Errorf("failed to request refresh: %v", err)
+	}
+	fmt.Fprintf(p.Out, "installationaccesstoken/%s refresh requested at %s\n", iat.Name, requestedAt)
+
+	if !waitFor {
+		return nil
+	}
+	err = wait.PollUntilContextTimeout(ctx, time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		if err := p.Client.Get(ctx, key, &iat); err != nil {
+			return false, err
+		}
+		return iat.Status.LastRefreshRequest == requestedAt, nil
+	})
+	if err != nil {
+		if ready := meta.FindStatusCondition(iat.Status.Conditions, "Ready"); ready != nil && ready.Status == metav1.ConditionFalse {
+			return errors.Errorf("refresh was not acknowledged within %v: %s", timeout, ready.Message)
+		}
+		return errors.Errorf("refresh was not acknowledged within %v: %v", timeout, err)
+	}
+	fmt.Fprintf(p.Out, "installationaccesstoken/%s refreshed, token expires at %s\n", iat.Name, iat.Status.Token.ExpiresAt.UTC().Format(time.RFC3339))
+	return nil
+}
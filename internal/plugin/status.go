@@ -0,0 +1,146 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+)
+
+func runStatus(p *Plugin, args []string) error {
+	fs := p.newFlagSet("status")
+	var allNamespaces bool
+	fs.BoolVar(&allNamespaces, "all-namespaces", false, "List InstallationAccessTokens across all namespaces")
+	fs.BoolVar(&allNamespaces, "A", false, "Shorthand for --all-namespaces")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := p.connect(); err != nil {
+		return err
+	}
+
+	var opts []client.ListOption
+	if !allNamespaces {
+		opts = append(opts, client.InNamespace(p.Namespace))
+	}
+	var iats tokenautv1alpha1.InstallationAccessTokenList
+	if err := p.Client.List(context.Background(), &iats, opts...); err != nil {
+		return errors.Errorf("failed to list InstallationAccessTokens: %v", err)
+	}
+
+	printStatus(p, iats.Items, allNamespaces, time.Now())
+	return nil
+}
+
+func printStatus(p *Plugin, iats []tokenautv1alpha1.InstallationAccessToken, allNamespaces bool, now time.Time) {
+	sort.Slice(iats, func(i, j int) bool {
+		if iats[i].Namespace != iats[j].Namespace {
+			return iats[i].Namespace < iats[j].Namespace
+		}
+		return iats[i].Name < iats[j].Name
+	})
+
+	w := tabwriter.NewWriter(p.Out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+	if allNamespaces {
+		fmt.Fprint(w, "NAMESPACE\t")
+	}
+	fmt.Fprintln(w, "NAME\tREADY\tEXPIRES IN\tSCOPE\tSECRET\tLAST ERROR")
+	for _, iat := range iats {
+		if allNamespaces {
+			fmt.Fprintf(w, "%s\t", iat.Namespace)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			iat.Name,
+			readyStatus(&iat),
+			expiresIn(iat.Status.Token.ExpiresAt, now),
+			scopeSummary(iat.Spec.Scope),
+			secretSummary(&iat),
+			lastError(&iat),
+		)
+	}
+}
+
+func readyStatus(iat *tokenautv1alpha1.InstallationAccessToken) string {
+	status := "Unknown"
+	if condition := meta.FindStatusCondition(iat.Status.Conditions, "Ready"); condition != nil {
+		status = string(condition.Status)
+	}
+	if meta.IsStatusConditionTrue(iat.Status.Conditions, "Suspended") {
+		status += " (suspended)"
+	}
+	return status
+}
+
+func expiresIn(expiresAt metav1.Time, now time.Time) string {
+	if expiresAt.IsZero() {
+		return "-"
+	}
+	remaining := expiresAt.Sub(now)
+	if remaining <= 0 {
+		return fmt.Sprintf("expired %s ago", duration.HumanDuration(-remaining))
+	}
+	return duration.HumanDuration(remaining)
+}
+
+func scopeSummary(scope *tokenautv1alpha1.Scope) string {
+	if scope == nil {
+		return "all"
+	}
+	var parts []string
+	if len(scope.Repositories) > 0 {
+		parts = append(parts, "repos="+strings.Join(scope.Repositories, ","))
+	}
+	if len(scope.RepositoryIDs) > 0 {
+		ids := make([]string, len(scope.RepositoryIDs))
+		for i, id := range scope.RepositoryIDs {
+			ids[i] = fmt.Sprint(id)
+		}
+		parts = append(parts, "repoIds="+strings.Join(ids, ","))
+	}
+	if len(scope.Permissions) > 0 {
+		perms := make([]string, 0, len(scope.Permissions))
+		for k, v := range scope.Permissions {
+			perms = append(perms, k+":"+v)
+		}
+		sort.Strings(perms)
+		parts = append(parts, "perms="+strings.Join(perms, ","))
+	}
+	if len(parts) == 0 {
+		return "all"
+	}
+	return truncate(strings.Join(parts, " "), 60)
+}
+
+// secretSummary describes where the rendered Secret was last written, as recorded in the status
+func secretSummary(iat *tokenautv1alpha1.InstallationAccessToken) string {
+	switch {
+	case iat.Status.RemoteSecretRef != nil:
+		ref := iat.Status.RemoteSecretRef
+		return ref.KubeconfigSecretRef.Name + ":" + ref.Namespace + "/" + ref.Name
+	case iat.Status.VaultKVRef != nil:
+		return "vault:" + iat.Status.VaultKVRef.Mount + "/" + iat.Status.VaultKVRef.Path
+	case iat.Status.SecretRef.Name != "":
+		return iat.Status.SecretRef.Namespace + "/" + iat.Status.SecretRef.Name
+	default:
+		return "-"
+	}
+}
+
+func lastError(iat *tokenautv1alpha1.InstallationAccessToken) string {
+	condition := meta.FindStatusCondition(iat.Status.Conditions, "Ready")
+	if condition == nil || condition.Status != metav1.ConditionFalse {
+		return ""
+	}
+	return truncate(condition.Message, 80)
+}
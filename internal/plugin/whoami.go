@@ -0,0 +1,150 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	"github.com/appthrust/tokenaut/internal/remotecluster"
+	"github.com/appthrust/tokenaut/internal/vaultkv"
+	"github.com/appthrust/tokenaut/pkg/githubapi"
+)
+
+func runWhoami(p *Plugin, args []string) error {
+	fs := p.newFlagSet("whoami")
+	var key, baseURL string
+	fs.StringVar(&key, "key", "token", "Key of the Secret holding the bare token")
+	fs.StringVar(&baseURL, "github-api-url", "", "GitHub API base URL, for GitHub Enterprise Server")
+	vault := &vaultkv.Client{}
+	fs.StringVar(&vault.Address, "vault-address", os.Getenv("VAULT_ADDR"), "Address of the Vault server, for tokens written to Vault KV")
+	fs.StringVar(&vault.Namespace, "vault-namespace", os.Getenv("VAULT_NAMESPACE"), "Vault Enterprise namespace of the KV secrets engine")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("usage: kubectl tokenaut whoami <name> [--key token]")
+	}
+	if err := p.connect(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var iat tokenautv1alpha1.InstallationAccessToken
+	if err := p.Client.Get(ctx, client.ObjectKey{Namespace: p.Namespace, Name: positional[0]}, &iat); err != nil {
+		return errors.Errorf("failed to get InstallationAccessToken: %v", err)
+	}
+	data, source, err := recordedData(ctx, p, &iat, vault)
+	if err != nil {
+		return err
+	}
+	token, ok := data[key]
+	if !ok {
+		keys := make([]string, 0, len(data))
+		for k := range data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return errors.Errorf("%s has no key \"%s\" (keys: %s); pass --key", source, key, strings.Join(keys, ", "))
+	}
+
+	repos, err := githubapi.NewClient(githubapi.ClientConfig{BaseURL: baseURL}).ListInstallationRepositories(token)
+	if err != nil {
+		return errors.Errorf("failed to list repositories: %v", err)
+	}
+
+	fmt.Fprintf(p.Out, "InstallationAccessToken: %s/%s\n", iat.Namespace, iat.Name)
+	fmt.Fprintf(p.Out, "Source:                  %s (key \"%s\")\n", source, key)
+	fmt.Fprintf(p.Out, "App / Installation:      %s / %s\n", iat.Spec.AppID, iat.Spec.InstallationID)
+	fmt.Fprintf(p.Out, "Expires in:              %s\n", expiresIn(iat.Status.Token.ExpiresAt, time.Now()))
+	fmt.Fprintf(p.Out, "Repository selection:    %s\n", repos.RepositorySelection)
+	if len(iat.Status.Token.Permissions) > 0 {
+		perms := make([]string, 0, len(iat.Status.Token.Permissions))
+		for k, v := range iat.Status.Token.Permissions {
+			perms = append(perms, k+":"+v)
+		}
+		sort.Strings(perms)
+		fmt.Fprintf(p.Out, "Permissions:             %s\n", strings.Join(perms, ", "))
+	}
+	fmt.Fprintf(p.Out, "Repositories (%d):\n", len(repos.Repositories))
+	for _, repo := range repos.Repositories {
+		visibility := "public"
+		if repo.Private {
+			visibility = "private"
+		}
+		fmt.Fprintf(p.Out, "  %s (%s)\n", repo.FullName, visibility)
+	}
+	return nil
+}
+
+// recordedData reads the data of the rendered Secret from where the status says it was last written: a Secret
+// of this cluster, a Secret of a remote cluster or a Vault KV secret. It also returns a description of the source.
+func recordedData(ctx context.Context, p *Plugin, iat *tokenautv1alpha1.InstallationAccessToken, vault *vaultkv.Client) (map[string]string, string, error) {
+	switch {
+	case iat.Status.RemoteSecretRef != nil:
+		ref := iat.Status.RemoteSecretRef
+		kubeconfigKey := ref.KubeconfigSecretRef.Key
+		if kubeconfigKey == "" {
+			kubeconfigKey = remotecluster.DefaultKubeconfigKey
+		}
+		var kubeconfig corev1.Secret
+		kubeconfigName := client.ObjectKey{Namespace: iat.Namespace, Name: ref.KubeconfigSecretRef.Name}
+		if err := p.Client.Get(ctx, kubeconfigName, &kubeconfig); err != nil {
+			return nil, "", errors.Errorf("failed to get kubeconfig Secret %s: %v", kubeconfigName, err)
+		}
+		remote, err := p.remoteClient(kubeconfig.Data[kubeconfigKey])
+		if err != nil {
+			return nil, "", errors.Errorf("failed to connect with kubeconfig Secret %s: %v", kubeconfigName, err)
+		}
+		source := fmt.Sprintf("Secret %s/%s in the cluster of kubeconfig Secret %s", ref.Namespace, ref.Name, kubeconfigName)
+		data, err := secretData(ctx, remote, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name})
+		return data, source, err
+
+	case iat.Status.VaultKVRef != nil:
+		source := fmt.Sprintf("Vault KV secret %s/%s", iat.Status.VaultKVRef.Mount, iat.Status.VaultKVRef.Path)
+		if vault.Address == "" {
+			return nil, "", errors.Errorf("the token was written to %s; pass --vault-address or set VAULT_ADDR", source)
+		}
+		sink := &vaultkv.Sink{
+			Client: vault,
+			Mount:  iat.Status.VaultKVRef.Mount,
+			Path:   iat.Status.VaultKVRef.Path,
+			Token: func(context.Context) (string, error) {
+				if token := os.Getenv("VAULT_TOKEN"); token != "" {
+					return token, nil
+				}
+				return "", errors.Errorf("set VAULT_TOKEN to a token that may read %s", source)
+			},
+		}
+		data, err := sink.Get(ctx)
+		return data, source, err
+
+	case iat.Status.SecretRef.Name != "":
+		secretKey := client.ObjectKey{Namespace: iat.Status.SecretRef.Namespace, Name: iat.Status.SecretRef.Name}
+		data, err := secretData(ctx, p.Client, secretKey)
+		return data, "Secret " + secretKey.String(), err
+
+	default:
+		return nil, "", errors.Errorf("InstallationAccessToken \"%s\" has not written a Secret yet", iat.Name)
+	}
+}
+
+func secretData(ctx context.Context, c client.Reader, key client.ObjectKey) (map[string]string, error) {
+	var secret corev1.Secret
+	if err := c.Get(ctx, key, &secret); err != nil {
+		return nil, errors.Errorf("failed to get Secret %s: %v", key, err)
+	}
+	data := make(map[string]string, len(secret.Data))
+	for k, v := range secret.Data {
+		data[k] = string(v)
+	}
+	return data, nil
+}
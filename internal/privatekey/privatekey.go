@@ -0,0 +1,202 @@
+package privatekey
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+)
+
+const (
+	// DefaultSecretName is the name of the Secret used when privateKeyRef does not specify one
+	DefaultSecretName = "github-app-private-key"
+	// DefaultSecretNamespace is the namespace of the Secret used when privateKeyRef does not specify one
+	DefaultSecretNamespace = "default"
+	// DefaultSecretKey is the data key used when privateKeyRef does not specify one
+	DefaultSecretKey = "privateKey"
+)
+
+// Defaults locate the private key Secret for the fields a PrivateKeyRef leaves empty.
+// A nil *Defaults uses DefaultSecretName, DefaultSecretNamespace and DefaultSecretKey.
+type Defaults struct {
+	// Name of the Secret
+	Name string
+	// Namespace of the Secret
+	Namespace string
+	// SameNamespace looks for the Secret in the namespace of the resource referring to it instead of Namespace
+	SameNamespace bool
+	// Key in the Secret holding the PEM
+	Key string
+	// Disabled requires the Secret's name and namespace to be set explicitly
+	Disabled bool
+}
+
+// Ref returns a copy of ref with its empty fields filled in for a resource in namespace
+func (d *Defaults) Ref(ref *tokenautv1alpha1.PrivateKeyRef, namespace string) (*tokenautv1alpha1.PrivateKeyRef, error) {
+	if d == nil {
+		d = &Defaults{Name: DefaultSecretName, Namespace: DefaultSecretNamespace, Key: DefaultSecretKey}
+	}
+	out := &tokenautv1alpha1.PrivateKeyRef{}
+	if ref != nil {
+		*out = *ref
+	}
+	if d.Disabled {
+		if out.Name == "" || out.Namespace == "" {
+			return nil, errors.New("default private keys are disabled on this cluster. Please specify the secret name and namespace in `spec.privateKeyRef`")
+		}
+	}
+	if out.Name == "" {
+		out.Name = d.Name
+	}
+	if out.Namespace == "" {
+		out.Namespace = d.Namespace
+		if d.SameNamespace {
+			out.Namespace = namespace
+		}
+	}
+	if out.Key == "" {
+		out.Key = d.Key
+	}
+	return out, nil
+}
+
+// ErrUnavailable is returned in strict mode when a private key Secret does not exist or may not be used.
+// Which of the two applies is only attached as an error detail, so that it isn't disclosed in resource statuses.
+var ErrUnavailable = errors.New("the secret does not exist, is not of type \"" + tokenautv1alpha1.PrivateKeySecretType +
+	"\", or does not list the namespace in its \"" + tokenautv1alpha1.AllowedNamespacesAnnotation + "\" annotation")
+
+// Access controls which Secrets a resource may read private keys from. The zero value reads any Secret,
+// locating it with the built-in defaults.
+type Access struct {
+	// Strict only reads Secrets of type tokenaut.appthrust.io/private-key. When such a Secret carries the
+	// allowed-namespaces annotation, only resources in the listed namespaces may read it.
+	Strict bool
+	// Namespace of the resource reading the private key
+	Namespace string
+	// Defaults fill in the fields a PrivateKeyRef leaves empty
+	Defaults *Defaults
+}
+
+// Get reads and parses the GitHub App private key referenced by ref, falling back to the defaults for empty fields.
+// When the Secret holds several keys, the first one is returned.
+func (a Access) Get(ctx context.Context, c client.Reader, ref *tokenautv1alpha1.PrivateKeyRef) (*rsa.PrivateKey, error) {
+	keys, err := a.GetAll(ctx, c, ref)
+	if err != nil {
+		return nil, err
+	}
+	return keys[0], nil
+}
+
+// GetAll reads and parses every GitHub App private key in the Secret referenced by ref, in the order they appear,
+// falling back to the defaults for empty fields. A missing Secret is reported with an error for which
+// apierrors.IsNotFound is true, or with ErrUnavailable in strict mode, as is a Secret that may not be used.
+func (a Access) GetAll(ctx context.Context, c client.Reader, ref *tokenautv1alpha1.PrivateKeyRef) ([]*rsa.PrivateKey, error) {
+	ref, err := a.Defaults.Ref(ref, a.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	secretName := types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}
+	secretKey := ref.Key
+
+	var secret corev1.Secret
+	if err := c.Get(ctx, secretName, &secret); err != nil {
+		if a.Strict {
+			return nil, a.unavailable(secretName, "failed to get the secret: %v", err)
+		}
+		return nil, errors.Errorf("tried to get a secret named \"%s\" in namespace \"%s\", but got error: %w. Please create the secret with the private key or specify the correct secret name and key in `spec.privateKeyRef`", secretName.Name, secretName.Namespace, err)
+	}
+
+	if a.Strict {
+		if secret.Type != tokenautv1alpha1.PrivateKeySecretType {
+			return nil, a.unavailable(secretName, "the secret is of type %q", secret.Type)
+		}
+		if !a.allowed(&secret) {
+			return nil, a.unavailable(secretName, "namespace %q is not listed in the %q annotation", a.Namespace, tokenautv1alpha1.AllowedNamespacesAnnotation)
+		}
+	}
+
+	privateKeyPEM, ok := secret.Data[secretKey]
+	if !ok {
+		return nil, errors.Errorf("tried to read the key \"%s\" from the secret \"%s\" in namespace \"%s\", but the key was not found. Please create the secret with the private key or specify the correct secret name and key in `spec.privateKeyRef`", secretKey, secretName.Name, secretName.Namespace)
+	}
+
+	return ParseAll(privateKeyPEM)
+}
+
+// allowed reports whether the Secret's allowed-namespaces annotation, if any, lists the resource's namespace
+func (a Access) allowed(secret *corev1.Secret) bool {
+	allowed, ok := secret.Annotations[tokenautv1alpha1.AllowedNamespacesAnnotation]
+	if !ok {
+		return true
+	}
+	for _, ns := range strings.Split(allowed, ",") {
+		if strings.TrimSpace(ns) == a.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// unavailable returns ErrUnavailable with the actual cause attached as a detail, which is logged but not
+// included in the error message
+func (a Access) unavailable(secretName types.NamespacedName, format string, args ...interface{}) error {
+	err := errors.Wrapf(ErrUnavailable, "cannot use the private key secret \"%s\" in namespace \"%s\" from namespace \"%s\"",
+		secretName.Name, secretName.Namespace, a.Namespace)
+	return errors.WithDetailf(err, format, args...)
+}
+
+// Parse decodes a PEM encoded PKCS#1 RSA private key
+func Parse(privateKeyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, errors.Errorf("failed to parse PEM block containing the private key")
+	}
+
+	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Errorf("failed to parse private key: %v", err)
+	}
+
+	return privateKey, nil
+}
+
+// ParseAll decodes one or more concatenated PEM encoded PKCS#1 RSA private keys
+func ParseAll(privateKeyPEM []byte) ([]*rsa.PrivateKey, error) {
+	var keys []*rsa.PrivateKey
+	for rest := privateKeyPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Errorf("failed to parse private key #%d: %v", len(keys)+1, err)
+		}
+		keys = append(keys, privateKey)
+	}
+	if len(keys) == 0 {
+		return nil, errors.Errorf("failed to parse PEM block containing the private key")
+	}
+	return keys, nil
+}
+
+// Fingerprint returns the SHA256 fingerprint of the public key, in the form GitHub shows in the App settings
+func Fingerprint(publicKey *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", errors.Errorf("failed to marshal public key: %v", err)
+	}
+	sum := sha256.Sum256(der)
+	return base64.StdEncoding.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,165 @@
+package privatekey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+)
+
+func TestDefaultsRef(t *testing.T) {
+	// A nil Defaults uses the built-in location
+	ref, err := (*Defaults)(nil).Ref(nil, "team-a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if *ref != (tokenautv1alpha1.PrivateKeyRef{Name: DefaultSecretName, Namespace: DefaultSecretNamespace, Key: DefaultSecretKey}) {
+		t.Errorf("Expected the built-in defaults, got %+v", *ref)
+	}
+
+	d := &Defaults{Name: "app-key", Namespace: "tokenaut-system", Key: "pem", SameNamespace: true}
+	ref, err = d.Ref(&tokenautv1alpha1.PrivateKeyRef{Key: "other"}, "team-a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if *ref != (tokenautv1alpha1.PrivateKeyRef{Name: "app-key", Namespace: "team-a", Key: "other"}) {
+		t.Errorf("Expected the resource's namespace and the explicit key, got %+v", *ref)
+	}
+
+	d = &Defaults{Disabled: true}
+	if _, err := d.Ref(&tokenautv1alpha1.PrivateKeyRef{Name: "app-key"}, "team-a"); err == nil {
+		t.Error("Expected an error when the namespace is omitted with defaults disabled")
+	}
+	ref, err = d.Ref(&tokenautv1alpha1.PrivateKeyRef{Name: "app-key", Namespace: "team-a"}, "team-b")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ref.Name != "app-key" || ref.Namespace != "team-a" {
+		t.Errorf("Expected the explicit Secret, got %+v", *ref)
+	}
+}
+
+func TestGetAll(t *testing.T) {
+	var keyPEM []byte
+	for i := 0; i < 2; i++ {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("Failed to generate private key: %v", err)
+		}
+		keyPEM = append(keyPEM, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})...)
+	}
+	c := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: DefaultSecretName, Namespace: DefaultSecretNamespace},
+		Data:       map[string][]byte{DefaultSecretKey: keyPEM},
+	}).Build()
+
+	keys, err := Access{}.GetAll(context.Background(), c, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("Expected 2 keys, got %d", len(keys))
+	}
+
+	_, err = Access{}.GetAll(context.Background(), c, &tokenautv1alpha1.PrivateKeyRef{Name: "missing"})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+	_, err = Access{}.GetAll(context.Background(), c, &tokenautv1alpha1.PrivateKeyRef{Key: "missing"})
+	if err == nil || apierrors.IsNotFound(err) {
+		t.Errorf("Expected a missing key error, got %v", err)
+	}
+
+	// Configured defaults replace the built-in ones
+	defaults := &Defaults{Name: "app-key", Namespace: "tokenaut-system", Key: "pem"}
+	_, err = Access{Defaults: defaults}.GetAll(context.Background(), c, nil)
+	if !apierrors.IsNotFound(err) || !strings.Contains(err.Error(), "tokenaut-system") {
+		t.Errorf("Expected the configured default Secret to be read, got %v", err)
+	}
+	_, err = Access{Defaults: &Defaults{Disabled: true}}.GetAll(context.Background(), c, nil)
+	if err == nil || apierrors.IsNotFound(err) {
+		t.Errorf("Expected an error for disabled defaults, got %v", err)
+	}
+
+	// Strict mode ignores the Secret because it isn't of the private key type
+	_, err = Access{Strict: true, Namespace: "default"}.GetAll(context.Background(), c, nil)
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected ErrUnavailable, got %v", err)
+	}
+}
+
+func TestAccessStrict(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate private key: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	c := fake.NewClientBuilder().WithObjects(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "keys"},
+			Type:       tokenautv1alpha1.PrivateKeySecretType,
+			Data:       map[string][]byte{DefaultSecretKey: keyPEM},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "team-a",
+				Namespace:   "keys",
+				Annotations: map[string]string{tokenautv1alpha1.AllowedNamespacesAnnotation: "team-a, team-b"},
+			},
+			Type: tokenautv1alpha1.PrivateKeySecretType,
+			Data: map[string][]byte{DefaultSecretKey: keyPEM},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "database", Namespace: "keys"},
+			Data:       map[string][]byte{DefaultSecretKey: keyPEM},
+		},
+	).Build()
+
+	tests := []struct {
+		name      string
+		secret    string
+		namespace string
+		wantErr   bool
+	}{
+		{name: "without annotation", secret: "shared", namespace: "team-c"},
+		{name: "allowed namespace", secret: "team-a", namespace: "team-b"},
+		{name: "namespace not allowed", secret: "team-a", namespace: "team-c", wantErr: true},
+		{name: "wrong type", secret: "database", namespace: "team-c", wantErr: true},
+		{name: "missing", secret: "missing", namespace: "team-c", wantErr: true},
+	}
+	var messages []string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref := &tokenautv1alpha1.PrivateKeyRef{Name: tt.secret, Namespace: "keys"}
+			_, err := Access{Strict: true, Namespace: tt.namespace}.Get(context.Background(), c, ref)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrUnavailable) {
+				t.Fatalf("Expected ErrUnavailable, got %v", err)
+			}
+			messages = append(messages, strings.ReplaceAll(err.Error(), tt.secret, "NAME"))
+		})
+	}
+
+	// The messages must not tell why the Secret is unavailable
+	for _, m := range messages[1:] {
+		if m != messages[0] {
+			t.Errorf("Expected indistinguishable errors, got %q and %q", messages[0], m)
+		}
+	}
+}
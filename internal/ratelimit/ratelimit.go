@@ -0,0 +1,94 @@
+// Package ratelimit limits how often tokens are minted for each GitHub App, so that an app with many
+// resources can neither use up the manager's share of GitHub's rate limits nor occupy the reconcile
+// workers resources of other apps are waiting for.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var throttled = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "tokenaut_app_rate_limited_total",
+	Help: "Number of token mints delayed because the GitHub App exceeded its client-side rate limit, by app ID.",
+}, []string{"app_id"})
+
+func init() {
+	metrics.Registry.MustRegister(throttled)
+}
+
+// PerApp holds a token bucket for each GitHub App. A nil PerApp does not limit.
+type PerApp struct {
+	limit rate.Limit
+	burst int
+
+	// Now replaces time.Now, e.g. to advance the buckets in tests
+	Now func() time.Time
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+// NewPerApp allows every app qps mints per second on average and up to burst at once.
+// It returns nil, which does not limit, when qps is not positive.
+func NewPerApp(qps float64, burst int) *PerApp {
+	if qps <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &PerApp{limit: rate.Limit(qps), burst: burst, limiters: map[string]*rate.Limiter{}}
+}
+
+// Reserve takes a mint from appID's budget and returns zero, or returns how long until the budget
+// allows the next mint and takes nothing. Reconcilers requeue after the delay instead of blocking a worker.
+func (p *PerApp) Reserve(appID string) time.Duration {
+	if p == nil {
+		return 0
+	}
+	now := p.now()
+	reservation := p.limiter(appID).ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		reservation.CancelAt(now)
+		throttled.WithLabelValues(appID).Inc()
+	}
+	return delay
+}
+
+// Wait blocks until appID's budget allows a mint, or returns ctx's error when it is done first
+func (p *PerApp) Wait(ctx context.Context, appID string) error {
+	if p == nil {
+		return nil
+	}
+	limiter := p.limiter(appID)
+	if !limiter.Allow() {
+		throttled.WithLabelValues(appID).Inc()
+		return limiter.Wait(ctx)
+	}
+	return nil
+}
+
+func (p *PerApp) limiter(appID string) *rate.Limiter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	limiter, ok := p.limiters[appID]
+	if !ok {
+		limiter = rate.NewLimiter(p.limit, p.burst)
+		p.limiters[appID] = limiter
+	}
+	return limiter
+}
+
+func (p *PerApp) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReserve(t *testing.T) {
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	limiter := NewPerApp(0.5, 2)
+	limiter.Now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if delay := limiter.Reserve("12345"); delay != 0 {
+			t.Fatalf("Expected mint %d within the burst, got a delay of %v", i+1, delay)
+		}
+	}
+	if delay := limiter.Reserve("12345"); delay != 2*time.Second {
+		t.Errorf("Expected a delay of 2s after the burst, got %v", delay)
+	}
+	if delay := limiter.Reserve("12345"); delay != 2*time.Second {
+		t.Errorf("Expected a delayed mint to take nothing from the budget, got a delay of %v", delay)
+	}
+	if got := testutil.ToFloat64(throttled.WithLabelValues("12345")); got != 2 {
+		t.Errorf("Expected 2 throttled mints, got %v", got)
+	}
+
+	if delay := limiter.Reserve("67890"); delay != 0 {
+		t.Errorf("Expected another app to have its own budget, got a delay of %v", delay)
+	}
+
+	now = now.Add(2 * time.Second)
+	if delay := limiter.Reserve("12345"); delay != 0 {
+		t.Errorf("Expected the budget to refill, got a delay of %v", delay)
+	}
+}
+
+func TestWait(t *testing.T) {
+	limiter := NewPerApp(0.001, 1)
+	if err := limiter.Wait(context.Background(), "12345"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx, "12345"); err == nil {
+		t.Error("Expected an error when the budget does not refill before the context is done")
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	limiter := NewPerApp(0, 10)
+	if limiter != nil {
+		t.Fatalf("Expected no limiter, got %+v", limiter)
+	}
+	for i := 0; i < 100; i++ {
+		if delay := limiter.Reserve("12345"); delay != 0 {
+			t.Fatalf("Expected no delay, got %v", delay)
+		}
+	}
+	if err := limiter.Wait(context.Background(), "12345"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
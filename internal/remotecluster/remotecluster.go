@@ -0,0 +1,180 @@
+// Package remotecluster builds clients for the clusters InstallationAccessTokens write their Secrets to,
+// from kubeconfigs stored in Secrets of the management cluster.
+package remotecluster
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"golang.org/x/sync/singleflight"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultKubeconfigKey is the key Cluster API stores kubeconfigs under in "<cluster>-kubeconfig" Secrets
+	DefaultKubeconfigKey = "value"
+
+	// DefaultMaxClients is how many clients a Cache keeps when its MaxClients is zero
+	DefaultMaxClients = 100
+
+	requestTimeout = 30 * time.Second
+)
+
+// NewClient returns an uncached client for the cluster described by the kubeconfig.
+// The kubeconfig comes from a tenant's namespace, so only inline credentials are accepted:
+// exec plugins, auth providers and references to local files are rejected, as they would let
+// the kubeconfig run commands in or read files from the manager.
+func NewClient(kubeconfig []byte, scheme *runtime.Scheme) (client.Client, error) {
+	config, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, errors.Errorf("failed to parse kubeconfig: %v", err)
+	}
+	switch {
+	case config.ExecProvider != nil:
+		return nil, errors.New("kubeconfigs with exec plugins are not supported")
+	case config.AuthProvider != nil:
+		return nil, errors.New("kubeconfigs with auth providers are not supported")
+	case config.BearerTokenFile != "" || config.CAFile != "" || config.CertFile != "" || config.KeyFile != "":
+		return nil, errors.New("kubeconfigs referring to files are not supported; embed the credentials and certificates instead")
+	}
+	config.Timeout = requestTimeout
+	httpClient, err := rest.HTTPClientFor(config)
+	if err != nil {
+		return nil, errors.Errorf("failed to create HTTP client: %v", err)
+	}
+	c, err := client.New(config, client.Options{Scheme: scheme, HTTPClient: httpClient})
+	if err != nil {
+		return nil, err
+	}
+	return &remoteClient{Client: c, httpClient: httpClient}, nil
+}
+
+// remoteClient lets the Cache close the connections of a client it drops
+type remoteClient struct {
+	client.Client
+	httpClient *http.Client
+}
+
+func (c *remoteClient) CloseIdleConnections() {
+	c.httpClient.CloseIdleConnections()
+}
+
+// Cache keeps the client built from each kubeconfig Secret until the Secret is changed, replaced or deleted,
+// so that writing a Secret doesn't parse the kubeconfig and set up new connections every time.
+// The zero value is not usable; create it with NewCache.
+type Cache struct {
+	// MaxClients bounds how many clients are kept; the least recently used one is dropped beyond it.
+	// DefaultMaxClients when zero.
+	MaxClients int
+
+	newClient func(kubeconfig []byte) (client.Client, error)
+	builds    singleflight.Group
+
+	mu      sync.Mutex
+	clients map[cacheKey]*list.Element
+	lru     *list.List
+}
+
+// cacheKey identifies a kubeconfig by the UID of its Secret, so that a recreated Secret never gets the client of
+// the one it replaced
+type cacheKey struct {
+	uid types.UID
+	key string
+}
+
+type cachedClient struct {
+	cacheKey
+	resourceVersion string
+	client          client.Client
+}
+
+// NewCache returns a cache building clients with newClient, e.g. NewClient with the manager's scheme
+func NewCache(newClient func(kubeconfig []byte) (client.Client, error)) *Cache {
+	return &Cache{newClient: newClient, clients: map[cacheKey]*list.Element{}, lru: list.New()}
+}
+
+// Client returns the client for the kubeconfig under key in the Secret, building a new one when the Secret's
+// resourceVersion differs from the one the cached client was built from. Concurrent calls for the same
+// version of the Secret share a single build.
+func (c *Cache) Client(secret *corev1.Secret, key string) (client.Client, error) {
+	k := cacheKey{uid: secret.UID, key: key}
+	c.mu.Lock()
+	if e, ok := c.clients[k]; ok && e.Value.(*cachedClient).resourceVersion == secret.ResourceVersion {
+		c.lru.MoveToFront(e)
+		c.mu.Unlock()
+		return e.Value.(*cachedClient).client, nil
+	}
+	c.mu.Unlock()
+
+	kubeconfig, ok := secret.Data[key]
+	if !ok {
+		return nil, errors.Errorf("no key \"%s\"", key)
+	}
+	cl, err, _ := c.builds.Do(string(k.uid)+"/"+k.key+"/"+secret.ResourceVersion, func() (interface{}, error) {
+		cl, err := c.newClient(kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		c.store(&cachedClient{cacheKey: k, resourceVersion: secret.ResourceVersion, client: cl})
+		return cl, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cl.(client.Client), nil
+}
+
+// Forget drops the clients built from the Secret with the UID, e.g. once the Secret was deleted
+func (c *Cache) Forget(uid types.UID) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.clients {
+		if k.uid == uid {
+			c.remove(e)
+		}
+	}
+}
+
+// Len returns the number of clients kept
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.clients)
+}
+
+func (c *Cache) store(cached *cachedClient) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.clients[cached.cacheKey]; ok {
+		c.remove(e)
+	}
+	c.clients[cached.cacheKey] = c.lru.PushFront(cached)
+
+	maxClients := c.MaxClients
+	if maxClients <= 0 {
+		maxClients = DefaultMaxClients
+	}
+	for c.lru.Len() > maxClients {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops the client of e and closes its idle connections. Requests in flight on it still complete.
+func (c *Cache) remove(e *list.Element) {
+	cached := c.lru.Remove(e).(*cachedClient)
+	delete(c.clients, cached.cacheKey)
+	if closer, ok := cached.client.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,192 @@
+package remotecluster
+
+import (
+	goruntime "runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const kubeconfigTemplate = `apiVersion: v1
+kind: Config
+clusters:
+- name: workload
+  cluster:
+    server: https://workload.example.com:6443
+    insecure-skip-tls-verify: true
+contexts:
+- name: workload
+  context:
+    cluster: workload
+    user: admin
+current-context: workload
+users:
+- name: admin
+  user:
+USER
+`
+
+func kubeconfig(user string) []byte {
+	return []byte(strings.Replace(kubeconfigTemplate, "USER", user, 1))
+}
+
+func TestNewClient(t *testing.T) {
+	if _, err := NewClient(kubeconfig("    token: test-token"), runtime.NewScheme()); err != nil {
+		t.Fatalf("Unexpected error for an inline token: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		user string
+	}{
+		{"exec plugin", "    exec:\n      apiVersion: client.authentication.k8s.io/v1\n      command: /bin/sh"},
+		{"auth provider", "    auth-provider:\n      name: oidc"},
+		{"token file", "    tokenFile: /var/run/secrets/kubernetes.io/serviceaccount/token"},
+		{"client certificate file", "    client-certificate: /etc/tls/tls.crt\n    client-key: /etc/tls/tls.key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClient(kubeconfig(tt.user), runtime.NewScheme()); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+
+	if _, err := NewClient([]byte("not a kubeconfig"), runtime.NewScheme()); err == nil {
+		t.Error("Expected an error for an invalid kubeconfig")
+	}
+}
+
+func TestCache(t *testing.T) {
+	built := 0
+	cache := NewCache(func(kubeconfig []byte) (client.Client, error) {
+		built++
+		return NewClient(kubeconfig, runtime.NewScheme())
+	})
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "workload-kubeconfig", Namespace: "default", UID: "uid-1", ResourceVersion: "1"},
+		Data:       map[string][]byte{DefaultKubeconfigKey: kubeconfig("    token: test-token")},
+	}
+
+	first, err := cache.Client(secret, DefaultKubeconfigKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if again, err := cache.Client(secret, DefaultKubeconfigKey); err != nil || again != first || built != 1 {
+		t.Errorf("Expected the cached client for an unchanged Secret, built %d clients", built)
+	}
+
+	secret.ResourceVersion = "2"
+	if _, err := cache.Client(secret, DefaultKubeconfigKey); err != nil || built != 2 {
+		t.Errorf("Expected a new client for a changed Secret, built %d clients", built)
+	}
+	secret.UID = "uid-2"
+	if _, err := cache.Client(secret, DefaultKubeconfigKey); err != nil || built != 3 {
+		t.Errorf("Expected a new client for a recreated Secret, built %d clients", built)
+	}
+	if _, err := cache.Client(secret, "missing"); err == nil {
+		t.Error("Expected an error for a missing key")
+	}
+}
+
+// closingClient records whether the Cache closed its connections
+type closingClient struct {
+	client.Client
+	closed bool
+}
+
+func (c *closingClient) CloseIdleConnections() {
+	c.closed = true
+}
+
+func TestCacheForgetAndEvict(t *testing.T) {
+	var built []*closingClient
+	cache := NewCache(func(kubeconfig []byte) (client.Client, error) {
+		c := &closingClient{}
+		built = append(built, c)
+		return c, nil
+	})
+	cache.MaxClients = 2
+	secret := func(uid string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "workload-kubeconfig", Namespace: "default", UID: types.UID(uid), ResourceVersion: "1"},
+			Data:       map[string][]byte{DefaultKubeconfigKey: kubeconfig("    token: test-token")},
+		}
+	}
+
+	for _, uid := range []string{"uid-1", "uid-2"} {
+		if _, err := cache.Client(secret(uid), DefaultKubeconfigKey); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	cache.Forget("uid-1")
+	if cache.Len() != 1 || !built[0].closed {
+		t.Errorf("Expected the client of the deleted Secret to be dropped and closed, %d clients kept", cache.Len())
+	}
+
+	changed := secret("uid-2")
+	changed.ResourceVersion = "2"
+	if _, err := cache.Client(changed, DefaultKubeconfigKey); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cache.Len() != 1 || !built[1].closed {
+		t.Errorf("Expected the client of the changed Secret to replace the previous one, %d clients kept", cache.Len())
+	}
+
+	for _, uid := range []string{"uid-3", "uid-4"} {
+		if _, err := cache.Client(secret(uid), DefaultKubeconfigKey); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if cache.Len() != 2 || !built[2].closed || built[3].closed {
+		t.Errorf("Expected the least recently used client to be evicted, %d clients kept", cache.Len())
+	}
+}
+
+func TestCacheConcurrentBuilds(t *testing.T) {
+	var built atomic.Int32
+	release := make(chan struct{})
+	cache := NewCache(func(kubeconfig []byte) (client.Client, error) {
+		built.Add(1)
+		<-release
+		return &closingClient{}, nil
+	})
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "workload-kubeconfig", Namespace: "default", UID: "uid-1", ResourceVersion: "1"},
+		Data:       map[string][]byte{DefaultKubeconfigKey: kubeconfig("    token: test-token")},
+	}
+
+	var wg sync.WaitGroup
+	clients := make([]client.Client, 10)
+	for i := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clients[i], _ = cache.Client(secret, DefaultKubeconfigKey)
+		}()
+	}
+	// Let the callers reach the build before it completes
+	for built.Load() == 0 {
+		goruntime.Gosched()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if built.Load() != 1 {
+		t.Errorf("Expected concurrent calls to share one build, built %d clients", built.Load())
+	}
+	for _, c := range clients {
+		if c == nil || c != clients[0] {
+			t.Fatal("Expected every caller to get the same client")
+		}
+	}
+}
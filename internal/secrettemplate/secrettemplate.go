@@ -0,0 +1,121 @@
+package secrettemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+)
+
+const (
+	// InstallationAccessTokenLabel points a Secret back at its InstallationAccessToken
+	InstallationAccessTokenLabel = "tokenaut.appthrust.io/installation-access-token"
+	// ActionsRunnerRegistrationTokenLabel points a Secret back at its ActionsRunnerRegistrationToken
+	ActionsRunnerRegistrationTokenLabel = "tokenaut.appthrust.io/actions-runner-registration-token"
+	// AppJWTLabel points a Secret back at its AppJWT
+	AppJWTLabel = "tokenaut.appthrust.io/app-jwt"
+)
+
+// Source describes the resource a Secret is rendered for
+type Source struct {
+	Name      string
+	Namespace string
+	AppID     string
+	// InstallationID is left empty for app-level credentials
+	InstallationID string
+	Template       *runtime.RawExtension
+	// SourceLabel is the label key whose value refers back to the source resource
+	SourceLabel string
+}
+
+// Render builds the Secret for an InstallationAccessToken, applying spec.template and tokenaut's metadata
+func Render(iat *tokenautv1alpha1.InstallationAccessToken, token string, now time.Time) (*corev1.Secret, error) {
+	return RenderSource(Source{
+		Name:           iat.Name,
+		Namespace:      iat.Namespace,
+		AppID:          iat.Spec.AppID,
+		InstallationID: iat.Spec.InstallationID,
+		Template:       iat.Spec.Template,
+		SourceLabel:    InstallationAccessTokenLabel,
+	}, token, now)
+}
+
+// RenderSource builds the Secret holding token for src, applying its template and tokenaut's metadata
+func RenderSource(src Source, token string, now time.Time) (*corev1.Secret, error) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      src.Name,
+			Namespace: src.Namespace,
+		},
+		Type: corev1.SecretTypeOpaque,
+		StringData: map[string]string{
+			"token": token,
+		},
+	}
+
+	if src.Template != nil {
+		var templateData map[string]interface{}
+		if err := json.Unmarshal(src.Template.Raw, &templateData); err != nil {
+			return nil, errors.Errorf("failed to unmarshal template: %v", err)
+		}
+
+		// The converter resets the Secret, so the defaults are restored for the fields the template leaves out
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(templateData, secret); err != nil {
+			return nil, errors.Errorf("failed to apply template: %v", err)
+		}
+		if secret.Name == "" {
+			secret.Name = src.Name
+		}
+		if secret.Namespace == "" {
+			secret.Namespace = src.Namespace
+		}
+		if secret.Type == "" {
+			secret.Type = corev1.SecretTypeOpaque
+		}
+
+		// Ensure the token is still present in the secret data
+		if len(secret.StringData) == 0 && len(secret.Data) == 0 {
+			secret.StringData = map[string]string{"token": "{{ .Token }}"}
+		}
+		for k, v := range secret.StringData {
+			tpl, err := template.New("secret").Parse(v)
+			if err != nil {
+				return nil, errors.Errorf("failed to parse template: %v", err)
+			}
+			out := new(strings.Builder)
+			err = tpl.Execute(out, map[string]string{"Token": token})
+			if err != nil {
+				return nil, errors.Errorf("failed to execute template: %v", err)
+			}
+			secret.StringData[k] = out.String()
+		}
+	}
+
+	// Add metadata to the secret
+	if secret.Labels == nil {
+		secret.Labels = make(map[string]string)
+	}
+	secret.Labels["app.kubernetes.io/managed-by"] = "tokenaut"
+	secret.Labels[src.SourceLabel] = fmt.Sprintf("%s.%s", src.Namespace, src.Name)
+
+	if secret.Annotations == nil {
+		secret.Annotations = make(map[string]string)
+	}
+	secret.Annotations["tokenaut.appthrust.io/last-updated"] = now.Format(time.RFC3339)
+	secret.Annotations["tokenaut.appthrust.io/app-id"] = src.AppID
+	if src.InstallationID != "" {
+		secret.Annotations["tokenaut.appthrust.io/installation-id"] = src.InstallationID
+	}
+	secret.Annotations["tokenaut.appthrust.io/source-namespace"] = src.Namespace
+	secret.Annotations["tokenaut.appthrust.io/source-name"] = src.Name
+
+	return secret, nil
+}
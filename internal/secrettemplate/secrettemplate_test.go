@@ -0,0 +1,105 @@
+package secrettemplate
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+)
+
+func TestRender(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name          string
+		template      string
+		wantName      string
+		wantNamespace string
+		wantType      corev1.SecretType
+		wantData      map[string]string
+	}{
+		{
+			name:          "Default",
+			wantName:      "our-github-token",
+			wantNamespace: "default",
+			wantType:      corev1.SecretTypeOpaque,
+			wantData:      map[string]string{"token": "ghs_test"},
+		},
+		{
+			name:          "Metadata only",
+			template:      `{"metadata":{"name":"renamed","labels":{"team":"platform"}}}`,
+			wantName:      "renamed",
+			wantNamespace: "default",
+			wantType:      corev1.SecretTypeOpaque,
+			wantData:      map[string]string{"token": "ghs_test"},
+		},
+		{
+			name:          "Custom metadata, type and data",
+			template:      `{"metadata":{"name":"custom","namespace":"other"},"type":"my-custom-type","stringData":{"password":"{{ .Token }}"}}`,
+			wantName:      "custom",
+			wantNamespace: "other",
+			wantType:      "my-custom-type",
+			wantData:      map[string]string{"password": "ghs_test"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			iat := &tokenautv1alpha1.InstallationAccessToken{
+				ObjectMeta: metav1.ObjectMeta{Name: "our-github-token", Namespace: "default"},
+				Spec:       tokenautv1alpha1.InstallationAccessTokenSpec{AppID: "12345", InstallationID: "67890"},
+			}
+			if tc.template != "" {
+				iat.Spec.Template = &runtime.RawExtension{Raw: []byte(tc.template)}
+			}
+
+			secret, err := Render(iat, "ghs_test", now)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if secret.Name != tc.wantName || secret.Namespace != tc.wantNamespace {
+				t.Errorf("Expected %s/%s, got %s/%s", tc.wantNamespace, tc.wantName, secret.Namespace, secret.Name)
+			}
+			if secret.Type != tc.wantType {
+				t.Errorf("Expected type %s, got %s", tc.wantType, secret.Type)
+			}
+			for k, v := range tc.wantData {
+				if secret.StringData[k] != v {
+					t.Errorf("Expected stringData[%s] = %q, got %q", k, v, secret.StringData[k])
+				}
+			}
+			if secret.Labels["tokenaut.appthrust.io/installation-access-token"] != "default.our-github-token" {
+				t.Errorf("Unexpected labels: %v", secret.Labels)
+			}
+			if secret.Annotations["tokenaut.appthrust.io/last-updated"] != "2024-04-01T12:00:00Z" {
+				t.Errorf("Unexpected annotations: %v", secret.Annotations)
+			}
+		})
+	}
+}
+
+func TestRenderSource(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	secret, err := RenderSource(Source{
+		Name:           "runner",
+		Namespace:      "ci",
+		AppID:          "12345",
+		InstallationID: "67890",
+		SourceLabel:    ActionsRunnerRegistrationTokenLabel,
+	}, "AABBCC", now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if secret.StringData["token"] != "AABBCC" {
+		t.Errorf("Expected token AABBCC, got %q", secret.StringData["token"])
+	}
+	if got := secret.Labels[ActionsRunnerRegistrationTokenLabel]; got != "ci.runner" {
+		t.Errorf("Expected source label ci.runner, got %q", got)
+	}
+	if _, ok := secret.Labels[InstallationAccessTokenLabel]; ok {
+		t.Error("Expected no installation access token label")
+	}
+}
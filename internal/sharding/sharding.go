@@ -0,0 +1,59 @@
+// Package sharding splits the resources tokenaut reconciles between managers by their shard label,
+// so that reconcile throughput scales with the number of manager replicas.
+package sharding
+
+import (
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+)
+
+// Validate checks that shard can be used as a label value and in the name of a lease
+func Validate(shard string) error {
+	if shard == "" {
+		return nil
+	}
+	if errs := validation.IsDNS1123Label(shard); len(errs) > 0 {
+		return errors.Errorf("invalid shard \"%s\": %s", shard, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Selector selects the resources of shard: those labeled with it, or those without the shard label when shard is empty
+func Selector(shard string) labels.Selector {
+	operator, values := selection.Equals, []string{shard}
+	if shard == "" {
+		operator, values = selection.DoesNotExist, nil
+	}
+	requirement, err := labels.NewRequirement(tokenautv1alpha1.ShardLabel, operator, values)
+	if err != nil {
+		// Validate rejects the shards the requirement would fail for
+		panic(err)
+	}
+	return labels.NewSelector().Add(*requirement)
+}
+
+// Objects returns an instance of each kind that is split between shards. TokenBindings are not:
+// every replica serves the token broker.
+func Objects() []client.Object {
+	return []client.Object{
+		&tokenautv1alpha1.InstallationAccessToken{},
+		&tokenautv1alpha1.ActionsRunnerRegistrationToken{},
+		&tokenautv1alpha1.AppJWT{},
+	}
+}
+
+// LeaderElectionID returns the ID of the lease the replicas of shard elect their leader with,
+// so that each shard has a leader of its own
+func LeaderElectionID(id, shard string) string {
+	if shard == "" {
+		return id
+	}
+	return shard + "." + id
+}
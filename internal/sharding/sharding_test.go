@@ -0,0 +1,54 @@
+package sharding
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+)
+
+func TestSelector(t *testing.T) {
+	unlabeled := labels.Set{}
+	shardA := labels.Set{tokenautv1alpha1.ShardLabel: "shard-a"}
+	shardB := labels.Set{tokenautv1alpha1.ShardLabel: "shard-b"}
+
+	testCases := []struct {
+		shard string
+		want  []bool
+	}{
+		{shard: "", want: []bool{true, false, false}},
+		{shard: "shard-a", want: []bool{false, true, false}},
+		{shard: "shard-b", want: []bool{false, false, true}},
+	}
+	for _, tc := range testCases {
+		selector := Selector(tc.shard)
+		for i, set := range []labels.Set{unlabeled, shardA, shardB} {
+			if got := selector.Matches(set); got != tc.want[i] {
+				t.Errorf("Shard %q: expected %v for labels %v, got %v", tc.shard, tc.want[i], set, got)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, shard := range []string{"", "shard-a", "0"} {
+		if err := Validate(shard); err != nil {
+			t.Errorf("Unexpected error for %q: %v", shard, err)
+		}
+	}
+	for _, shard := range []string{"Shard-A", "shard_a", "shard.a", "-shard"} {
+		if err := Validate(shard); err == nil {
+			t.Errorf("Expected an error for %q", shard)
+		}
+	}
+}
+
+func TestLeaderElectionID(t *testing.T) {
+	if got := LeaderElectionID("3ebf2d35.tokenaut.appthrust.io", ""); got != "3ebf2d35.tokenaut.appthrust.io" {
+		t.Errorf("Expected the ID to be kept without a shard, got %q", got)
+	}
+	if got := LeaderElectionID("3ebf2d35.tokenaut.appthrust.io", "shard-a"); got != "shard-a.3ebf2d35.tokenaut.appthrust.io" {
+		t.Errorf("Unexpected ID %q", got)
+	}
+}
@@ -0,0 +1,95 @@
+package signer
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+
+	"github.com/cockroachdb/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	"github.com/appthrust/tokenaut/internal/privatekey"
+	"github.com/appthrust/tokenaut/pkg/githubapi"
+)
+
+// ResolveAll returns the signers of a resource in order of preference: the one selected by s, every key
+// of the Secrets in refs, or every key of the Secret referenced by ref. Secrets in refs that cannot be
+// read are skipped as long as another one provides a key.
+func (r *Resolver) ResolveAll(ctx context.Context, c client.Reader, namespace string, ref *tokenautv1alpha1.PrivateKeyRef, refs []tokenautv1alpha1.PrivateKeyRef, s *tokenautv1alpha1.Signer) ([]crypto.Signer, error) {
+	if len(refs) == 0 {
+		if s != nil {
+			signer, err := r.Resolve(ctx, c, namespace, ref, s)
+			if err != nil {
+				return nil, err
+			}
+			return []crypto.Signer{signer}, nil
+		}
+		keys, err := r.access(namespace).GetAll(ctx, c, ref)
+		if err != nil {
+			return nil, err
+		}
+		return appendKeys(nil, keys), nil
+	}
+	if ref != nil || s != nil {
+		return nil, errors.New("only one of `spec.privateKeyRef`, `spec.privateKeyRefs` and `spec.signer` may be set")
+	}
+
+	var signers []crypto.Signer
+	var firstErr error
+	for i := range refs {
+		ref, err := r.privateKeyRef(&refs[i], namespace)
+		if err != nil {
+			return nil, err
+		}
+		keys, err := r.access(namespace).GetAll(ctx, c, ref)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		signers = appendKeys(signers, keys)
+	}
+	if len(signers) == 0 {
+		return nil, firstErr
+	}
+	return signers, nil
+}
+
+func appendKeys(signers []crypto.Signer, keys []*rsa.PrivateKey) []crypto.Signer {
+	for _, key := range keys {
+		signers = append(signers, key)
+	}
+	return signers
+}
+
+// Failover calls try with each signer in turn until GitHub stops rejecting the JWT it signed.
+// It returns the fingerprint of the signer that succeeded and the fingerprints of those GitHub rejected.
+func Failover(signers []crypto.Signer, try func(crypto.Signer) error) (used string, rejected []string, err error) {
+	err = errors.New("no private key available")
+	for _, s := range signers {
+		fingerprint := Fingerprint(s)
+		if err = try(s); err == nil {
+			return fingerprint, rejected, nil
+		}
+		if !githubapi.IsUnauthorized(err) {
+			return "", rejected, err
+		}
+		rejected = append(rejected, fingerprint)
+	}
+	return "", rejected, err
+}
+
+// Fingerprint returns the SHA256 fingerprint of the signer's public key as GitHub shows it, or "" for non-RSA keys
+func Fingerprint(s crypto.Signer) string {
+	pub, ok := s.Public().(*rsa.PublicKey)
+	if !ok {
+		return ""
+	}
+	fingerprint, err := privatekey.Fingerprint(pub)
+	if err != nil {
+		return ""
+	}
+	return "SHA256:" + fingerprint
+}
@@ -0,0 +1,102 @@
+package signer
+
+import (
+	"context"
+	"crypto"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	"github.com/appthrust/tokenaut/pkg/githubapi"
+)
+
+func TestResolveAll(t *testing.T) {
+	oldKey, oldPEM := generateKey(t)
+	newKey, newPEM := generateKey(t)
+	nextKey, nextPEM := generateKey(t)
+	c := fake.NewClientBuilder().WithObjects(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "github-app-private-key", Namespace: "default"},
+			Data:       map[string][]byte{"privateKey": append(append([]byte{}, oldPEM...), newPEM...)},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "next-key", Namespace: "default"},
+			Data:       map[string][]byte{"privateKey": nextPEM},
+		},
+	).Build()
+
+	// A Secret holding several PEM blocks yields every key in order
+	signers, err := (*Resolver)(nil).ResolveAll(context.Background(), c, "default", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(signers) != 2 {
+		t.Fatalf("Expected 2 signers, got %d", len(signers))
+	}
+	verify(t, signers[0], oldKey)
+	verify(t, signers[1], newKey)
+
+	// Unreadable refs are skipped as long as another one provides a key
+	refs := []tokenautv1alpha1.PrivateKeyRef{{Name: "missing"}, {Name: "next-key"}, {Name: "github-app-private-key"}}
+	signers, err = (*Resolver)(nil).ResolveAll(context.Background(), c, "default", nil, refs, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(signers) != 3 {
+		t.Fatalf("Expected 3 signers, got %d", len(signers))
+	}
+	verify(t, signers[0], nextKey)
+
+	if _, err := (*Resolver)(nil).ResolveAll(context.Background(), c, "default", nil, refs[:1], nil); err == nil {
+		t.Error("Expected an error when no ref can be read")
+	}
+	if _, err := (*Resolver)(nil).ResolveAll(context.Background(), c, "default", &refs[1], refs, nil); err == nil {
+		t.Error("Expected an error when both privateKeyRef and privateKeyRefs are set")
+	}
+}
+
+func TestFailover(t *testing.T) {
+	revoked, _ := generateKey(t)
+	active, _ := generateKey(t)
+	unauthorized := &githubapi.APIError{StatusCode: 401, Body: "A JSON web token could not be decoded"}
+
+	var tried []crypto.Signer
+	used, rejected, err := Failover([]crypto.Signer{revoked, active}, func(s crypto.Signer) error {
+		tried = append(tried, s)
+		if s == revoked {
+			return unauthorized
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tried) != 2 {
+		t.Errorf("Expected both keys to be tried, got %d", len(tried))
+	}
+	if used != Fingerprint(active) {
+		t.Errorf("Expected the active key to be used, got %s", used)
+	}
+	if len(rejected) != 1 || rejected[0] != Fingerprint(revoked) {
+		t.Errorf("Expected the revoked key to be rejected, got %v", rejected)
+	}
+
+	// Errors other than 401 are not retried with the next key
+	tried = nil
+	_, _, err = Failover([]crypto.Signer{revoked, active}, func(s crypto.Signer) error {
+		tried = append(tried, s)
+		return errors.New("connection refused")
+	})
+	if err == nil || len(tried) != 1 {
+		t.Errorf("Expected the first error to be returned without failover, got %v after %d tries", err, len(tried))
+	}
+
+	_, rejected, err = Failover([]crypto.Signer{revoked}, func(crypto.Signer) error { return unauthorized })
+	if !githubapi.IsUnauthorized(err) || len(rejected) != 1 {
+		t.Errorf("Expected the 401 to be returned once every key was rejected, got %v", err)
+	}
+}
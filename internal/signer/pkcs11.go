@@ -0,0 +1,144 @@
+//go:build pkcs11
+
+package signer
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/miekg/pkcs11"
+)
+
+// pkcs11Supported reports whether this build supports PKCS#11
+const pkcs11Supported = true
+
+// sha256DigestInfo is the DER prefix of a SHA-256 DigestInfo, which CKM_RSA_PKCS expects in front of the digest
+var sha256DigestInfo = []byte{0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20}
+
+// PKCS11Token is a logged-in session with a PKCS#11 token. Only signatures leave the token.
+type PKCS11Token struct {
+	ctx *pkcs11.Ctx
+
+	// mu serializes use of the session, which PKCS#11 does not allow concurrently
+	mu      sync.Mutex
+	session pkcs11.SessionHandle
+}
+
+// OpenPKCS11 loads the PKCS#11 module and logs into the token with the given label
+func OpenPKCS11(module, tokenLabel, pin string) (*PKCS11Token, error) {
+	ctx := pkcs11.New(module)
+	if ctx == nil {
+		return nil, errors.Errorf("failed to load the PKCS#11 module %q", module)
+	}
+	if err := ctx.Initialize(); err != nil {
+		return nil, errors.Errorf("failed to initialize the PKCS#11 module: %v", err)
+	}
+
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return nil, errors.Errorf("failed to list PKCS#11 slots: %v", err)
+	}
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil || strings.TrimSpace(info.Label) != tokenLabel {
+			continue
+		}
+		session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+		if err != nil {
+			return nil, errors.Errorf("failed to open a PKCS#11 session: %v", err)
+		}
+		if err := ctx.Login(session, pkcs11.CKU_USER, pin); err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN)) {
+			return nil, errors.Errorf("failed to log into the PKCS#11 token %q: %v", tokenLabel, err)
+		}
+		return &PKCS11Token{ctx: ctx, session: session}, nil
+	}
+	return nil, errors.Errorf("no PKCS#11 token labeled %q was found", tokenLabel)
+}
+
+// Signer returns a signer for the RSA private key with the given label
+func (t *PKCS11Token) Signer(keyLabel string) (crypto.Signer, error) {
+	if keyLabel == "" {
+		return nil, errors.New("`spec.signer.pkcs11.keyLabel` is required")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, keyLabel),
+	}
+	if err := t.ctx.FindObjectsInit(t.session, template); err != nil {
+		return nil, errors.Errorf("failed to search the PKCS#11 token: %v", err)
+	}
+	handles, _, err := t.ctx.FindObjects(t.session, 2)
+	if finalErr := t.ctx.FindObjectsFinal(t.session); err == nil {
+		err = finalErr
+	}
+	if err != nil {
+		return nil, errors.Errorf("failed to search the PKCS#11 token: %v", err)
+	}
+	if len(handles) != 1 {
+		return nil, errors.Errorf("expected exactly one RSA private key labeled %q in the PKCS#11 token, found %d", keyLabel, len(handles))
+	}
+
+	attrs, err := t.ctx.GetAttributeValue(t.session, handles[0], []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+	})
+	if err != nil {
+		return nil, errors.Errorf("failed to read the public part of the PKCS#11 key %q: %v", keyLabel, err)
+	}
+	public := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(attrs[0].Value),
+		E: int(new(big.Int).SetBytes(attrs[1].Value).Int64()),
+	}
+	return &pkcs11Signer{token: t, handle: handles[0], label: keyLabel, public: public}, nil
+}
+
+// Close logs out and unloads the module
+func (t *PKCS11Token) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_ = t.ctx.Logout(t.session)
+	_ = t.ctx.CloseSession(t.session)
+	err := t.ctx.Finalize()
+	t.ctx.Destroy()
+	return err
+}
+
+// pkcs11Signer implements crypto.Signer with C_Sign
+type pkcs11Signer struct {
+	token  *PKCS11Token
+	handle pkcs11.ObjectHandle
+	label  string
+	public *rsa.PublicKey
+}
+
+func (s *pkcs11Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign signs a SHA-256 digest with RSASSA-PKCS1-v1_5, the only scheme RS256 JWTs use
+func (s *pkcs11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, pss := opts.(*rsa.PSSOptions); pss || opts.HashFunc() != crypto.SHA256 {
+		return nil, errors.New("the PKCS#11 signer only supports PKCS#1 v1.5 signatures over SHA-256 digests")
+	}
+
+	s.token.mu.Lock()
+	defer s.token.mu.Unlock()
+	if err := s.token.ctx.SignInit(s.token.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)}, s.handle); err != nil {
+		return nil, errors.Errorf("failed to sign with the PKCS#11 key %q: %v", s.label, err)
+	}
+	sig, err := s.token.ctx.Sign(s.token.session, append(append([]byte{}, sha256DigestInfo...), digest...))
+	if err != nil {
+		return nil, errors.Errorf("failed to sign with the PKCS#11 key %q: %v", s.label, err)
+	}
+	return sig, nil
+}
@@ -0,0 +1,26 @@
+//go:build !pkcs11
+
+package signer
+
+import "crypto"
+
+// pkcs11Supported reports whether this build supports PKCS#11
+const pkcs11Supported = false
+
+// PKCS11Token is a logged-in session with a PKCS#11 token. This build does not support PKCS#11.
+type PKCS11Token struct{}
+
+// OpenPKCS11 always fails because this build does not support PKCS#11
+func OpenPKCS11(module, tokenLabel, pin string) (*PKCS11Token, error) {
+	return nil, errPKCS11Unsupported
+}
+
+// Signer always fails because this build does not support PKCS#11
+func (t *PKCS11Token) Signer(keyLabel string) (crypto.Signer, error) {
+	return nil, errPKCS11Unsupported
+}
+
+// Close does nothing
+func (t *PKCS11Token) Close() error {
+	return nil
+}
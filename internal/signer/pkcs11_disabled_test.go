@@ -0,0 +1,22 @@
+//go:build !pkcs11
+
+package signer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+)
+
+func TestPKCS11Unsupported(t *testing.T) {
+	resolver := &Resolver{}
+	_, err := resolver.Resolve(context.Background(), nil, "default", nil, &tokenautv1alpha1.Signer{
+		PKCS11: &tokenautv1alpha1.PKCS11Signer{KeyLabel: "github-app"},
+	})
+	if !errors.Is(err, errPKCS11Unsupported) {
+		t.Errorf("Expected an error saying the build lacks PKCS#11 support, got %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+//go:build pkcs11
+
+package signer
+
+import (
+	"os"
+	"testing"
+
+	"github.com/appthrust/tokenaut/internal/privatekey"
+)
+
+// TestPKCS11 runs against a token prepared e.g. with SoftHSM:
+//
+//	softhsm2-util --init-token --free --label tokenaut --pin 1234 --so-pin 1234
+//	softhsm2-util --import app.pk8 --token tokenaut --label github-app --id 01 --pin 1234
+//	TOKENAUT_PKCS11_MODULE=/usr/lib/softhsm/libsofthsm2.so TOKENAUT_PKCS11_KEY_FILE=app.pem go test -tags pkcs11 ./internal/signer/
+func TestPKCS11(t *testing.T) {
+	module := os.Getenv("TOKENAUT_PKCS11_MODULE")
+	if module == "" {
+		t.Skip("TOKENAUT_PKCS11_MODULE is not set")
+	}
+	keyPEM, err := os.ReadFile(os.Getenv("TOKENAUT_PKCS11_KEY_FILE"))
+	if err != nil {
+		t.Fatalf("Failed to read TOKENAUT_PKCS11_KEY_FILE: %v", err)
+	}
+	key, err := privatekey.Parse(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := OpenPKCS11(module, "tokenaut", "1234")
+	if err != nil {
+		t.Fatalf("Failed to open token: %v", err)
+	}
+	defer token.Close()
+
+	signer, err := token.Signer("github-app")
+	if err != nil {
+		t.Fatalf("Failed to find key: %v", err)
+	}
+	verify(t, signer, key)
+}
@@ -0,0 +1,207 @@
+// Package signer resolves the crypto.Signer used to sign GitHub App JWTs, either from a private key
+// Secret or from a signer that keeps the key outside Kubernetes: a file, Vault Transit or PKCS#11.
+package signer
+
+import (
+	"context"
+	"crypto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"golang.org/x/sync/singleflight"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	"github.com/appthrust/tokenaut/internal/privatekey"
+)
+
+// vaultKeyRefreshInterval is how long the public key of a Vault Transit key is used before its metadata is read again,
+// so that a rotated key is picked up
+const vaultKeyRefreshInterval = 5 * time.Minute
+
+var errPKCS11Unsupported = errors.New("tokenaut was built without PKCS#11 support; use the -pkcs11 image or rebuild with `-tags pkcs11` and CGO_ENABLED=1")
+
+// Resolver resolves the signer of a resource. A nil *Resolver only supports private key Secrets.
+type Resolver struct {
+	// KeyDir is the directory file signers read their keys from. File signers are disabled when empty.
+	KeyDir string
+
+	// Vault signs with Vault Transit keys. Vault Transit signers are disabled when nil.
+	Vault *VaultClient
+
+	// PKCS11 signs with keys held in a PKCS#11 token. PKCS#11 signers are disabled when nil.
+	PKCS11 *PKCS11Token
+
+	// PrivateKeyDefaults locate the private key Secret for fields privateKeyRef leaves empty.
+	// The built-in defaults are used when nil.
+	PrivateKeyDefaults *privatekey.Defaults
+
+	// StrictPrivateKeys only reads private keys from Secrets of type tokenaut.appthrust.io/private-key
+	// that allow the resource's namespace
+	StrictPrivateKeys bool
+
+	mu    sync.Mutex
+	vault map[string]vaultSigner
+
+	// fetching makes concurrent resolves of a Vault Transit key wait for a single fetch of its public key.
+	// The fetch happens outside mu, so that a slow Vault doesn't hold up the keys already fetched.
+	fetching singleflight.Group
+
+	// now replaces time.Now in tests
+	now func() time.Time
+}
+
+type vaultSigner struct {
+	signer    crypto.Signer
+	fetchedAt time.Time
+}
+
+// Resolve returns the signer selected by s, or the private key referenced by ref when s is nil.
+// namespace is the namespace of the resource, which may be used to locate the private key Secret.
+func (r *Resolver) Resolve(ctx context.Context, c client.Reader, namespace string, ref *tokenautv1alpha1.PrivateKeyRef, s *tokenautv1alpha1.Signer) (crypto.Signer, error) {
+	if s == nil {
+		return r.access(namespace).Get(ctx, c, ref)
+	}
+	if ref != nil {
+		return nil, errors.New("only one of `spec.privateKeyRef`, `spec.privateKeyRefs` and `spec.signer` may be set")
+	}
+
+	set := 0
+	for _, isSet := range []bool{s.File != nil, s.VaultTransit != nil, s.PKCS11 != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, errors.New("exactly one of `spec.signer.file`, `spec.signer.vaultTransit` and `spec.signer.pkcs11` must be set")
+	}
+
+	switch {
+	case s.File != nil:
+		return r.file(s.File)
+	case s.VaultTransit != nil:
+		return r.vaultTransit(ctx, s.VaultTransit)
+	default:
+		return r.pkcs11(s.PKCS11)
+	}
+}
+
+// PrivateKeySecrets returns the "namespace/name" of every Secret a resource in namespace reads private keys from,
+// including the default Secret when privateKeyRef is omitted. Signers other than Secrets read none.
+func (r *Resolver) PrivateKeySecrets(namespace string, ref *tokenautv1alpha1.PrivateKeyRef, refs []tokenautv1alpha1.PrivateKeyRef, s *tokenautv1alpha1.Signer) []string {
+	if s != nil {
+		return nil
+	}
+	if len(refs) == 0 {
+		refs = []tokenautv1alpha1.PrivateKeyRef{{}}
+		if ref != nil {
+			refs[0] = *ref
+		}
+	}
+	names := make([]string, 0, len(refs))
+	for i := range refs {
+		ref, err := r.privateKeyRef(&refs[i], namespace)
+		if err != nil {
+			continue
+		}
+		names = append(names, types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}.String())
+	}
+	return names
+}
+
+func (r *Resolver) privateKeyRef(ref *tokenautv1alpha1.PrivateKeyRef, namespace string) (*tokenautv1alpha1.PrivateKeyRef, error) {
+	return r.access(namespace).Defaults.Ref(ref, namespace)
+}
+
+func (r *Resolver) access(namespace string) privatekey.Access {
+	if r == nil {
+		return privatekey.Access{Namespace: namespace}
+	}
+	return privatekey.Access{Strict: r.StrictPrivateKeys, Namespace: namespace, Defaults: r.PrivateKeyDefaults}
+}
+
+func (r *Resolver) file(s *tokenautv1alpha1.FileSigner) (crypto.Signer, error) {
+	if r == nil || r.KeyDir == "" {
+		return nil, errors.New("file signers are disabled; start the manager with --signer-key-dir to enable them")
+	}
+	// Keep the name within the key directory
+	if s.Name == "" || s.Name != filepath.Base(s.Name) || strings.HasPrefix(s.Name, ".") {
+		return nil, errors.Errorf("invalid key file name %q in `spec.signer.file.name`", s.Name)
+	}
+	privateKeyPEM, err := os.ReadFile(filepath.Join(r.KeyDir, s.Name))
+	if err != nil {
+		return nil, errors.Errorf("failed to read the key file %q from the key directory: %v", s.Name, errors.Unwrap(err))
+	}
+	return privatekey.Parse(privateKeyPEM)
+}
+
+func (r *Resolver) vaultTransit(ctx context.Context, s *tokenautv1alpha1.VaultTransitSigner) (crypto.Signer, error) {
+	if r == nil || r.Vault == nil {
+		return nil, errors.New("Vault Transit signers are disabled; start the manager with --vault-address to enable them")
+	}
+	mount := s.Mount
+	if mount == "" {
+		mount = DefaultTransitMount
+	}
+
+	// Signers are kept so that the public key is only fetched once per key and refresh interval. Each signer signs
+	// with the key version its public key belongs to, so a rotation only takes effect once the key is read again.
+	id := mount + "/" + s.Key
+	if signer, ok := r.cachedVaultSigner(id); ok {
+		return signer, nil
+	}
+	signer, err, _ := r.fetching.Do(id, func() (interface{}, error) {
+		// Another resolve may have stored the signer between the lookup and this call
+		if signer, ok := r.cachedVaultSigner(id); ok {
+			return signer, nil
+		}
+		signer, err := r.Vault.Signer(ctx, mount, s.Key)
+		if err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.vault == nil {
+			r.vault = map[string]vaultSigner{}
+		}
+		r.vault[id] = vaultSigner{signer: signer, fetchedAt: r.clock()}
+		return signer, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return signer.(crypto.Signer), nil
+}
+
+// cachedVaultSigner returns the signer of a Vault Transit key unless it is due for a refresh
+func (r *Resolver) cachedVaultSigner(id string) (crypto.Signer, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cached, ok := r.vault[id]
+	if !ok || r.clock().Sub(cached.fetchedAt) >= vaultKeyRefreshInterval {
+		return nil, false
+	}
+	return cached.signer, true
+}
+
+func (r *Resolver) clock() time.Time {
+	if r.now == nil {
+		return time.Now()
+	}
+	return r.now()
+}
+
+func (r *Resolver) pkcs11(s *tokenautv1alpha1.PKCS11Signer) (crypto.Signer, error) {
+	if !pkcs11Supported {
+		return nil, errPKCS11Unsupported
+	}
+	if r == nil || r.PKCS11 == nil {
+		return nil, errors.New("PKCS#11 signers are disabled; start the manager with --pkcs11-module to enable them")
+	}
+	return r.PKCS11.Signer(s.KeyLabel)
+}
@@ -0,0 +1,314 @@
+package signer
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
+	"github.com/appthrust/tokenaut/pkg/githubappjwt"
+)
+
+func generateKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate private key: %v", err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+// verify checks that signer produces RS256 signatures for key
+func verify(t *testing.T, signer crypto.Signer, key *rsa.PrivateKey) {
+	t.Helper()
+	if !key.PublicKey.Equal(signer.Public()) {
+		t.Fatal("Expected the signer's public key to match")
+	}
+	digest := sha256.Sum256([]byte("header.payload"))
+	sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		t.Errorf("Invalid signature: %v", err)
+	}
+}
+
+func TestResolveSecretAndFile(t *testing.T) {
+	key, keyPEM := generateKey(t)
+	c := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "github-app-private-key", Namespace: "default"},
+		Data:       map[string][]byte{"privateKey": keyPEM},
+	}).Build()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.pem"), keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A nil resolver still reads Secrets
+	var nilResolver *Resolver
+	signer, err := nilResolver.Resolve(context.Background(), c, "default", nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	verify(t, signer, key)
+
+	if _, err := nilResolver.Resolve(context.Background(), c, "default", nil, &tokenautv1alpha1.Signer{File: &tokenautv1alpha1.FileSigner{Name: "app.pem"}}); err == nil {
+		t.Error("Expected file signers to be disabled")
+	}
+
+	r := &Resolver{KeyDir: dir}
+	signer, err = r.Resolve(context.Background(), c, "default", nil, &tokenautv1alpha1.Signer{File: &tokenautv1alpha1.FileSigner{Name: "app.pem"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	verify(t, signer, key)
+
+	for _, name := range []string{"../app.pem", ".hidden", ""} {
+		if _, err := r.Resolve(context.Background(), c, "default", nil, &tokenautv1alpha1.Signer{File: &tokenautv1alpha1.FileSigner{Name: name}}); err == nil {
+			t.Errorf("Expected error for file name %q", name)
+		}
+	}
+
+	if _, err := r.Resolve(context.Background(), c, "default", &tokenautv1alpha1.PrivateKeyRef{Name: "x"}, &tokenautv1alpha1.Signer{File: &tokenautv1alpha1.FileSigner{Name: "app.pem"}}); err == nil {
+		t.Error("Expected error when both privateKeyRef and signer are set")
+	}
+	if _, err := r.Resolve(context.Background(), c, "default", nil, &tokenautv1alpha1.Signer{}); err == nil {
+		t.Error("Expected error for an empty signer")
+	}
+}
+
+func TestVaultTransit(t *testing.T) {
+	key, _ := generateKey(t)
+	pubDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+
+	keyReads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.test" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/transit/keys/github-app":
+			keyReads++
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+				"type":           "rsa-2048",
+				"latest_version": 1,
+				"keys":           map[string]interface{}{"1": map[string]string{"public_key": pubPEM}},
+			}})
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/transit/sign/github-app/sha2-256":
+			var req struct {
+				Input              string `json:"input"`
+				Prehashed          bool   `json:"prehashed"`
+				SignatureAlgorithm string `json:"signature_algorithm"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			if !req.Prehashed || req.SignatureAlgorithm != "pkcs1v15" {
+				t.Errorf("Unexpected sign request: %+v", req)
+			}
+			digest, _ := base64.StdEncoding.DecodeString(req.Input)
+			sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest)
+			if err != nil {
+				t.Errorf("Failed to sign: %v", err)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{
+				"signature": "vault:v1:" + base64.StdEncoding.EncodeToString(sig),
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("s.test\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Resolver{Vault: &VaultClient{Address: server.URL, TokenFile: tokenFile}}
+	spec := &tokenautv1alpha1.Signer{VaultTransit: &tokenautv1alpha1.VaultTransitSigner{Key: "github-app"}}
+	for i := 0; i < 2; i++ {
+		signer, err := r.Resolve(context.Background(), nil, "default", nil, spec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		verify(t, signer, key)
+	}
+	if keyReads != 1 {
+		t.Errorf("Expected the public key to be read once, got %d", keyReads)
+	}
+
+	// The request to Vault is cancelled along with the JWT that needs the signature
+	signer, err := r.Resolve(context.Background(), nil, "default", nil, spec)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := githubappjwt.GenerateContext(ctx, "12345", signer); err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Errorf("Expected the cancelled context to stop signing, got %v", err)
+	}
+
+	_, err = r.Resolve(context.Background(), nil, "default", nil, &tokenautv1alpha1.Signer{VaultTransit: &tokenautv1alpha1.VaultTransitSigner{Key: "missing"}})
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected a 404 error, got %v", err)
+	}
+}
+
+func TestVaultTransitConcurrentResolves(t *testing.T) {
+	key, _ := generateKey(t)
+	pubDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyResponse := map[string]interface{}{"data": map[string]interface{}{
+		"type":           "rsa-2048",
+		"latest_version": 1,
+		"keys":           map[string]interface{}{"1": map[string]string{"public_key": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))}},
+	}}
+
+	var slowReads atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/transit/keys/slow":
+			slowReads.Add(1)
+			<-release
+		case "/v1/transit/keys/fast":
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(keyResponse)
+	}))
+	defer server.Close()
+	releaseSlow := sync.OnceFunc(func() { close(release) })
+	defer releaseSlow()
+
+	r := &Resolver{Vault: &VaultClient{Address: server.URL}}
+	fast := &tokenautv1alpha1.Signer{VaultTransit: &tokenautv1alpha1.VaultTransitSigner{Key: "fast"}}
+	if _, err := r.Resolve(context.Background(), nil, "default", nil, fast); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	slow := &tokenautv1alpha1.Signer{VaultTransit: &tokenautv1alpha1.VaultTransitSigner{Key: "slow"}}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.Resolve(context.Background(), nil, "default", nil, slow); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+
+	// A key that was already fetched resolves while another key's fetch is in flight
+	for slowReads.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := r.Resolve(context.Background(), nil, "default", nil, fast); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	releaseSlow()
+	wg.Wait()
+	if got := slowReads.Load(); got != 1 {
+		t.Errorf("Expected the slow key to be read once, got %d", got)
+	}
+}
+
+func TestVaultTransitKeyRotation(t *testing.T) {
+	key1, _ := generateKey(t)
+	key2, _ := generateKey(t)
+	versions := map[int]*rsa.PrivateKey{1: key1}
+	var mu sync.Mutex
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/v1/transit/keys/github-app":
+			keys := map[string]interface{}{}
+			for v, key := range versions {
+				pubDER, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+				keys[strconv.Itoa(v)] = map[string]string{"public_key": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+				"type":           "rsa-2048",
+				"latest_version": len(versions),
+				"keys":           keys,
+			}})
+		case "/v1/transit/sign/github-app/sha2-256":
+			var req struct {
+				Input      string `json:"input"`
+				KeyVersion int    `json:"key_version"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			// Vault signs with the latest version unless key_version is set
+			version := req.KeyVersion
+			if version == 0 {
+				version = len(versions)
+			}
+			digest, _ := base64.StdEncoding.DecodeString(req.Input)
+			sig, err := rsa.SignPKCS1v15(rand.Reader, versions[version], crypto.SHA256, digest)
+			if err != nil {
+				t.Errorf("Failed to sign: %v", err)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{
+				"signature": "vault:v" + strconv.Itoa(version) + ":" + base64.StdEncoding.EncodeToString(sig),
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	r := &Resolver{Vault: &VaultClient{Address: server.URL}, now: func() time.Time { return now }}
+	spec := &tokenautv1alpha1.Signer{VaultTransit: &tokenautv1alpha1.VaultTransitSigner{Key: "github-app"}}
+	resolve := func() crypto.Signer {
+		t.Helper()
+		signer, err := r.Resolve(context.Background(), nil, "default", nil, spec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return signer
+	}
+	verify(t, resolve(), key1)
+
+	// The cached signer keeps signing with the version of its public key after a rotation
+	mu.Lock()
+	versions[2] = key2
+	mu.Unlock()
+	verify(t, resolve(), key1)
+
+	// The rotated key is picked up once the metadata is read again
+	now = now.Add(vaultKeyRefreshInterval)
+	verify(t, resolve(), key2)
+}
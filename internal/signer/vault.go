@@ -0,0 +1,188 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	// DefaultTransitMount is the mount path of the Transit secrets engine used when a signer does not specify one
+	DefaultTransitMount = "transit"
+
+	vaultRequestTimeout = 30 * time.Second
+)
+
+// VaultClient talks to the Vault Transit secrets engine. Only signatures leave Vault.
+type VaultClient struct {
+	// Address of the Vault server, e.g. https://vault.example.com:8200
+	Address string
+
+	// Namespace is sent as X-Vault-Namespace when set (Vault Enterprise)
+	Namespace string
+
+	// TokenFile is read before every request so that a token renewed by e.g. Vault Agent is picked up.
+	// Token is used when TokenFile is empty.
+	TokenFile string
+	Token     string
+
+	HTTPClient *http.Client
+}
+
+// Signer returns a signer for the latest version of the Transit key, fetching its public key once
+func (v *VaultClient) Signer(ctx context.Context, mount, key string) (crypto.Signer, error) {
+	if key == "" {
+		return nil, errors.New("`spec.signer.vaultTransit.key` is required")
+	}
+	var resp struct {
+		Data struct {
+			Type          string `json:"type"`
+			LatestVersion int    `json:"latest_version"`
+			Keys          map[string]struct {
+				PublicKey string `json:"public_key"`
+			} `json:"keys"`
+		} `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodGet, fmt.Sprintf("%s/keys/%s", mount, url.PathEscape(key)), nil, &resp); err != nil {
+		return nil, errors.Errorf("failed to read the Vault Transit key %q: %v", key, err)
+	}
+	if !strings.HasPrefix(resp.Data.Type, "rsa-") {
+		return nil, errors.Errorf("the Vault Transit key %q is of type %q, but GitHub Apps require an RSA key", key, resp.Data.Type)
+	}
+	version, ok := resp.Data.Keys[strconv.Itoa(resp.Data.LatestVersion)]
+	if !ok {
+		return nil, errors.Errorf("the Vault Transit key %q has no public key for its latest version %d", key, resp.Data.LatestVersion)
+	}
+	block, _ := pem.Decode([]byte(version.PublicKey))
+	if block == nil {
+		return nil, errors.Errorf("failed to parse the public key of the Vault Transit key %q", key)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Errorf("failed to parse the public key of the Vault Transit key %q: %v", key, err)
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.Errorf("the Vault Transit key %q is not an RSA key", key)
+	}
+	return &vaultTransitSigner{client: v, mount: mount, key: key, version: resp.Data.LatestVersion, public: rsaPub}, nil
+}
+
+// do sends a request to the Vault API and decodes the JSON response into out
+func (v *VaultClient) do(ctx context.Context, method, path string, in, out interface{}) error {
+	token := v.Token
+	if v.TokenFile != "" {
+		b, err := os.ReadFile(v.TokenFile)
+		if err != nil {
+			return errors.Errorf("failed to read the Vault token file: %v", err)
+		}
+		token = strings.TrimSpace(string(b))
+	}
+
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return errors.Errorf("error marshaling request: %v", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	ctx, cancel := context.WithTimeout(ctx, vaultRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(v.Address, "/")+"/v1/"+path, body)
+	if err != nil {
+		return errors.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient := v.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Errorf("error reading response body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(respBody))
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return errors.Errorf("error unmarshaling response: %v", err)
+	}
+	return nil
+}
+
+// vaultTransitSigner implements crypto.Signer with the Transit sign endpoint. It signs with the key version whose
+// public key it holds, so that Public and the signatures keep matching after the key is rotated in Vault.
+type vaultTransitSigner struct {
+	client  *VaultClient
+	mount   string
+	key     string
+	version int
+	public  *rsa.PublicKey
+}
+
+func (s *vaultTransitSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign signs a SHA-256 digest with RSASSA-PKCS1-v1_5, the only scheme RS256 JWTs use
+func (s *vaultTransitSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.SignContext(context.Background(), rand, digest, opts)
+}
+
+// SignContext is Sign with a context that cancels the request to Vault
+func (s *vaultTransitSigner) SignContext(ctx context.Context, _ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, pss := opts.(*rsa.PSSOptions); pss || opts.HashFunc() != crypto.SHA256 {
+		return nil, errors.New("the Vault Transit signer only supports PKCS#1 v1.5 signatures over SHA-256 digests")
+	}
+	req := map[string]interface{}{
+		"input":               base64.StdEncoding.EncodeToString(digest),
+		"prehashed":           true,
+		"signature_algorithm": "pkcs1v15",
+		"key_version":         s.version,
+	}
+	var resp struct {
+		Data struct {
+			Signature string `json:"signature"`
+		} `json:"data"`
+	}
+	if err := s.client.do(ctx, http.MethodPost, fmt.Sprintf("%s/sign/%s/sha2-256", s.mount, url.PathEscape(s.key)), req, &resp); err != nil {
+		return nil, errors.Errorf("failed to sign with the Vault Transit key %q: %v", s.key, err)
+	}
+	// Signatures look like vault:v1:<base64>
+	parts := strings.SplitN(resp.Data.Signature, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" {
+		return nil, errors.Errorf("unexpected signature format from Vault Transit key %q", s.key)
+	}
+	if parts[1] != fmt.Sprintf("v%d", s.version) {
+		return nil, errors.Errorf("the Vault Transit key %q signed with version %s instead of v%d", s.key, parts[1], s.version)
+	}
+	return base64.StdEncoding.DecodeString(parts[2])
+}
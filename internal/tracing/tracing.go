@@ -0,0 +1,110 @@
+// Package tracing traces reconciles and GitHub API requests with OpenTelemetry and exports the spans over OTLP.
+// Until Setup installs an exporter, spans are created by OpenTelemetry's no-op tracer provider and cost next to nothing.
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cockroachdb/errors"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/appthrust/tokenaut/internal/version"
+	"github.com/appthrust/tokenaut/pkg/githubapi"
+)
+
+const (
+	// ServiceName is the service.name resource attribute of tokenaut's spans
+	ServiceName = "tokenaut"
+
+	tracerName = "github.com/appthrust/tokenaut"
+)
+
+// Attributes set on reconcile spans
+var (
+	AppIDKey          = attribute.Key("github.app.id")
+	InstallationIDKey = attribute.Key("github.installation.id")
+	ResultKey         = attribute.Key("tokenaut.result")
+)
+
+// Config selects where spans are exported
+type Config struct {
+	// Endpoint is the host:port of the OTLP gRPC receiver. Tracing is disabled when empty.
+	Endpoint string
+	// Insecure sends spans without TLS
+	Insecure bool
+	// SampleRatio is the fraction of traces started by tokenaut that are sampled
+	SampleRatio float64
+}
+
+// Setup installs a tracer provider exporting to the OTLP endpoint of config and W3C trace context propagation.
+// The returned function flushes pending spans and stops the exporter; it does nothing when tracing is disabled.
+func Setup(ctx context.Context, config Config) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if config.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(config.Endpoint)}
+	if config.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, errors.Errorf("failed to create the OTLP trace exporter: %v", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(ServiceName),
+		semconv.ServiceVersion(version.Version),
+	))
+	if err != nil {
+		return nil, errors.Errorf("failed to describe the tracing resource: %v", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span named name as a child of the span in ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err, if any, on the span and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// SetResult records the outcome of the reconcile traced by the span in ctx
+func SetResult(ctx context.Context, result string) {
+	trace.SpanFromContext(ctx).SetAttributes(ResultKey.String(result))
+}
+
+// Middleware traces GitHub API requests as client spans and propagates the trace context to GitHub
+// with the W3C traceparent header
+func Middleware() githubapi.Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return otelhttp.NewTransport(next,
+			otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+				return "GitHub " + req.Method
+			}),
+		)
+	}
+}
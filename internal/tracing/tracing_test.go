@@ -0,0 +1,136 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracev1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+
+	"github.com/appthrust/tokenaut/pkg/githubapi"
+)
+
+// collector stands in for an OTLP receiver and keeps the spans it is sent
+type collector struct {
+	collectortrace.UnimplementedTraceServiceServer
+
+	mu    sync.Mutex
+	spans []*tracev1.Span
+}
+
+func (c *collector) Export(_ context.Context, req *collectortrace.ExportTraceServiceRequest) (*collectortrace.ExportTraceServiceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+	return &collectortrace.ExportTraceServiceResponse{}, nil
+}
+
+func (c *collector) span(name string) *tracev1.Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, span := range c.spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func startCollector(t *testing.T) (*collector, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	c := &collector{}
+	server := grpc.NewServer()
+	collectortrace.RegisterTraceServiceServer(server, c)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return c, listener.Addr().String()
+}
+
+func attributeValue(span *tracev1.Span, key string) string {
+	for _, attr := range span.Attributes {
+		if attr.Key == key {
+			return attr.Value.GetStringValue()
+		}
+	}
+	return ""
+}
+
+func TestTracing(t *testing.T) {
+	c, endpoint := startCollector(t)
+	shutdown, err := Setup(context.Background(), Config{Endpoint: endpoint, Insecure: true, SampleRatio: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var traceparent string
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+		w.Write([]byte(`{"id": 12345, "slug": "my-app"}`))
+	}))
+	defer github.Close()
+	clients := githubapi.NewProvider(githubapi.ProviderConfig{Middleware: []githubapi.Middleware{Middleware()}})
+
+	ctx, span := Start(context.Background(), "InstallationAccessToken.Reconcile", AppIDKey.String("12345"))
+	if _, err := clients.Client(github.URL).WithContext(ctx).GetApp("test-jwt"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, child := Start(ctx, "ApplySecret")
+	End(child, errors.New("failed to update secret"))
+	SetResult(ctx, "SecretUpdateError")
+	End(span, nil)
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("Failed to flush spans: %v", err)
+	}
+
+	reconcile := c.span("InstallationAccessToken.Reconcile")
+	if reconcile == nil {
+		t.Fatal("Expected a reconcile span")
+	}
+	if got := attributeValue(reconcile, string(AppIDKey)); got != "12345" {
+		t.Errorf("Expected app ID attribute 12345, got %q", got)
+	}
+	if got := attributeValue(reconcile, string(ResultKey)); got != "SecretUpdateError" {
+		t.Errorf("Expected result attribute SecretUpdateError, got %q", got)
+	}
+
+	apply := c.span("ApplySecret")
+	if apply == nil || apply.Status.GetCode() != tracev1.Status_STATUS_CODE_ERROR {
+		t.Errorf("Expected an ApplySecret span with an error status, got %v", apply)
+	}
+
+	request := c.span("GitHub GET")
+	if request == nil {
+		t.Fatal("Expected a span for the GitHub request")
+	}
+	if string(request.ParentSpanId) != string(reconcile.SpanId) {
+		t.Error("Expected the GitHub request span to be a child of the reconcile span")
+	}
+	if traceparent == "" {
+		t.Error("Expected the traceparent header to be sent to GitHub")
+	}
+}
+
+func TestSetupDisabled(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Config{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+// Package vaultkv writes rendered token Secrets to the HashiCorp Vault KV version 2 secrets engine,
+// for consumers that read their credentials from Vault rather than from Kubernetes Secrets.
+package vaultkv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultMount is the mount path of the KV secrets engine used when a sink does not specify one
+	DefaultMount = "secret"
+
+	// DefaultKubernetesAuthMount is the mount path of the Kubernetes auth method used when a sink does not specify one
+	DefaultKubernetesAuthMount = "kubernetes"
+
+	requestTimeout = 30 * time.Second
+)
+
+// Client talks to a Vault server. Each request is authenticated with the token of the sink making it.
+type Client struct {
+	// Address of the Vault server, e.g. https://vault.example.com:8200
+	Address string
+
+	// Namespace is sent as X-Vault-Namespace when set (Vault Enterprise)
+	Namespace string
+
+	HTTPClient *http.Client
+}
+
+// KubernetesLogin logs in with the Kubernetes auth method mounted at mount and returns the client token
+func (c *Client) KubernetesLogin(ctx context.Context, mount, role, jwt string) (string, error) {
+	if mount == "" {
+		mount = DefaultKubernetesAuthMount
+	}
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	req := map[string]string{"role": role, "jwt": jwt}
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("auth/%s/login", strings.Trim(mount, "/")), "", req, &resp); err != nil {
+		return "", errors.Errorf("failed to log in to Vault as role %q: %v", role, err)
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", errors.Errorf("Vault returned no client token for role %q", role)
+	}
+	return resp.Auth.ClientToken, nil
+}
+
+// do sends a request to the Vault API and decodes the JSON response, if any, into out
+func (c *Client) do(ctx context.Context, method, path, token string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return errors.Errorf("error marshaling request: %v", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.Address, "/")+"/v1/"+path, body)
+	if err != nil {
+		return errors.Errorf("error creating request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Errorf("error reading response body: %v", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		return nil
+	case resp.StatusCode != http.StatusOK:
+		return errors.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(respBody))
+	case out == nil:
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return errors.Errorf("error unmarshaling response: %v", err)
+	}
+	return nil
+}
+
+// Sink writes the data of rendered Secrets to a KV v2 secret
+type Sink struct {
+	Client *Client
+
+	// Mount path of the KV v2 secrets engine
+	Mount string
+
+	// Path of the secret within the mount
+	Path string
+
+	// Token returns the Vault token to authenticate with. It is called for every write and delete.
+	Token func(ctx context.Context) (string, error)
+}
+
+// Put writes the data of the Secret as a new version of the KV secret, replacing all fields written before
+func (s *Sink) Put(ctx context.Context, secret *corev1.Secret) error {
+	data := make(map[string]string, len(secret.Data)+len(secret.StringData))
+	for k, v := range secret.Data {
+		data[k] = string(v)
+	}
+	for k, v := range secret.StringData {
+		data[k] = v
+	}
+	token, err := s.Token(ctx)
+	if err != nil {
+		return err
+	}
+	req := map[string]interface{}{"data": data}
+	if err := s.Client.do(ctx, http.MethodPost, s.apiPath("data"), token, req, nil); err != nil {
+		return errors.Errorf("failed to write to Vault at %q: %v", s.String(), err)
+	}
+	return nil
+}
+
+// Get reads the fields of the latest version of the KV secret
+func (s *Sink) Get(ctx context.Context) (map[string]string, error) {
+	token, err := s.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := s.Client.do(ctx, http.MethodGet, s.apiPath("data"), token, nil, &resp); err != nil {
+		return nil, errors.Errorf("failed to read from Vault at %q: %v", s.String(), err)
+	}
+	return resp.Data.Data, nil
+}
+
+// Delete removes every version and the metadata of the KV secret. A missing secret is not an error.
+func (s *Sink) Delete(ctx context.Context) error {
+	token, err := s.Token(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.Client.do(ctx, http.MethodDelete, s.apiPath("metadata"), token, nil, nil); err != nil {
+		return errors.Errorf("failed to delete from Vault at %q: %v", s.String(), err)
+	}
+	return nil
+}
+
+// String returns the mount and path of the KV secret
+func (s *Sink) String() string {
+	return s.mount() + "/" + strings.Trim(s.Path, "/")
+}
+
+func (s *Sink) mount() string {
+	if s.Mount == "" {
+		return DefaultMount
+	}
+	return strings.Trim(s.Mount, "/")
+}
+
+// apiPath returns the path of the KV v2 endpoint, e.g. secret/data/<path>
+func (s *Sink) apiPath(endpoint string) string {
+	return s.mount() + "/" + endpoint + "/" + strings.Trim(s.Path, "/")
+}
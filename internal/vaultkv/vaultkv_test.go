@@ -0,0 +1,157 @@
+package vaultkv
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func staticToken(token string) func(context.Context) (string, error) {
+	return func(context.Context) (string, error) {
+		return token, nil
+	}
+}
+
+func TestSink(t *testing.T) {
+	var written map[string]string
+	deleted := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("X-Vault-Namespace") != "team-a" {
+			t.Errorf("Expected X-Vault-Namespace 'team-a', got %q", r.Header.Get("X-Vault-Namespace"))
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/kv/data/github/token":
+			var body struct {
+				Data map[string]string `json:"data"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode request body: %v", err)
+			}
+			written = body.Data
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"version": 1}})
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/kv/data/github/token":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": written}})
+		case r.Method == http.MethodDelete && r.URL.Path == "/v1/kv/metadata/github/token":
+			deleted = true
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	sink := &Sink{
+		Client: &Client{Address: server.URL, Namespace: "team-a"},
+		Mount:  "kv",
+		Path:   "/github/token",
+		Token:  staticToken("test-token"),
+	}
+	if sink.String() != "kv/github/token" {
+		t.Errorf("Expected 'kv/github/token', got %q", sink.String())
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "our-github-token", Namespace: "default"},
+		Data:       map[string][]byte{"username": []byte("x-access-token")},
+		StringData: map[string]string{"token": "ghs_test"},
+	}
+	if err := sink.Put(context.Background(), secret); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if written["token"] != "ghs_test" || written["username"] != "x-access-token" {
+		t.Errorf("Expected the Secret's data to be written, got %v", written)
+	}
+	read, err := sink.Get(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if read["token"] != "ghs_test" {
+		t.Errorf("Expected to read the written token, got %v", read)
+	}
+
+	if err := sink.Delete(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !deleted {
+		t.Error("Expected the secret's metadata to be deleted")
+	}
+
+	sink.Token = staticToken("wrong-token")
+	if err := sink.Put(context.Background(), secret); err == nil {
+		t.Error("Expected an error for a rejected token")
+	}
+}
+
+func TestKubernetesLogin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/auth/kubernetes/login" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode request body: %v", err)
+		}
+		if body["role"] != "tokenaut" || body["jwt"] != "sa-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{"client_token": "test-token"}})
+	}))
+	defer server.Close()
+
+	client := &Client{Address: server.URL}
+	token, err := client.KubernetesLogin(context.Background(), "", "tokenaut", "sa-token")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if token != "test-token" {
+		t.Errorf("Expected token 'test-token', got %q", token)
+	}
+	if _, err := client.KubernetesLogin(context.Background(), "", "admin", "sa-token"); err == nil {
+		t.Error("Expected an error for a rejected login")
+	}
+}
+
+// TestSinkLive runs against a dev server started with `vault server -dev`, whose KV v2 engine is mounted at "secret"
+func TestSinkLive(t *testing.T) {
+	addr := os.Getenv("VAULT_ADDR")
+	token := os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		t.Skip("Skipping live Vault test. Set VAULT_ADDR and VAULT_TOKEN environment variables to run this test.")
+	}
+
+	sink := &Sink{
+		Client: &Client{Address: addr},
+		Path:   "tokenaut-test/github-token",
+		Token:  staticToken(token),
+	}
+	secret := &corev1.Secret{StringData: map[string]string{"token": "ghs_live_test"}}
+	if err := sink.Put(context.Background(), secret); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var resp struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := sink.Client.do(context.Background(), http.MethodGet, sink.apiPath("data"), token, nil, &resp); err != nil {
+		t.Fatalf("Failed to read back the secret: %v", err)
+	}
+	if resp.Data.Data["token"] != "ghs_live_test" {
+		t.Errorf("Expected token 'ghs_live_test', got %v", resp.Data.Data)
+	}
+	if err := sink.Delete(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
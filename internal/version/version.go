@@ -0,0 +1,10 @@
+// Package version holds the version tokenaut was built from.
+package version
+
+// Version is set at build time with -ldflags "-X github.com/appthrust/tokenaut/internal/version.Version=<version>"
+var Version = "dev"
+
+// UserAgent identifies tokenaut and its version to the GitHub API
+func UserAgent() string {
+	return "tokenaut/" + Version
+}
@@ -0,0 +1,22 @@
+// Package brokerapi defines the wire format of the tokenaut token broker, shared by the
+// broker and its clients without pulling in the manager's dependencies.
+package brokerapi
+
+import "time"
+
+// TokenPath is the HTTP path pods call to exchange their ServiceAccount token
+const TokenPath = "/v1/token"
+
+// TokenRequest is the optional JSON body of a token request
+type TokenRequest struct {
+	// Binding selects a TokenBinding by name when several bind the calling ServiceAccount
+	Binding string `json:"binding,omitempty"`
+}
+
+// TokenResponse is the JSON body returned to the caller
+type TokenResponse struct {
+	Token               string            `json:"token"`
+	ExpiresAt           time.Time         `json:"expires_at"`
+	Permissions         map[string]string `json:"permissions,omitempty"`
+	RepositorySelection string            `json:"repository_selection,omitempty"`
+}
@@ -1,16 +1,29 @@
 package githubapi
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+)
+
+// DefaultUserAgent is sent with requests when ClientConfig.UserAgent is empty
+const DefaultUserAgent = "tokenaut"
 
 // Client represents a GitHub API client
 type Client struct {
 	config ClientConfig
 	http   *http.Client
+	ctx    context.Context
 }
 
 // ClientConfig holds the configuration for the GitHub API client
 type ClientConfig struct {
 	BaseURL string
+
+	// UserAgent identifies the client to GitHub, DefaultUserAgent when empty
+	UserAgent string
+
+	// HTTPClient sends the requests; a new http.Client with the default transport when nil
+	HTTPClient *http.Client
 }
 
 // NewClient creates a new GitHub API client
@@ -18,8 +31,32 @@ func NewClient(config ClientConfig) *Client {
 	if config.BaseURL == "" {
 		config.BaseURL = "https://api.github.com"
 	}
+	if config.UserAgent == "" {
+		config.UserAgent = DefaultUserAgent
+	}
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
 	return &Client{
 		config: config,
-		http:   &http.Client{},
+		http:   httpClient,
+	}
+}
+
+// WithContext returns a copy of the client that sends its requests with ctx,
+// so that they are canceled with ctx and traced as part of its span
+func (c *Client) WithContext(ctx context.Context) *Client {
+	clone := *c
+	clone.ctx = ctx
+	return &clone
+}
+
+// do sends a request with the headers every request carries
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.ctx != nil {
+		req = req.WithContext(c.ctx)
 	}
+	req.Header.Set("User-Agent", c.config.UserAgent)
+	return c.http.Do(req)
 }
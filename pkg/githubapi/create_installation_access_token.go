@@ -1,14 +1,41 @@
 package githubapi
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/cockroachdb/errors"
 	"io"
 	"net/http"
 	"time"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
 )
 
+// AccessTokenRequest represents the optional body of an installation access token request
+type AccessTokenRequest struct {
+	Repositories  []string          `json:"repositories,omitempty"`
+	RepositoryIDs []int             `json:"repository_ids,omitempty"`
+	Permissions   map[string]string `json:"permissions,omitempty"`
+}
+
+// AccessTokenRequestFromScope returns the body of the request creating a token narrowed to scope, or nil for an unscoped token
+func AccessTokenRequestFromScope(scope *tokenautv1alpha1.Scope) *AccessTokenRequest {
+	if scope == nil {
+		return nil
+	}
+	return &AccessTokenRequest{
+		Repositories:  scope.Repositories,
+		RepositoryIDs: scope.RepositoryIDs,
+		Permissions:   scope.Permissions,
+	}
+}
+
+// IsEmpty reports whether the request narrows the token scope at all
+func (r *AccessTokenRequest) IsEmpty() bool {
+	return r == nil || (len(r.Repositories) == 0 && len(r.RepositoryIDs) == 0 && len(r.Permissions) == 0)
+}
+
 // AccessTokenResponse represents the response from GitHub API for access token
 type AccessTokenResponse struct {
 	Token               string            `json:"token"`
@@ -26,14 +53,30 @@ type Repository struct {
 
 // CreateInstallationAccessToken creates an installation access token for a GitHub App
 func (c *Client) CreateInstallationAccessToken(installationID string, jwt string) (*AccessTokenResponse, error) {
+	return c.CreateScopedInstallationAccessToken(installationID, jwt, nil)
+}
+
+// CreateScopedInstallationAccessToken creates an installation access token restricted to the given repositories and permissions
+func (c *Client) CreateScopedInstallationAccessToken(installationID string, jwt string, scope *AccessTokenRequest) (*AccessTokenResponse, error) {
 	url := fmt.Sprintf("%s/app/installations/%s/access_tokens", c.config.BaseURL, installationID)
-	req, err := http.NewRequest("POST", url, nil)
+	var reqBody io.Reader
+	if !scope.IsEmpty() {
+		b, err := json.Marshal(scope)
+		if err != nil {
+			return &AccessTokenResponse{}, errors.Errorf("error marshaling request: %v", err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest("POST", url, reqBody)
 	if err != nil {
 		return &AccessTokenResponse{}, errors.Errorf("error creating request: %v", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+jwt)
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
-	resp, err := c.http.Do(req)
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.do(req)
 	if err != nil {
 		return &AccessTokenResponse{}, errors.Errorf("error sending request: %v", err)
 	}
@@ -43,7 +86,7 @@ func (c *Client) CreateInstallationAccessToken(installationID string, jwt string
 		return &AccessTokenResponse{}, errors.Errorf("error reading response body: %v", err)
 	}
 	if resp.StatusCode != http.StatusCreated {
-		return &AccessTokenResponse{}, errors.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+		return &AccessTokenResponse{}, &APIError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 	var tokenResp AccessTokenResponse
 	err = json.Unmarshal(body, &tokenResp)
@@ -2,12 +2,15 @@ package githubapi
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
+
+	tokenautv1alpha1 "github.com/appthrust/tokenaut/api/v1alpha1"
 )
 
 func TestCreateInstallationAccessToken(t *testing.T) {
@@ -44,6 +47,48 @@ func TestCreateInstallationAccessToken(t *testing.T) {
 	}
 }
 
+func TestCreateScopedInstallationAccessToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected Content-Type header 'application/json', got %s", r.Header.Get("Content-Type"))
+		}
+		var body AccessTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode request body: %v", err)
+		}
+		if len(body.Repositories) != 1 || body.Repositories[0] != "repo1" {
+			t.Errorf("Expected repositories [repo1], got %v", body.Repositories)
+		}
+		if body.Permissions["contents"] != "read" {
+			t.Errorf("Expected contents permission 'read', got %s", body.Permissions["contents"])
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(AccessTokenResponse{
+			Token:       "test-scoped-token",
+			ExpiresAt:   time.Now().Add(time.Hour),
+			Permissions: body.Permissions,
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient(ClientConfig{
+		BaseURL: server.URL,
+	})
+
+	resp, err := client.CreateScopedInstallationAccessToken("test-installation-id", "test-jwt", &AccessTokenRequest{
+		Repositories: []string{"repo1"},
+		Permissions:  map[string]string{"contents": "read"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if resp.Token != "test-scoped-token" {
+		t.Errorf("Expected token 'test-scoped-token', got %s", resp.Token)
+	}
+}
+
 func TestCreateInstallationAccessTokenError(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusUnauthorized)
@@ -64,6 +109,51 @@ func TestCreateInstallationAccessTokenError(t *testing.T) {
 	if err.Error() != expectedError {
 		t.Errorf("Expected error '%s', got '%s'", expectedError, err.Error())
 	}
+	if !IsUnauthorized(err) {
+		t.Error("Expected IsUnauthorized to report the 401")
+	}
+	if !IsPermanent(err) {
+		t.Error("Expected IsPermanent to report the 401")
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	testCases := []struct {
+		err  error
+		want bool
+	}{
+		{err: &APIError{StatusCode: http.StatusNotFound}, want: true},
+		{err: &APIError{StatusCode: http.StatusUnprocessableEntity}, want: true},
+		{err: &APIError{StatusCode: http.StatusForbidden}, want: false},
+		{err: &APIError{StatusCode: http.StatusBadGateway}, want: false},
+		{err: errors.New("connection refused"), want: false},
+	}
+	for _, tc := range testCases {
+		if got := IsPermanent(tc.err); got != tc.want {
+			t.Errorf("Expected IsPermanent(%v) to be %v, got %v", tc.err, tc.want, got)
+		}
+	}
+}
+
+func TestAccessTokenRequestFromScope(t *testing.T) {
+	if got := AccessTokenRequestFromScope(nil); got != nil {
+		t.Errorf("Expected nil request for a nil scope, got %+v", got)
+	}
+
+	got := AccessTokenRequestFromScope(&tokenautv1alpha1.Scope{
+		Repositories:  []string{"repo1"},
+		RepositoryIDs: []int{42},
+		Permissions:   map[string]string{"contents": "read"},
+	})
+	if len(got.Repositories) != 1 || got.Repositories[0] != "repo1" {
+		t.Errorf("Expected repositories [repo1], got %v", got.Repositories)
+	}
+	if len(got.RepositoryIDs) != 1 || got.RepositoryIDs[0] != 42 {
+		t.Errorf("Expected repository IDs [42], got %v", got.RepositoryIDs)
+	}
+	if got.Permissions["contents"] != "read" {
+		t.Errorf("Expected contents:read permission, got %v", got.Permissions)
+	}
 }
 
 func TestCreateInstallationAccessTokenLive(t *testing.T) {
@@ -0,0 +1,92 @@
+package githubapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// RunnerTokenKind selects between a runner registration and a runner removal token
+type RunnerTokenKind string
+
+const (
+	RunnerTokenKindRegistration RunnerTokenKind = "registration"
+	RunnerTokenKindRemove       RunnerTokenKind = "remove"
+)
+
+// RunnerTarget identifies where self-hosted runners are registered. Exactly one field must be set.
+type RunnerTarget struct {
+	Enterprise   string
+	Organization string
+	// Repository in the "owner/name" form
+	Repository string
+}
+
+// path returns the API path prefix of the target's runners
+func (t RunnerTarget) path() (string, error) {
+	set := 0
+	var path string
+	if t.Enterprise != "" {
+		set++
+		path = fmt.Sprintf("/enterprises/%s/actions/runners", t.Enterprise)
+	}
+	if t.Organization != "" {
+		set++
+		path = fmt.Sprintf("/orgs/%s/actions/runners", t.Organization)
+	}
+	if t.Repository != "" {
+		set++
+		path = fmt.Sprintf("/repos/%s/actions/runners", t.Repository)
+	}
+	if set != 1 {
+		return "", errors.New("exactly one of enterprise, organization or repository must be set")
+	}
+	return path, nil
+}
+
+// RunnerTokenResponse represents the response from GitHub API for runner registration and removal tokens
+type RunnerTokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreateRunnerToken creates a runner registration or removal token using an installation access token
+func (c *Client) CreateRunnerToken(target RunnerTarget, kind RunnerTokenKind, token string) (*RunnerTokenResponse, error) {
+	path, err := target.path()
+	if err != nil {
+		return &RunnerTokenResponse{}, err
+	}
+	switch kind {
+	case RunnerTokenKindRegistration, RunnerTokenKindRemove:
+	default:
+		return &RunnerTokenResponse{}, errors.Errorf("unknown runner token kind %q", kind)
+	}
+	url := fmt.Sprintf("%s%s/%s-token", c.config.BaseURL, path, kind)
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return &RunnerTokenResponse{}, errors.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	resp, err := c.do(req)
+	if err != nil {
+		return &RunnerTokenResponse{}, errors.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &RunnerTokenResponse{}, errors.Errorf("error reading response body: %v", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return &RunnerTokenResponse{}, &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	var tokenResp RunnerTokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return &RunnerTokenResponse{}, errors.Errorf("error unmarshaling response: %v", err)
+	}
+	return &tokenResp, nil
+}
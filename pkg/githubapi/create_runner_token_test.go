@@ -0,0 +1,57 @@
+package githubapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCreateRunnerToken(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("Expected POST request, got %s", r.Method)
+		}
+		if r.Header.Get("Authorization") != "Bearer ghs_test" {
+			t.Errorf("Expected Authorization header 'Bearer ghs_test', got %s", r.Header.Get("Authorization"))
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(RunnerTokenResponse{Token: r.URL.Path, ExpiresAt: expiresAt})
+	}))
+	defer server.Close()
+
+	client := NewClient(ClientConfig{
+		BaseURL: server.URL,
+	})
+
+	tests := []struct {
+		target RunnerTarget
+		kind   RunnerTokenKind
+		path   string
+	}{
+		{RunnerTarget{Organization: "appthrust"}, RunnerTokenKindRegistration, "/orgs/appthrust/actions/runners/registration-token"},
+		{RunnerTarget{Repository: "appthrust/tokenaut"}, RunnerTokenKindRemove, "/repos/appthrust/tokenaut/actions/runners/remove-token"},
+		{RunnerTarget{Enterprise: "acme"}, RunnerTokenKindRegistration, "/enterprises/acme/actions/runners/registration-token"},
+	}
+	for _, tt := range tests {
+		resp, err := client.CreateRunnerToken(tt.target, tt.kind, "ghs_test")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if resp.Token != tt.path {
+			t.Errorf("Expected request to %s, got %s", tt.path, resp.Token)
+		}
+		if !resp.ExpiresAt.Equal(expiresAt) {
+			t.Errorf("Expected expiration %v, got %v", expiresAt, resp.ExpiresAt)
+		}
+	}
+
+	if _, err := client.CreateRunnerToken(RunnerTarget{Organization: "a", Repository: "a/b"}, RunnerTokenKindRegistration, "ghs_test"); err == nil {
+		t.Error("Expected error for ambiguous target")
+	}
+	if _, err := client.CreateRunnerToken(RunnerTarget{Organization: "a"}, "bogus", "ghs_test"); err == nil {
+		t.Error("Expected error for unknown token kind")
+	}
+}
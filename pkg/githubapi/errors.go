@@ -0,0 +1,39 @@
+package githubapi
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/cockroachdb/errors"
+)
+
+// APIError is returned when GitHub answers with an unexpected status code
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d, body: %s", e.StatusCode, e.Body)
+}
+
+// IsUnauthorized reports whether GitHub rejected the credentials, e.g. a JWT signed with a revoked private key
+func IsUnauthorized(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized
+}
+
+// IsPermanent reports whether GitHub will keep failing the request until the app or its configuration changes:
+// rejected credentials, an app that is not installed, or permissions the installation wasn't granted.
+// Other errors, e.g. rate limits, a suspended installation or an outage, may succeed when retried.
+func IsPermanent(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusNotFound, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,291 @@
+// Package fakegithub is an in-memory GitHub API server for tests and local development.
+// It implements the endpoints tokenaut uses with GitHub's authentication rules: JWTs are verified against
+// the registered public keys of an app, installation access tokens are scoped, expire and are revoked,
+// and requests are rate limited.
+//
+// A Server is an http.Handler, usually served with httptest.NewServer. It answers both on the
+// api.github.com paths and on the GitHub Enterprise Server paths under /api/v3.
+package fakegithub
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// TokenLifetime is how long installation access tokens and runner tokens are valid, as on GitHub
+	TokenLifetime = time.Hour
+
+	// MaxTokensPerHour is how many tokens GitHub issues per app, installation and scope within an hour
+	// before revoking the oldest one
+	MaxTokensPerHour = 10
+
+	// DefaultRateLimit is the number of requests per hour GitHub allows an installation
+	DefaultRateLimit = 5000
+
+	// EnterprisePathPrefix is the prefix of the REST API on GitHub Enterprise Server
+	EnterprisePathPrefix = "/api/v3"
+
+	maxJWTLifetime = 10 * time.Minute
+)
+
+// App is a registered GitHub App
+type App struct {
+	ID       int
+	Slug     string
+	Name     string
+	ClientID string
+
+	// PublicKeys verify the JWTs of the app. Several keys are accepted at once, as during a key rotation.
+	PublicKeys []*rsa.PublicKey
+}
+
+// Installation is an installation of an App on an account
+type Installation struct {
+	ID    int
+	AppID int
+
+	// Account is the login of the organization or user the app is installed on
+	Account string
+
+	// Permissions granted to the installation, e.g. {"contents": "write"}
+	Permissions map[string]string
+
+	// AllRepositories grants access to every repository of the account rather than only Repositories
+	AllRepositories bool
+
+	// Repositories of the account the installation can access
+	Repositories []Repository
+
+	// Suspended installations can't create or use tokens
+	Suspended bool
+}
+
+// Repository is a repository of an installation's account
+type Repository struct {
+	ID      int
+	Name    string
+	Private bool
+}
+
+// Token is an installation access token issued by the server
+type Token struct {
+	Token          string
+	InstallationID int
+	ExpiresAt      time.Time
+	Permissions    map[string]string
+	// Repositories the token is restricted to, or nil for all repositories of the installation
+	Repositories []Repository
+	Revoked      bool
+
+	createdAt time.Time
+	scope     string
+}
+
+// Server is a fake GitHub API. Its zero value is not usable; create it with New.
+type Server struct {
+	// Now replaces time.Now, e.g. to expire tokens in tests
+	Now func() time.Time
+
+	// RateLimit is the number of requests each app and each installation may make per hour, DefaultRateLimit when zero
+	RateLimit int
+
+	mu            sync.Mutex
+	apps          map[int]*App
+	installations map[int]*Installation
+	tokens        map[string]*Token
+	rateLimits    map[string]*rateLimit
+}
+
+type rateLimit struct {
+	used  int
+	reset time.Time
+}
+
+// New returns a server without apps
+func New() *Server {
+	return &Server{
+		apps:          map[int]*App{},
+		installations: map[int]*Installation{},
+		tokens:        map[string]*Token{},
+		rateLimits:    map[string]*rateLimit{},
+	}
+}
+
+// AddApp registers an app, replacing an app with the same ID
+func (s *Server) AddApp(app App) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apps[app.ID] = &app
+}
+
+// SetPublicKeys replaces the public keys of an app, e.g. to simulate a revoked private key
+func (s *Server) SetPublicKeys(appID int, keys ...*rsa.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if app, ok := s.apps[appID]; ok {
+		app.PublicKeys = keys
+	}
+}
+
+// AddInstallation registers an installation, replacing an installation with the same ID
+func (s *Server) AddInstallation(installation Installation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.installations[installation.ID] = &installation
+}
+
+// SetSuspended suspends or unsuspends an installation
+func (s *Server) SetSuspended(installationID int, suspended bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if installation, ok := s.installations[installationID]; ok {
+		installation.Suspended = suspended
+	}
+}
+
+// Token returns a copy of an issued installation access token
+func (s *Server) Token(token string) (Token, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[token]
+	if !ok {
+		return Token{}, false
+	}
+	return *t, true
+}
+
+// Tokens returns copies of the installation access tokens issued for an installation, oldest first
+func (s *Server) Tokens(installationID int) []Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tokens []Token
+	for _, t := range s.tokens {
+		if t.InstallationID == installationID {
+			tokens = append(tokens, *t)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].createdAt.Before(tokens[j].createdAt) })
+	return tokens
+}
+
+// RevokeToken revokes an installation access token
+func (s *Server) RevokeToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.tokens[token]; ok {
+		t.Revoked = true
+	}
+}
+
+func (s *Server) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// ServeHTTP routes a request to the endpoint it is for
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, EnterprisePathPrefix)
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && path == "/app":
+		s.getApp(w, r)
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "app" && parts[1] == "installations":
+		s.getInstallation(w, r, parts[2])
+	case r.Method == http.MethodPost && len(parts) == 4 && parts[0] == "app" && parts[1] == "installations" && parts[3] == "access_tokens":
+		s.createInstallationAccessToken(w, r, parts[2])
+	case r.Method == http.MethodGet && path == "/installation/repositories":
+		s.listInstallationRepositories(w, r)
+	case r.Method == http.MethodDelete && path == "/installation/token":
+		s.revokeInstallationAccessToken(w, r)
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/actions/runners/registration-token"),
+		r.Method == http.MethodPost && strings.HasSuffix(path, "/actions/runners/remove-token"):
+		s.createRunnerToken(w, r, parts)
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// errorResponse is the body of GitHub's error responses
+type errorResponse struct {
+	Message          string `json:"message"`
+	DocumentationURL string `json:"documentation_url"`
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Message: message, DocumentationURL: "https://docs.github.com/rest"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// rateLimited counts a request against the hourly limit of key and writes GitHub's rate limit headers.
+// It writes the error response and returns true when the limit is exhausted.
+func (s *Server) rateLimited(w http.ResponseWriter, key, message string) bool {
+	limit := s.RateLimit
+	if limit == 0 {
+		limit = DefaultRateLimit
+	}
+	now := s.now()
+	rl, ok := s.rateLimits[key]
+	if !ok || !now.Before(rl.reset) {
+		rl = &rateLimit{reset: now.Add(time.Hour)}
+		s.rateLimits[key] = rl
+	}
+	exceeded := rl.used >= limit
+	if !exceeded {
+		rl.used++
+	}
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(limit-rl.used))
+	w.Header().Set("X-RateLimit-Used", strconv.Itoa(rl.used))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(rl.reset.Unix(), 10))
+	w.Header().Set("X-RateLimit-Resource", "core")
+	if exceeded {
+		writeError(w, http.StatusForbidden, message)
+	}
+	return exceeded
+}
+
+// bearer returns the credentials of the Authorization header, which GitHub accepts with the "Bearer" and "token" schemes
+func bearer(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	for _, scheme := range []string{"Bearer ", "bearer ", "token "} {
+		if strings.HasPrefix(auth, scheme) {
+			return strings.TrimSpace(strings.TrimPrefix(auth, scheme))
+		}
+	}
+	return ""
+}
+
+const tokenAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// newToken returns a random token with the prefix GitHub uses for its kind, e.g. "ghs_" for installation access tokens
+func newToken(prefix string) string {
+	b := make([]byte, 36)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(tokenAlphabet))))
+		if err != nil {
+			panic(err)
+		}
+		b[i] = tokenAlphabet[n.Int64()]
+	}
+	return prefix + string(b)
+}
@@ -0,0 +1,279 @@
+package fakegithub
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/appthrust/tokenaut/pkg/githubapi"
+	"github.com/appthrust/tokenaut/pkg/githubappjwt"
+)
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	fake := New()
+	fake.AddApp(App{ID: 12345, Slug: "tokenaut-test", Name: "tokenaut test", ClientID: "Iv1.test", PublicKeys: []*rsa.PublicKey{&key.PublicKey}})
+	fake.AddInstallation(Installation{
+		ID:          1234567890,
+		AppID:       12345,
+		Account:     "my-org",
+		Permissions: map[string]string{"contents": "write", "metadata": "read", "administration": "write"},
+		Repositories: []Repository{
+			{ID: 1, Name: "repo1"},
+			{ID: 2, Name: "repo2", Private: true},
+		},
+	})
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server, key
+}
+
+func generateJWT(t *testing.T, issuer string, key *rsa.PrivateKey, opts ...githubappjwt.Option) string {
+	t.Helper()
+	token, err := githubappjwt.Generate(issuer, key, opts...)
+	if err != nil {
+		t.Fatalf("Failed to generate JWT: %v", err)
+	}
+	return token
+}
+
+func TestAppAuthentication(t *testing.T) {
+	_, server, key := newTestServer(t)
+	client := githubapi.NewClient(githubapi.ClientConfig{BaseURL: server.URL})
+
+	for _, issuer := range []string{"12345", "Iv1.test"} {
+		app, err := client.GetApp(generateJWT(t, issuer, key))
+		if err != nil {
+			t.Fatalf("Unexpected error for issuer %s: %v", issuer, err)
+		}
+		if app.ID != 12345 || app.Slug != "tokenaut-test" {
+			t.Errorf("Unexpected app %+v", app)
+		}
+	}
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	expired := githubappjwt.WithClock(func() time.Time { return time.Now().Add(-time.Hour) })
+	tooLong := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{
+		Issuer:    "12345",
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	tooLongJWT, err := tooLong.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT: %v", err)
+	}
+	tests := map[string]string{
+		"unknown key":       generateJWT(t, "12345", otherKey),
+		"unknown app":       generateJWT(t, "54321", key),
+		"expired":           generateJWT(t, "12345", key, expired),
+		"lifetime too long": tooLongJWT,
+		"not a JWT":         "ghs_not_a_jwt",
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := client.GetApp(token); !githubapi.IsUnauthorized(err) {
+				t.Errorf("Expected an unauthorized error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	fake, server, oldKey := newTestServer(t)
+	client := githubapi.NewClient(githubapi.ClientConfig{BaseURL: server.URL})
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	fake.SetPublicKeys(12345, &oldKey.PublicKey, &newKey.PublicKey)
+	for _, key := range []*rsa.PrivateKey{oldKey, newKey} {
+		if _, err := client.CreateInstallationAccessToken("1234567890", generateJWT(t, "12345", key)); err != nil {
+			t.Fatalf("Unexpected error while both keys are registered: %v", err)
+		}
+	}
+
+	fake.SetPublicKeys(12345, &newKey.PublicKey)
+	if _, err := client.CreateInstallationAccessToken("1234567890", generateJWT(t, "12345", oldKey)); !githubapi.IsUnauthorized(err) {
+		t.Errorf("Expected the removed key to be rejected, got %v", err)
+	}
+}
+
+func TestCreateInstallationAccessToken(t *testing.T) {
+	fake, server, key := newTestServer(t)
+	client := githubapi.NewClient(githubapi.ClientConfig{BaseURL: server.URL})
+	jwt := generateJWT(t, "12345", key)
+
+	resp, err := client.CreateInstallationAccessToken("1234567890", jwt)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.Permissions["contents"] != "write" || resp.RepositorySelection != "selected" {
+		t.Errorf("Expected the installation's permissions and repositories, got %+v", resp)
+	}
+	if until := time.Until(resp.ExpiresAt); until < 59*time.Minute || until > time.Hour {
+		t.Errorf("Expected the token to expire in an hour, got %v", resp.ExpiresAt)
+	}
+	repos, err := client.ListInstallationRepositories(resp.Token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if repos.TotalCount != 2 || repos.Repositories[1].FullName != "my-org/repo2" || !repos.Repositories[1].Private {
+		t.Errorf("Unexpected repositories %+v", repos)
+	}
+
+	scoped, err := client.CreateScopedInstallationAccessToken("1234567890", jwt, &githubapi.AccessTokenRequest{
+		RepositoryIDs: []int{2},
+		Permissions:   map[string]string{"contents": "read"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(scoped.Repositories) != 1 || scoped.Repositories[0].Name != "repo2" || scoped.Permissions["contents"] != "read" {
+		t.Errorf("Expected a token for repo2 with contents:read, got %+v", scoped)
+	}
+	token, ok := fake.Token(scoped.Token)
+	if !ok || len(token.Repositories) != 1 || token.Permissions["contents"] != "read" {
+		t.Errorf("Expected the scoped token to be recorded, got %+v", token)
+	}
+
+	for name, scope := range map[string]*githubapi.AccessTokenRequest{
+		"unknown repository":     {Repositories: []string{"repo3"}},
+		"permission not granted": {Permissions: map[string]string{"issues": "read"}},
+		"permission too high":    {Permissions: map[string]string{"metadata": "write"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := client.CreateScopedInstallationAccessToken("1234567890", jwt, scope)
+			if !isStatus(err, http.StatusUnprocessableEntity) {
+				t.Errorf("Expected status 422, got %v", err)
+			}
+		})
+	}
+
+	if _, err := client.CreateInstallationAccessToken("42", jwt); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("Expected status 404 for an unknown installation, got %v", err)
+	}
+}
+
+func TestTokenExpirationAndRevocation(t *testing.T) {
+	fake, server, key := newTestServer(t)
+	now := time.Now()
+	fake.Now = func() time.Time { return now }
+	client := githubapi.NewClient(githubapi.ClientConfig{BaseURL: server.URL})
+	jwt := generateJWT(t, "12345", key)
+
+	var tokens []string
+	for i := 0; i < MaxTokensPerHour+1; i++ {
+		resp, err := client.CreateInstallationAccessToken("1234567890", jwt)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		tokens = append(tokens, resp.Token)
+		now = now.Add(time.Second)
+	}
+	if _, err := client.ListInstallationRepositories(tokens[0]); !githubapi.IsUnauthorized(err) {
+		t.Errorf("Expected the oldest token to be revoked, got %v", err)
+	}
+	if _, err := client.ListInstallationRepositories(tokens[1]); err != nil {
+		t.Errorf("Expected the second token to be valid, got %v", err)
+	}
+	if revoked := fake.Tokens(1234567890); len(revoked) != MaxTokensPerHour+1 || !revoked[0].Revoked || revoked[1].Revoked {
+		t.Errorf("Expected only the oldest token to be revoked, got %+v", revoked)
+	}
+
+	fake.RevokeToken(tokens[1])
+	if _, err := client.ListInstallationRepositories(tokens[1]); !githubapi.IsUnauthorized(err) {
+		t.Errorf("Expected a revoked token to be rejected, got %v", err)
+	}
+
+	now = now.Add(TokenLifetime)
+	if _, err := client.ListInstallationRepositories(tokens[MaxTokensPerHour]); !githubapi.IsUnauthorized(err) {
+		t.Errorf("Expected an expired token to be rejected, got %v", err)
+	}
+}
+
+func TestSuspendedInstallation(t *testing.T) {
+	fake, server, key := newTestServer(t)
+	client := githubapi.NewClient(githubapi.ClientConfig{BaseURL: server.URL})
+	jwt := generateJWT(t, "12345", key)
+
+	resp, err := client.CreateInstallationAccessToken("1234567890", jwt)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fake.SetSuspended(1234567890, true)
+	if _, err := client.CreateInstallationAccessToken("1234567890", jwt); !isStatus(err, http.StatusForbidden) {
+		t.Errorf("Expected status 403 for a suspended installation, got %v", err)
+	}
+	if _, err := client.ListInstallationRepositories(resp.Token); !isStatus(err, http.StatusForbidden) {
+		t.Errorf("Expected status 403 for a token of a suspended installation, got %v", err)
+	}
+	fake.SetSuspended(1234567890, false)
+	if _, err := client.ListInstallationRepositories(resp.Token); err != nil {
+		t.Errorf("Unexpected error after unsuspending: %v", err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	fake, server, key := newTestServer(t)
+	fake.RateLimit = 2
+	client := githubapi.NewClient(githubapi.ClientConfig{BaseURL: server.URL})
+	jwt := generateJWT(t, "12345", key)
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetApp(jwt); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/app", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden || resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("Expected a rate limited response, got %d with X-RateLimit-Remaining %q", resp.StatusCode, resp.Header.Get("X-RateLimit-Remaining"))
+	}
+}
+
+func TestEnterpriseServerPaths(t *testing.T) {
+	_, server, key := newTestServer(t)
+	client := githubapi.NewClient(githubapi.ClientConfig{BaseURL: server.URL + EnterprisePathPrefix})
+
+	resp, err := client.CreateInstallationAccessToken("1234567890", generateJWT(t, "12345", key))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	runnerToken, err := client.CreateRunnerToken(githubapi.RunnerTarget{Repository: "my-org/repo1"}, githubapi.RunnerTokenKindRegistration, resp.Token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if runnerToken.Token == "" {
+		t.Error("Expected a runner token")
+	}
+	if _, err := client.CreateRunnerToken(githubapi.RunnerTarget{Organization: "my-org"}, githubapi.RunnerTokenKindRemove, resp.Token); !isStatus(err, http.StatusForbidden) {
+		t.Errorf("Expected status 403 without organization_self_hosted_runners, got %v", err)
+	}
+}
+
+func isStatus(err error, status int) bool {
+	var apiErr *githubapi.APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
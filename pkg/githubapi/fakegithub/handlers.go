@@ -0,0 +1,400 @@
+package fakegithub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// permissionLevels orders the access levels of a permission
+var permissionLevels = map[string]int{"read": 1, "write": 2, "admin": 3}
+
+type accountResponse struct {
+	Login string `json:"login"`
+}
+
+type appResponse struct {
+	ID       int    `json:"id"`
+	Slug     string `json:"slug"`
+	Name     string `json:"name"`
+	ClientID string `json:"client_id"`
+	HTMLURL  string `json:"html_url"`
+}
+
+type installationResponse struct {
+	ID                  int               `json:"id"`
+	AppID               int               `json:"app_id"`
+	Account             accountResponse   `json:"account"`
+	Permissions         map[string]string `json:"permissions"`
+	RepositorySelection string            `json:"repository_selection"`
+	SuspendedAt         *time.Time        `json:"suspended_at"`
+}
+
+type accessTokenRequest struct {
+	Repositories  []string          `json:"repositories"`
+	RepositoryIDs []int             `json:"repository_ids"`
+	Permissions   map[string]string `json:"permissions"`
+}
+
+type repositoryResponse struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+	Private  bool   `json:"private"`
+}
+
+type accessTokenResponse struct {
+	Token               string               `json:"token"`
+	ExpiresAt           time.Time            `json:"expires_at"`
+	Permissions         map[string]string    `json:"permissions"`
+	RepositorySelection string               `json:"repository_selection"`
+	Repositories        []repositoryResponse `json:"repositories,omitempty"`
+}
+
+type repositoriesResponse struct {
+	TotalCount          int                  `json:"total_count"`
+	RepositorySelection string               `json:"repository_selection"`
+	Repositories        []repositoryResponse `json:"repositories"`
+}
+
+type runnerTokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// authenticateApp verifies the JWT of the request against the public keys of the app it was issued by.
+// It writes the error response and returns nil when the JWT is rejected.
+func (s *Server) authenticateApp(w http.ResponseWriter, r *http.Request) *App {
+	var app *App
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(bearer(r), claims, func(token *jwt.Token) (interface{}, error) {
+		// The issuer is the app's ID, as a string or a number, or its client ID
+		var issuer string
+		switch iss := claims["iss"].(type) {
+		case string:
+			issuer = iss
+		case float64:
+			issuer = strconv.FormatFloat(iss, 'f', -1, 64)
+		}
+		for _, a := range s.apps {
+			if issuer != "" && (issuer == strconv.Itoa(a.ID) || issuer == a.ClientID) {
+				app = a
+			}
+		}
+		if app == nil {
+			return nil, errors.Errorf("unknown issuer %q", issuer)
+		}
+		keys := jwt.VerificationKeySet{}
+		for _, key := range app.PublicKeys {
+			keys.Keys = append(keys.Keys, key)
+		}
+		return keys, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithTimeFunc(s.now),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "A JSON web token could not be decoded")
+		return nil
+	}
+	iat, _ := claims.GetIssuedAt()
+	exp, _ := claims.GetExpirationTime()
+	if iat == nil || exp.Sub(iat.Time) > maxJWTLifetime {
+		writeError(w, http.StatusUnauthorized, "'Expiration time' claim ('exp') is too far in the future")
+		return nil
+	}
+	if s.rateLimited(w, "app:"+strconv.Itoa(app.ID), fmt.Sprintf("API rate limit exceeded for app ID %d.", app.ID)) {
+		return nil
+	}
+	return app
+}
+
+// authenticateToken looks up the installation access token of the request.
+// It writes the error response and returns nil when the token is unknown, expired, revoked or suspended.
+func (s *Server) authenticateToken(w http.ResponseWriter, r *http.Request) (*Token, *Installation) {
+	token, ok := s.tokens[bearer(r)]
+	if !ok || token.Revoked || !s.now().Before(token.ExpiresAt) {
+		writeError(w, http.StatusUnauthorized, "Bad credentials")
+		return nil, nil
+	}
+	installation := s.installations[token.InstallationID]
+	if installation == nil || installation.Suspended {
+		writeError(w, http.StatusForbidden, "This installation has been suspended")
+		return nil, nil
+	}
+	if s.rateLimited(w, "installation:"+strconv.Itoa(installation.ID),
+		fmt.Sprintf("API rate limit exceeded for installation ID %d.", installation.ID)) {
+		return nil, nil
+	}
+	return token, installation
+}
+
+func (s *Server) getApp(w http.ResponseWriter, r *http.Request) {
+	app := s.authenticateApp(w, r)
+	if app == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, appResponse{
+		ID:       app.ID,
+		Slug:     app.Slug,
+		Name:     app.Name,
+		ClientID: app.ClientID,
+		HTMLURL:  "https://github.com/apps/" + app.Slug,
+	})
+}
+
+// installationOf returns the installation of the app with the ID, writing a 404 response when there is none
+func (s *Server) installationOf(w http.ResponseWriter, app *App, id string) *Installation {
+	installationID, err := strconv.Atoi(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return nil
+	}
+	installation, ok := s.installations[installationID]
+	if !ok || installation.AppID != app.ID {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return nil
+	}
+	return installation
+}
+
+func (s *Server) getInstallation(w http.ResponseWriter, r *http.Request, id string) {
+	app := s.authenticateApp(w, r)
+	if app == nil {
+		return
+	}
+	installation := s.installationOf(w, app, id)
+	if installation == nil {
+		return
+	}
+	resp := installationResponse{
+		ID:                  installation.ID,
+		AppID:               installation.AppID,
+		Account:             accountResponse{Login: installation.Account},
+		Permissions:         installation.Permissions,
+		RepositorySelection: repositorySelection(installation.AllRepositories),
+	}
+	if installation.Suspended {
+		now := s.now()
+		resp.SuspendedAt = &now
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) createInstallationAccessToken(w http.ResponseWriter, r *http.Request, id string) {
+	app := s.authenticateApp(w, r)
+	if app == nil {
+		return
+	}
+	installation := s.installationOf(w, app, id)
+	if installation == nil {
+		return
+	}
+	if installation.Suspended {
+		writeError(w, http.StatusForbidden, "This installation has been suspended")
+		return
+	}
+
+	var req accessTokenRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+			return
+		}
+	}
+
+	permissions := installation.Permissions
+	if len(req.Permissions) > 0 {
+		for name, level := range req.Permissions {
+			granted, ok := installation.Permissions[name]
+			if !ok || permissionLevels[level] == 0 || permissionLevels[level] > permissionLevels[granted] {
+				writeError(w, http.StatusUnprocessableEntity, "The permissions requested are not granted to this installation.")
+				return
+			}
+		}
+		permissions = req.Permissions
+	}
+
+	var repositories []Repository
+	if len(req.Repositories) > 0 || len(req.RepositoryIDs) > 0 {
+		selected := map[int]bool{}
+		for _, name := range req.Repositories {
+			repo, ok := findRepository(installation, func(repo Repository) bool { return repo.Name == name })
+			if !ok {
+				writeError(w, http.StatusUnprocessableEntity, "There is at least one repository that does not exist or is not accessible to the parent installation.")
+				return
+			}
+			selected[repo.ID] = true
+		}
+		for _, id := range req.RepositoryIDs {
+			if _, ok := findRepository(installation, func(repo Repository) bool { return repo.ID == id }); !ok {
+				writeError(w, http.StatusUnprocessableEntity, "There is at least one repository that does not exist or is not accessible to the parent installation.")
+				return
+			}
+			selected[id] = true
+		}
+		for _, repo := range installation.Repositories {
+			if selected[repo.ID] {
+				repositories = append(repositories, repo)
+			}
+		}
+	}
+
+	now := s.now()
+	token := &Token{
+		Token:          newToken("ghs_"),
+		InstallationID: installation.ID,
+		ExpiresAt:      now.Add(TokenLifetime).Truncate(time.Second),
+		Permissions:    permissions,
+		Repositories:   repositories,
+		createdAt:      now,
+		scope:          tokenScope(permissions, repositories),
+	}
+	s.tokens[token.Token] = token
+	s.revokeExcessTokens(token)
+
+	resp := accessTokenResponse{
+		Token:               token.Token,
+		ExpiresAt:           token.ExpiresAt,
+		Permissions:         permissions,
+		RepositorySelection: repositorySelection(installation.AllRepositories && repositories == nil),
+	}
+	for _, repo := range repositories {
+		resp.Repositories = append(resp.Repositories, repositoryOf(installation, repo))
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// revokeExcessTokens revokes the oldest tokens of the same installation and scope issued within
+// the last hour, once more than MaxTokensPerHour were issued
+func (s *Server) revokeExcessTokens(latest *Token) {
+	var recent []*Token
+	for _, t := range s.tokens {
+		if t.InstallationID == latest.InstallationID && t.scope == latest.scope && !t.Revoked &&
+			latest.createdAt.Sub(t.createdAt) < time.Hour {
+			recent = append(recent, t)
+		}
+	}
+	sort.Slice(recent, func(i, j int) bool { return recent[i].createdAt.Before(recent[j].createdAt) })
+	for i := 0; i < len(recent)-MaxTokensPerHour; i++ {
+		recent[i].Revoked = true
+	}
+}
+
+func (s *Server) listInstallationRepositories(w http.ResponseWriter, r *http.Request) {
+	token, installation := s.authenticateToken(w, r)
+	if token == nil {
+		return
+	}
+	repositories := token.Repositories
+	if repositories == nil {
+		repositories = installation.Repositories
+	}
+
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage <= 0 || perPage > 100 {
+		perPage = 30
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page <= 0 {
+		page = 1
+	}
+	resp := repositoriesResponse{
+		TotalCount:          len(repositories),
+		RepositorySelection: repositorySelection(installation.AllRepositories && token.Repositories == nil),
+		Repositories:        []repositoryResponse{},
+	}
+	for i := (page - 1) * perPage; i < len(repositories) && i < page*perPage; i++ {
+		resp.Repositories = append(resp.Repositories, repositoryOf(installation, repositories[i]))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) revokeInstallationAccessToken(w http.ResponseWriter, r *http.Request) {
+	token, _ := s.authenticateToken(w, r)
+	if token == nil {
+		return
+	}
+	token.Revoked = true
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createRunnerToken serves POST {/repos/<owner>/<repo>,/orgs/<org>,/enterprises/<enterprise>}/actions/runners/<kind>-token
+func (s *Server) createRunnerToken(w http.ResponseWriter, r *http.Request, parts []string) {
+	token, installation := s.authenticateToken(w, r)
+	if token == nil {
+		return
+	}
+	var allowed bool
+	switch {
+	case len(parts) == 6 && parts[0] == "repos":
+		_, accessible := findRepository(installation, func(repo Repository) bool { return repo.Name == parts[2] })
+		if token.Repositories != nil {
+			accessible = false
+			for _, repo := range token.Repositories {
+				accessible = accessible || repo.Name == parts[2]
+			}
+		}
+		allowed = parts[1] == installation.Account && accessible && permissionLevels[token.Permissions["administration"]] >= permissionLevels["write"]
+	case len(parts) == 5 && parts[0] == "orgs":
+		allowed = parts[1] == installation.Account &&
+			permissionLevels[token.Permissions["organization_self_hosted_runners"]] >= permissionLevels["write"]
+	case len(parts) == 5 && parts[0] == "enterprises":
+		allowed = parts[1] == installation.Account &&
+			permissionLevels[token.Permissions["enterprise_self_hosted_runners"]] >= permissionLevels["write"]
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	if !allowed {
+		writeError(w, http.StatusForbidden, "Resource not accessible by integration")
+		return
+	}
+	writeJSON(w, http.StatusCreated, runnerTokenResponse{
+		Token:     newToken("A"),
+		ExpiresAt: s.now().Add(TokenLifetime).Truncate(time.Second),
+	})
+}
+
+// findRepository returns the first repository of the installation matching the predicate
+func findRepository(installation *Installation, match func(Repository) bool) (Repository, bool) {
+	for _, repo := range installation.Repositories {
+		if match(repo) {
+			return repo, true
+		}
+	}
+	return Repository{}, false
+}
+
+func repositoryOf(installation *Installation, repo Repository) repositoryResponse {
+	return repositoryResponse{ID: repo.ID, Name: repo.Name, FullName: installation.Account + "/" + repo.Name, Private: repo.Private}
+}
+
+func repositorySelection(all bool) string {
+	if all {
+		return "all"
+	}
+	return "selected"
+}
+
+// tokenScope identifies the permissions and repositories of a token, to count the tokens issued per scope
+func tokenScope(permissions map[string]string, repositories []Repository) string {
+	var parts []string
+	for name, level := range permissions {
+		parts = append(parts, name+"="+level)
+	}
+	sort.Strings(parts)
+	for _, repo := range repositories {
+		parts = append(parts, "repo="+strconv.Itoa(repo.ID))
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,45 @@
+package githubapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cockroachdb/errors"
+	"io"
+	"net/http"
+)
+
+// App represents the GitHub App authenticated by a JWT
+type App struct {
+	ID      int    `json:"id"`
+	Slug    string `json:"slug"`
+	Name    string `json:"name"`
+	HTMLURL string `json:"html_url"`
+}
+
+// GetApp returns the GitHub App the JWT was issued for. It is a cheap way to check that GitHub accepts a JWT.
+func (c *Client) GetApp(jwt string) (*App, error) {
+	url := fmt.Sprintf("%s/app", c.config.BaseURL)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, errors.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, errors.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Errorf("error reading response body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	var app App
+	if err := json.Unmarshal(body, &app); err != nil {
+		return nil, errors.Errorf("error unmarshaling response: %v", err)
+	}
+	return &app, nil
+}
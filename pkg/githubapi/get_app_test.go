@@ -0,0 +1,34 @@
+package githubapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetApp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/app" {
+			t.Errorf("Expected GET /app, got %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-jwt" {
+			t.Errorf("Expected Authorization header 'Bearer test-jwt', got %s", r.Header.Get("Authorization"))
+		}
+		json.NewEncoder(w).Encode(App{ID: 12345, Slug: "my-app"})
+	}))
+	defer server.Close()
+
+	client := NewClient(ClientConfig{
+		BaseURL: server.URL,
+	})
+
+	app, err := client.GetApp("test-jwt")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if app.Slug != "my-app" {
+		t.Errorf("Expected slug 'my-app', got %s", app.Slug)
+	}
+}
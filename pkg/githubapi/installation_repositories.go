@@ -0,0 +1,60 @@
+package githubapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cockroachdb/errors"
+	"io"
+	"net/http"
+)
+
+// InstallationRepository represents a repository accessible to an installation access token
+type InstallationRepository struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+	Private  bool   `json:"private"`
+}
+
+// InstallationRepositoriesResponse represents the response from GitHub API for installation repositories
+type InstallationRepositoriesResponse struct {
+	TotalCount          int                      `json:"total_count"`
+	RepositorySelection string                   `json:"repository_selection"`
+	Repositories        []InstallationRepository `json:"repositories"`
+}
+
+// ListInstallationRepositories lists all repositories the installation access token can access
+func (c *Client) ListInstallationRepositories(token string) (*InstallationRepositoriesResponse, error) {
+	result := &InstallationRepositoriesResponse{}
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s/installation/repositories?per_page=100&page=%d", c.config.BaseURL, page)
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, errors.Errorf("error creating request: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Accept", "application/vnd.github.v3+json")
+		resp, err := c.do(req)
+		if err != nil {
+			return nil, errors.Errorf("error sending request: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, errors.Errorf("error reading response body: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+		}
+		var pageResp InstallationRepositoriesResponse
+		if err := json.Unmarshal(body, &pageResp); err != nil {
+			return nil, errors.Errorf("error unmarshaling response: %v", err)
+		}
+		result.TotalCount = pageResp.TotalCount
+		result.RepositorySelection = pageResp.RepositorySelection
+		result.Repositories = append(result.Repositories, pageResp.Repositories...)
+		if len(pageResp.Repositories) == 0 || len(result.Repositories) >= pageResp.TotalCount {
+			return result, nil
+		}
+	}
+}
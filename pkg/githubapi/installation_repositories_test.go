@@ -0,0 +1,50 @@
+package githubapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListInstallationRepositories(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/installation/repositories" {
+			t.Errorf("Expected path /installation/repositories, got %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer ghs_test" {
+			t.Errorf("Expected Authorization header 'Bearer ghs_test', got %s", r.Header.Get("Authorization"))
+		}
+
+		resp := InstallationRepositoriesResponse{TotalCount: 101, RepositorySelection: "selected"}
+		switch r.URL.Query().Get("page") {
+		case "1":
+			for i := 0; i < 100; i++ {
+				resp.Repositories = append(resp.Repositories, InstallationRepository{ID: i, FullName: fmt.Sprintf("my-org/repo%d", i)})
+			}
+		case "2":
+			resp.Repositories = []InstallationRepository{{ID: 100, FullName: "my-org/repo100"}}
+		default:
+			t.Errorf("Unexpected page %s", r.URL.Query().Get("page"))
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(ClientConfig{
+		BaseURL: server.URL,
+	})
+
+	resp, err := client.ListInstallationRepositories("ghs_test")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(resp.Repositories) != 101 {
+		t.Errorf("Expected 101 repositories, got %d", len(resp.Repositories))
+	}
+	if resp.RepositorySelection != "selected" {
+		t.Errorf("Expected repository selection 'selected', got %s", resp.RepositorySelection)
+	}
+}
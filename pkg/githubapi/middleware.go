@@ -0,0 +1,34 @@
+package githubapi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Logging logs every request with its status and duration at verbosity 1. Credentials are never logged.
+func Logging(log logr.Logger) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			keysAndValues := []interface{}{
+				"method", req.Method,
+				"host", req.URL.Host,
+				"path", req.URL.Path,
+				"duration", time.Since(start),
+			}
+			if err != nil {
+				log.V(1).Info("GitHub API request failed", append(keysAndValues, "error", err.Error())...)
+				return nil, err
+			}
+			keysAndValues = append(keysAndValues, "status", resp.StatusCode)
+			if remaining := resp.Header.Get("X-RateLimit-Remaining"); remaining != "" {
+				keysAndValues = append(keysAndValues, "rateLimitRemaining", remaining)
+			}
+			log.V(1).Info("GitHub API request", keysAndValues...)
+			return resp, nil
+		})
+	}
+}
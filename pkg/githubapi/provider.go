@@ -0,0 +1,106 @@
+package githubapi
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds each request sent by the clients of a Provider when ProviderConfig.Timeout is zero
+const DefaultTimeout = 30 * time.Second
+
+// ClientProvider returns the client for a GitHub API endpoint
+type ClientProvider interface {
+	// Client returns the client for the API at baseURL, api.github.com when empty
+	Client(baseURL string) *Client
+}
+
+// Middleware wraps the transport of GitHub API requests, e.g. to log, measure or trace them
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts a function to http.RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req)
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// ProviderConfig holds the configuration shared by the clients of a Provider
+type ProviderConfig struct {
+	// Transport sends the requests of every client; NewTransport() when nil
+	Transport http.RoundTripper
+
+	// Middleware wraps Transport, the first one outermost
+	Middleware []Middleware
+
+	// UserAgent identifies the clients to GitHub, DefaultUserAgent when empty
+	UserAgent string
+
+	// Timeout bounds each request, DefaultTimeout when zero
+	Timeout time.Duration
+}
+
+// Provider hands out one client per GitHub API endpoint, all sharing a transport so that connections are reused
+type Provider struct {
+	config ProviderConfig
+	http   *http.Client
+
+	mu      sync.Mutex
+	clients map[string]*Client
+}
+
+// NewProvider creates a provider with the given configuration
+func NewProvider(config ProviderConfig) *Provider {
+	transport := config.Transport
+	if transport == nil {
+		transport = NewTransport()
+	}
+	for i := len(config.Middleware) - 1; i >= 0; i-- {
+		transport = config.Middleware[i](transport)
+	}
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return &Provider{
+		config:  config,
+		http:    &http.Client{Transport: transport, Timeout: timeout},
+		clients: map[string]*Client{},
+	}
+}
+
+// Client returns the client for the API at baseURL, creating it on first use
+func (p *Provider) Client(baseURL string) *Client {
+	key := strings.TrimSuffix(baseURL, "/")
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c, ok := p.clients[key]; ok {
+		return c
+	}
+	c := NewClient(ClientConfig{BaseURL: key, UserAgent: p.config.UserAgent, HTTPClient: p.http})
+	p.clients[key] = c
+	return c
+}
+
+// NewTransport returns a transport tuned for the few hosts tokenaut talks to: idle connections are kept
+// per host for the next token refresh, and dialing and TLS handshakes are bounded
+func NewTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 20 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
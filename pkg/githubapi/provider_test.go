@@ -0,0 +1,65 @@
+package githubapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProvider(t *testing.T) {
+	var userAgents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.Header.Get("User-Agent"))
+		json.NewEncoder(w).Encode(App{ID: 12345, Slug: "my-app"})
+	}))
+	defer server.Close()
+
+	var calls []string
+	middleware := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	provider := NewProvider(ProviderConfig{
+		Middleware: []Middleware{middleware("outer"), middleware("inner")},
+		UserAgent:  "tokenaut/v1.2.3",
+	})
+
+	client := provider.Client(server.URL)
+	if provider.Client(server.URL+"/") != client {
+		t.Error("Expected the same client for the same endpoint")
+	}
+	if provider.Client("") == client {
+		t.Error("Expected a different client for another endpoint")
+	}
+
+	if _, err := client.GetApp("test-jwt"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(calls) != 2 || calls[0] != "outer" || calls[1] != "inner" {
+		t.Errorf("Expected middleware to run outer first, got %v", calls)
+	}
+	if len(userAgents) != 1 || userAgents[0] != "tokenaut/v1.2.3" {
+		t.Errorf("Expected User-Agent 'tokenaut/v1.2.3', got %v", userAgents)
+	}
+}
+
+func TestNewClientDefaultUserAgent(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		json.NewEncoder(w).Encode(App{ID: 12345})
+	}))
+	defer server.Close()
+
+	if _, err := NewClient(ClientConfig{BaseURL: server.URL}).GetApp("test-jwt"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if userAgent != DefaultUserAgent {
+		t.Errorf("Expected User-Agent %q, got %q", DefaultUserAgent, userAgent)
+	}
+}
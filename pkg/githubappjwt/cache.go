@@ -0,0 +1,115 @@
+package githubappjwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultMinRemaining is how long a cached JWT must still be valid to be handed out again
+const DefaultMinRemaining = 2 * time.Minute
+
+// Cache reuses a signed JWT per issuer and private key until it gets close to expiring,
+// so that each reconcile doesn't sign a new one. The zero value is not usable; use NewCache.
+// A nil *Cache is valid and signs a fresh JWT on every call.
+type Cache struct {
+	// MinRemaining is how long a cached JWT must still be valid to be reused
+	MinRemaining time.Duration
+
+	opts    options
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+
+	// signing makes concurrent callers wait for a single signature per key. Signing happens outside mu,
+	// because remote signers such as Vault Transit or an HSM take a round-trip that must not hold up other keys.
+	signing singleflight.Group
+}
+
+type cacheEntry struct {
+	token     string
+	expiresAt time.Time
+}
+
+// NewCache creates a cache that generates JWTs with the given options
+func NewCache(opts ...Option) *Cache {
+	return &Cache{
+		MinRemaining: DefaultMinRemaining,
+		opts:         newOptions(opts),
+		entries:      map[string]cacheEntry{},
+	}
+}
+
+// Generate returns a cached JWT for the issuer and key, signing a new one when none is fresh enough
+func (c *Cache) Generate(issuer string, signer crypto.Signer) (string, error) {
+	return c.GenerateContext(context.Background(), issuer, signer)
+}
+
+// GenerateContext is Generate with a context passed on to a signer implementing ContextSigner. Concurrent callers
+// for the same key share the signature made within the context of the first one.
+func (c *Cache) GenerateContext(ctx context.Context, issuer string, signer crypto.Signer) (string, error) {
+	if c == nil {
+		return GenerateContext(ctx, issuer, signer)
+	}
+
+	pub, err := publicKey(signer)
+	if err != nil {
+		return "", err
+	}
+	key := cacheKey(issuer, pub)
+	if token, ok := c.get(key); ok {
+		return token, nil
+	}
+
+	token, err, _ := c.signing.Do(key, func() (interface{}, error) {
+		// Another caller may have stored a JWT between the lookup and this call
+		if token, ok := c.get(key); ok {
+			return token, nil
+		}
+		token, err := generate(ctx, issuer, signer, c.opts)
+		if err != nil {
+			return "", err
+		}
+		c.put(key, token.Token, token.ExpiresAt)
+		return token.Token, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return token.(string), nil
+}
+
+// get returns the cached JWT for key if it is fresh enough
+func (c *Cache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || e.expiresAt.Sub(c.opts.now()) < c.MinRemaining {
+		return "", false
+	}
+	return e.token, true
+}
+
+func (c *Cache) put(key, token string, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Drop entries that expired so that rotated keys don't accumulate
+	now := c.opts.now()
+	for k, e := range c.entries {
+		if !e.expiresAt.After(now) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{token: token, expiresAt: expiresAt}
+}
+
+// cacheKey identifies an issuer and a key, so that a rotated key never reuses a JWT signed by its predecessor
+func cacheKey(issuer string, pub *rsa.PublicKey) string {
+	sum := sha256.Sum256(pub.N.Bytes())
+	return issuer + "/" + hex.EncodeToString(sum[:])
+}
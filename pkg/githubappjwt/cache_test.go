@@ -0,0 +1,134 @@
+package githubappjwt
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	privateKey := parseTestPrivateKey(t)
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewCache(WithClock(func() time.Time { return now }))
+
+	first, err := cache.Generate("975222", privateKey)
+	if err != nil {
+		t.Fatalf("Failed to generate JWT: %v", err)
+	}
+
+	now = now.Add(DefaultExpiration - DefaultMinRemaining)
+	second, err := cache.Generate("975222", privateKey)
+	if err != nil {
+		t.Fatalf("Failed to generate JWT: %v", err)
+	}
+	if second != first {
+		t.Error("Expected the cached JWT to be reused")
+	}
+
+	other, err := cache.Generate("123456", privateKey)
+	if err != nil {
+		t.Fatalf("Failed to generate JWT: %v", err)
+	}
+	if other == first {
+		t.Error("Expected a different JWT for another app")
+	}
+
+	rotatedKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	rotated, err := cache.Generate("975222", rotatedKey)
+	if err != nil {
+		t.Fatalf("Failed to generate JWT: %v", err)
+	}
+	if rotated == first {
+		t.Error("Expected a different JWT for a rotated key")
+	}
+
+	now = now.Add(time.Second)
+	third, err := cache.Generate("975222", privateKey)
+	if err != nil {
+		t.Fatalf("Failed to generate JWT: %v", err)
+	}
+	if third == first {
+		t.Error("Expected a new JWT once the cached one is close to expiring")
+	}
+	if got := parseClaims(t, third).IssuedAt.Time; !got.Equal(now.Add(-DefaultBackdate)) {
+		t.Errorf("Expected iat %v, got %v", now.Add(-DefaultBackdate), got)
+	}
+}
+
+func TestNilCache(t *testing.T) {
+	var cache *Cache
+	if _, err := cache.Generate("975222", parseTestPrivateKey(t)); err != nil {
+		t.Fatalf("Failed to generate JWT: %v", err)
+	}
+}
+
+// blockingSigner signs once release is closed and counts its signatures
+type blockingSigner struct {
+	*rsa.PrivateKey
+	release <-chan struct{}
+	signed  atomic.Int32
+}
+
+func (s *blockingSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	<-s.release
+	s.signed.Add(1)
+	return s.PrivateKey.Sign(rand, digest, opts)
+}
+
+func TestCacheConcurrentSigning(t *testing.T) {
+	cache := NewCache()
+	release := make(chan struct{})
+	slow := &blockingSigner{PrivateKey: parseTestPrivateKey(t), release: release}
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 5)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			token, err := cache.Generate("975222", slow)
+			if err != nil {
+				t.Errorf("Failed to generate JWT: %v", err)
+			}
+			tokens[i] = token
+		}(i)
+	}
+
+	// Another key is signed while the slow signature is pending
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := cache.Generate("975222", otherKey)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Failed to generate JWT: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected a pending signature not to block signing with another key")
+	}
+
+	close(release)
+	wg.Wait()
+	if got := slow.signed.Load(); got != 1 {
+		t.Errorf("Expected concurrent callers to share one signature, got %d", got)
+	}
+	for _, token := range tokens[1:] {
+		if token != tokens[0] {
+			t.Error("Expected concurrent callers to get the same JWT")
+		}
+	}
+}
@@ -1,29 +1,123 @@
 package githubappjwt
 
 import (
-	"crypto/rsa"
+	"context"
+	"crypto"
+	"time"
+
 	"github.com/cockroachdb/errors"
 	"github.com/golang-jwt/jwt/v5"
-	"time"
 )
 
-// Generate generates a JWT for a GitHub App
-func Generate(appID string, privateKey *rsa.PrivateKey, expiration ...time.Duration) (string, error) {
-	exp := 10 * time.Minute // デフォルト値を10分に設定
+const (
+	// MaxExpiration is the longest JWT lifetime GitHub accepts
+	MaxExpiration = 10 * time.Minute
+
+	// DefaultBackdate is how far in the past the "iat" claim is set to tolerate clock drift, as GitHub recommends
+	DefaultBackdate = 60 * time.Second
+
+	// DefaultExpiration leaves room under MaxExpiration for a clock running ahead of GitHub's
+	DefaultExpiration = MaxExpiration - DefaultBackdate
+)
+
+type options struct {
+	backdate   time.Duration
+	expiration time.Duration
+	now        func() time.Time
+}
+
+// Option customizes the claims of a generated JWT
+type Option func(*options)
+
+// WithBackdate sets how far in the past the "iat" claim is set
+func WithBackdate(d time.Duration) Option {
+	return func(o *options) {
+		o.backdate = d
+	}
+}
+
+// WithExpiration sets how long after now the JWT expires. It is capped at MaxExpiration.
+func WithExpiration(d time.Duration) Option {
+	return func(o *options) {
+		o.expiration = d
+	}
+}
+
+// WithClock replaces time.Now, mainly for tests
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		backdate:   DefaultBackdate,
+		expiration: DefaultExpiration,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.expiration <= 0 || o.expiration > MaxExpiration {
+		o.expiration = MaxExpiration
+	}
+	if o.backdate < 0 {
+		o.backdate = 0
+	}
+	return o
+}
+
+// Generate generates a JWT for a GitHub App. The issuer is either the app's ID or its client ID, both of which GitHub accepts.
+// The signer is usually an *rsa.PrivateKey, but any crypto.Signer holding the app's RSA key works.
+func Generate(issuer string, signer crypto.Signer, opts ...Option) (string, error) {
+	return GenerateContext(context.Background(), issuer, signer, opts...)
+}
 
-	if len(expiration) > 0 {
-		exp = expiration[0]
+// GenerateContext is Generate with a context passed on to a signer implementing ContextSigner
+func GenerateContext(ctx context.Context, issuer string, signer crypto.Signer, opts ...Option) (string, error) {
+	token, err := GenerateToken(ctx, issuer, signer, opts...)
+	if err != nil {
+		return "", err
 	}
+	return token.Token, nil
+}
+
+// Token is a signed JWT along with the validity signed into it
+type Token struct {
+	// Token is the signed JWT
+	Token string
+	// IssuedAt is the "iat" claim, backdated from the time of signing
+	IssuedAt time.Time
+	// ExpiresAt is the "exp" claim
+	ExpiresAt time.Time
+}
 
+// GenerateToken is GenerateContext, also returning the "iat" and "exp" claims of the JWT
+func GenerateToken(ctx context.Context, issuer string, signer crypto.Signer, opts ...Option) (*Token, error) {
+	return generate(ctx, issuer, signer, newOptions(opts))
+}
+
+func generate(ctx context.Context, issuer string, signer crypto.Signer, o options) (*Token, error) {
+	if issuer == "" {
+		return nil, errors.New("issuer (app ID or client ID) is required")
+	}
+	if signer == nil {
+		return nil, errors.New("signer is required")
+	}
+	now := o.now()
+	// NumericDate drops sub-second precision
+	issuedAt := now.Add(-o.backdate).Truncate(time.Second)
+	expiresAt := now.Add(o.expiration).Truncate(time.Second)
 	claims := jwt.RegisteredClaims{
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(exp)),
-		Issuer:    appID,
+		IssuedAt:  jwt.NewNumericDate(issuedAt),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		Issuer:    issuer,
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	signedToken, err := token.SignedString(privateKey)
+	token := jwt.NewWithClaims(rs256, claims)
+	signedToken, err := token.SignedString(signingKey{ctx: ctx, signer: signer})
 	if err != nil {
-		return "", errors.Errorf("error signing token: %v", err)
+		return nil, errors.Errorf("error signing token: %v", err)
 	}
-	return signedToken, nil
+	return &Token{Token: signedToken, IssuedAt: issuedAt, ExpiresAt: expiresAt}, nil
 }
@@ -1,9 +1,13 @@
 package githubappjwt
 
 import (
+	"context"
+	"crypto"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"io"
 	"testing"
 	"time"
 
@@ -73,7 +77,7 @@ func TestGenerateJwtWithPEM(t *testing.T) {
 			if tc.expiration == 0 {
 				token, err = Generate(appID, privateKey)
 			} else {
-				token, err = Generate(appID, privateKey, tc.expiration)
+				token, err = Generate(appID, privateKey, WithExpiration(tc.expiration))
 			}
 			if err != nil {
 				t.Fatalf("Failed to generate JWT: %v", err)
@@ -124,3 +128,113 @@ func TestGenerateJwtWithPEM(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateOptions(t *testing.T) {
+	privateKey := parseTestPrivateKey(t)
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	testCases := []struct {
+		name    string
+		opts    []Option
+		wantIat time.Time
+		wantExp time.Time
+	}{
+		{"Defaults", nil, now.Add(-DefaultBackdate), now.Add(DefaultExpiration)},
+		{"Custom backdate", []Option{WithBackdate(30 * time.Second)}, now.Add(-30 * time.Second), now.Add(DefaultExpiration)},
+		{"Expiration capped", []Option{WithExpiration(time.Hour)}, now.Add(-DefaultBackdate), now.Add(MaxExpiration)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := Generate("Iv1.abc123", privateKey, append(tc.opts, WithClock(clock))...)
+			if err != nil {
+				t.Fatalf("Failed to generate JWT: %v", err)
+			}
+			claims := parseClaims(t, token)
+			if claims.Issuer != "Iv1.abc123" {
+				t.Errorf("Expected issuer Iv1.abc123, got %s", claims.Issuer)
+			}
+			if !claims.IssuedAt.Equal(tc.wantIat) {
+				t.Errorf("Expected iat %v, got %v", tc.wantIat, claims.IssuedAt)
+			}
+			if !claims.ExpiresAt.Equal(tc.wantExp) {
+				t.Errorf("Expected exp %v, got %v", tc.wantExp, claims.ExpiresAt)
+			}
+		})
+	}
+
+	if _, err := Generate("", privateKey); err == nil {
+		t.Error("Expected error for empty issuer")
+	}
+}
+
+func TestGenerateToken(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 500_000_000, time.UTC)
+	token, err := GenerateToken(context.Background(), "12345", parseTestPrivateKey(t), WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("Failed to generate JWT: %v", err)
+	}
+	claims := parseClaims(t, token.Token)
+	if !token.IssuedAt.Equal(claims.IssuedAt.Time) {
+		t.Errorf("Expected issued at %v to match iat %v", token.IssuedAt, claims.IssuedAt)
+	}
+	if !token.ExpiresAt.Equal(claims.ExpiresAt.Time) {
+		t.Errorf("Expected expires at %v to match exp %v", token.ExpiresAt, claims.ExpiresAt)
+	}
+	if want := now.Add(DefaultExpiration).Truncate(time.Second); !token.ExpiresAt.Equal(want) {
+		t.Errorf("Expected expires at %v, got %v", want, token.ExpiresAt)
+	}
+}
+
+// contextSigner fails to sign once its context is done, like a remote signer whose request is cancelled
+type contextSigner struct {
+	*rsa.PrivateKey
+}
+
+func (s contextSigner) SignContext(ctx context.Context, rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.Sign(rand, digest, opts)
+}
+
+func TestGenerateContext(t *testing.T) {
+	signer := contextSigner{parseTestPrivateKey(t)}
+
+	token, err := GenerateContext(context.Background(), "12345", signer)
+	if err != nil {
+		t.Fatalf("Failed to generate JWT: %v", err)
+	}
+	if _, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return signer.Public(), nil }); err != nil {
+		t.Errorf("Invalid JWT: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := GenerateContext(ctx, "12345", signer); err == nil {
+		t.Error("Expected a cancelled context to stop the signer")
+	}
+	if _, err := NewCache().GenerateContext(ctx, "12345", signer); err == nil {
+		t.Error("Expected a cancelled context to stop the signer of a cache")
+	}
+}
+
+func parseTestPrivateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	block, _ := pem.Decode([]byte(testPrivateKeyPEM))
+	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse private key: %v", err)
+	}
+	return privateKey
+}
+
+func parseClaims(t *testing.T, token string) *jwt.RegisteredClaims {
+	t.Helper()
+	claims := &jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		t.Fatalf("Failed to parse JWT: %v", err)
+	}
+	return claims
+}
@@ -0,0 +1,71 @@
+package githubappjwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"io"
+
+	"github.com/cockroachdb/errors"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ContextSigner is a crypto.Signer that can also sign within a context. Remote signers such as Vault Transit
+// implement it, so that a hung signature is cancelled along with the request that needed the JWT.
+type ContextSigner interface {
+	crypto.Signer
+	SignContext(ctx context.Context, rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error)
+}
+
+// signingKey is the key passed to the signing method, carrying the context of the caller to a ContextSigner
+type signingKey struct {
+	ctx    context.Context
+	signer crypto.Signer
+}
+
+// signingMethodRS256 signs RS256 JWTs with any crypto.Signer holding an RSA key, such as an
+// *rsa.PrivateKey, a KMS or an HSM, so that the private key itself never has to be loaded.
+type signingMethodRS256 struct{}
+
+var rs256 jwt.SigningMethod = signingMethodRS256{}
+
+func (signingMethodRS256) Alg() string {
+	return jwt.SigningMethodRS256.Alg()
+}
+
+func (signingMethodRS256) Verify(signingString string, sig []byte, key interface{}) error {
+	return jwt.SigningMethodRS256.Verify(signingString, sig, key)
+}
+
+func (signingMethodRS256) Sign(signingString string, key interface{}) ([]byte, error) {
+	ctx := context.Background()
+	if k, ok := key.(signingKey); ok {
+		ctx, key = k.ctx, k.signer
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("expected a crypto.Signer, got %T", key)
+	}
+	if _, ok := signer.Public().(*rsa.PublicKey); !ok {
+		return nil, errors.Errorf("expected an RSA key, got %T", signer.Public())
+	}
+	digest := sha256.Sum256([]byte(signingString))
+	if contextSigner, ok := signer.(ContextSigner); ok {
+		return contextSigner.SignContext(ctx, rand.Reader, digest[:], crypto.SHA256)
+	}
+	return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// publicKey returns the RSA public key of signer
+func publicKey(signer crypto.Signer) (*rsa.PublicKey, error) {
+	if signer == nil {
+		return nil, errors.New("signer is required")
+	}
+	pub, ok := signer.Public().(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.Errorf("expected an RSA key, got %T", signer.Public())
+	}
+	return pub, nil
+}